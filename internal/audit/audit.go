@@ -0,0 +1,78 @@
+// Append-only audit log of security-relevant and file events
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const PurgeJob = "audit.purge"
+
+// Recorder writes events to audit log, failure to write is logged and never fails the audited action
+type Recorder struct {
+	repo   models.AuditRepository
+	logger *logrus.Logger
+}
+
+func NewRecorder(repo models.AuditRepository, logger *logrus.Logger) *Recorder {
+	return &Recorder{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (rec *Recorder) Record(c context.Context, event *models.AuditEvent) {
+	// event is kept even if client has gone away
+	if err := rec.repo.RecordAuditEvent(context.WithoutCancel(c), event); err != nil {
+		rec.logger.WithFields(logrus.Fields{
+			"event":     event.Event,
+			"actor_id":  event.ActorID,
+			"owner_id":  event.OwnerID,
+			"file_uuid": event.FileUUID,
+			"ip":        event.IP,
+		}).Errorf("Failed to record audit event: %v", err)
+	}
+}
+
+// RecordRequest records event done by authenticated user of request, or anonymous one when there is none.
+// ownerId is user whose file or account is affected, 0 when it is unknown
+func (rec *Recorder) RecordRequest(r *http.Request, name string, ownerId int, fileUUID string, details map[string]any) {
+	event := &models.AuditEvent{
+		Event:    name,
+		FileUUID: fileUUID,
+		IP:       clientip.ClientIP(r),
+		Details:  details,
+	}
+
+	if actorId, ok := r.Context().Value(ctx.CtxUserIDKey).(int); ok {
+		event.ActorID = &actorId
+	}
+	if ownerId > 0 {
+		event.OwnerID = &ownerId
+	}
+	if keyId, ok := r.Context().Value(ctx.CtxAPIKeyIDKey).(string); ok && keyId != "" {
+		if event.Details == nil {
+			event.Details = map[string]any{}
+		}
+		event.Details["api_key_id"] = keyId
+	}
+
+	rec.Record(r.Context(), event)
+}
+
+// RecordUser records event of user who is not yet in request context, e.g. login or token refresh
+func (rec *Recorder) RecordUser(r *http.Request, name string, userId int, details map[string]any) {
+	rec.Record(r.Context(), &models.AuditEvent{
+		Event:   name,
+		ActorID: &userId,
+		OwnerID: &userId,
+		IP:      clientip.ClientIP(r),
+		Details: details,
+	})
+}
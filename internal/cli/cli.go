@@ -0,0 +1,217 @@
+// Maintenance subcommands run instead of http server, e.g. `binary reconcile -dry-run`
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/integrity"
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Deps are dependencies available to subcommands
+type Deps struct {
+	Cfg        *config.Config
+	FileRepo   models.FileMetaRepository
+	UserRepo   models.UserRepository
+	Migrations models.MigrationRepository
+	Storage    models.FileStorage
+	Logger     *logrus.Logger
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string, deps *Deps) error
+}
+
+var commands = map[string]command{
+	"reconcile": {
+		usage: "find records without blobs and blobs without records, repair them unless -dry-run",
+		run:   reconcile,
+	},
+	"scrub": {
+		usage: "re-hash every stored blob and flag corrupted or missing ones",
+		run:   scrub,
+	},
+	"migrate": {
+		usage: "manage schema: migrate up | down [-steps n] | status | to <version>",
+		run:   migrate,
+	},
+	"set-role": {
+		usage: "change role of user, e.g. set-role -username alice -role admin",
+		run:   setRole,
+	},
+}
+
+// IsCommand reports whether args start with known subcommand
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	_, ok := commands[args[0]]
+	return ok || args[0] == "help"
+}
+
+// Run executes subcommand and returns process exit code
+func Run(args []string, deps *Deps) int {
+	if len(args) == 0 || args[0] == "help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	if err := cmd.run(context.Background(), args[1:], deps); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: binary [command] [flags]\n\nWithout command http server is started.\n\nCommands:")
+	for name, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", name, cmd.usage)
+	}
+}
+
+func reconcile(ctx context.Context, args []string, deps *Deps) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report inconsistencies")
+	grace := fs.Duration("grace", deps.Cfg.Integrity.ReconcileGrace, "skip blobs modified within this period")
+	maxOrphans := fs.Float64("max-orphans", deps.Cfg.Integrity.ReconcileMaxOrphans, "refuse to delete orphan rows when larger share of records miss blobs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := integrity.NewReconciler(deps.FileRepo, deps.Storage, deps.Logger, *grace, *maxOrphans).Reconcile(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	return printJson(report)
+}
+
+func scrub(ctx context.Context, args []string, deps *Deps) error {
+	fs := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := integrity.NewScrubber(deps.FileRepo, deps.Storage, nil, deps.Logger).Scrub(ctx)
+	if err != nil {
+		return err
+	}
+
+	return printJson(report)
+}
+
+func setRole(ctx context.Context, args []string, deps *Deps) error {
+	fs := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	username := fs.String("username", "", "user to change")
+	role := fs.String("role", models.RoleAdmin, fmt.Sprintf("one of %v", models.AllRoles))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	if !models.IsValidRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	if err := deps.UserRepo.SetUserRole(ctx, *username, *role); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is %s now, takes effect on the next token refresh\n", *username, *role)
+	return nil
+}
+
+func migrate(ctx context.Context, args []string, deps *Deps) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand is required: up, down, status or to <version>")
+	}
+
+	var (
+		changed []*models.Migration
+		err     error
+	)
+
+	switch args[0] {
+	case "up":
+		changed, err = deps.Migrations.MigrateUp(ctx)
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		changed, err = deps.Migrations.MigrateDown(ctx, *steps)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("version is required, 0 reverts everything")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		changed, err = deps.Migrations.MigrateTo(ctx, version)
+	case "status":
+		return migrationStatus(ctx, deps)
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+
+	// migrations done before failure are committed, so they are reported either way
+	for _, m := range changed {
+		fmt.Printf("%04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(changed) == 0 {
+		fmt.Println("schema is up to date")
+	}
+	return nil
+}
+
+func migrationStatus(ctx context.Context, deps *Deps) error {
+	statuses, err := deps.Migrations.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range statuses {
+		state := "pending"
+		if m.AppliedAt != nil {
+			state = "applied " + m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d  %-32s %s\n", m.Version, m.Name, state)
+	}
+
+	return nil
+}
+
+func printJson(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -15,44 +15,219 @@ const (
 )
 
 type Config struct {
-	HTTPServer 					`yaml:"http_server"										env-required:"true"`
-	Database   StorageConfig 	`yaml:"database" 										env-required:"true"`
-	Redis      RedisConfig   	`yaml:redis												env-required:"true"`
+	HTTPServer `yaml:"http_server" env-required:"true"`
+	Database   StorageConfig   `yaml:"database" env-required:"true"`
+	Redis      RedisConfig     `yaml:"redis" env-required:"true"`
+	Files      FilesConfig     `yaml:"files"`
+	Integrity  IntegrityConfig `yaml:"integrity"`
+	Jobs       JobsConfig      `yaml:"jobs"`
+	OIDC       OIDCConfig      `yaml:"oidc"`
+	Notify     NotifyConfig    `yaml:"notify"`
+	Account    AccountConfig   `yaml:"account"`
+	Login      LoginConfig     `yaml:"login"`
+	Admin      AdminConfig     `yaml:"admin"`
+	JWT        JWTConfig       `yaml:"jwt"`
+	Audit      AuditConfig     `yaml:"audit"`
+	Webhooks   WebhooksConfig  `yaml:"webhooks"`
+	Tracing    TracingConfig   `yaml:"tracing"`
+	Log        LogConfig       `yaml:"log"`
 }
 
 type HTTPServer struct {
-	Address     string        	`yaml:"address"			env-default:"localhost:8080`
-	Timeout     time.Duration 	`yaml:"timeout" 											env-required:"true"`
-	IdleTimeout time.Duration 	`yaml:"iddle_timeout" 										env-required:"true"`
-	TLS         TLSConfig     	`yaml:"tls"													env-required:"true"`
-	MaxFileSize int64         	`yaml:"max_file_size"`
-	Cors        CORSConfig    	`yaml:"cors"`
+	Address     string        `yaml:"address" env-default:"localhost:8080"`
+	Timeout     time.Duration `yaml:"timeout" env-required:"true"`
+	IdleTimeout time.Duration `yaml:"iddle_timeout" env-required:"true"`
+	// in-flight requests are finished within it on shutdown, then remaining transfers are aborted
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"30s"`
+	TLS             TLSConfig     `yaml:"tls" env-required:"true"`
+	MaxFileSize     int64         `yaml:"max_file_size"`
+	Cors            CORSConfig    `yaml:"cors"`
+	Metrics         MetricsConfig `yaml:"metrics"`
+	Health          HealthConfig  `yaml:"health"`
+	// addresses or CIDRs of proxies in front of the service, client ip is read from X-Forwarded-For only behind them
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type StorageConfig struct {
-	Host         string 		`yaml:"host" 			env-default:"localhost"	`
-	Port         string 		`yaml:"port" 			env-default:"5432" 		`
-	DatabaseName string 		`yaml:"databaseName" 	env-default:"postgres" 	`
-	User         string 		`yaml:"user" 			env-default:"postgres" 	`
-	Password     string 		`yaml:"password" 		env-default:"1488" 		`
+	Host         string `yaml:"host" env-default:"localhost"`
+	Port         string `yaml:"port" env-default:"5432"`
+	DatabaseName string `yaml:"databaseName" env-default:"postgres"`
+	User         string `yaml:"user" env-default:"postgres"`
+	Password     string `yaml:"password" env-default:"1488"`
+	AutoMigrate  bool   `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" env-default:"true"` // pending migrations are applied on start
 }
 
 type RedisConfig struct {
-	Host     string 			`yaml:"host" 			env-default:"localhost"	`
-	Port     string 			`yaml:"port" 			env-default:"5432" 		`
-	User     string 			`yaml:"user" 			env-default:"default" 	`
-	Password string 			`yaml:"password" 		env-default:"" 			`
+	Host     string `yaml:"host" env-default:"localhost"`
+	Port     string `yaml:"port" env-default:"5432"`
+	User     string `yaml:"user" env-default:"default"`
+	Password string `yaml:"password" env-default:""`
 }
 
+// TLSConfig of HTTPS served by the service itself, otherwise TLS is expected to be terminated by gateway.
+// Certificate and key are reloaded when files change
 type TLSConfig struct {
-	CertFile string 			`yaml:"certfile"`
-	KeyFile  string 			`yaml:"keyfile"	`
+	Enabled         bool             `yaml:"enabled" env:"TLS_ENABLED" env-default:"false"`
+	CertFile        string           `yaml:"certfile" env:"TLS_CERT_FILE"`
+	KeyFile         string           `yaml:"keyfile" env:"TLS_KEY_FILE"`
+	HTTP2           bool             `yaml:"http2" env-default:"true"`
+	MinVersion      string           `yaml:"min_version" env-default:"1.2"` // 1.2 or 1.3
+	CipherSuites    []string         `yaml:"cipher_suites"`                 // names of crypto/tls for TLS 1.2, Go defaults when empty
+	RedirectAddress string           `yaml:"redirect_address"`              // plain http listener redirecting to https, disabled when empty
+	ClientAuth      ClientAuthConfig `yaml:"client_auth"`
+}
+
+// ClientAuthConfig of mutual TLS, verified client certificate authenticates user named in it
+type ClientAuthConfig struct {
+	Mode      string `yaml:"mode" env-default:"none"` // none, optional or require
+	CAFile    string `yaml:"ca_file"`
+	UserField string `yaml:"user_field" env-default:"common_name"` // common_name or email, matched against username or email of user
 }
 
 type CORSConfig struct {
-	AllowedOrigins []string 	`yaml:"allowed_origins"`
-	AllowedMethods []string 	`yaml:"allowed_methods"`
-	AllowedHeaders []string 	`yaml:"allowed_headers"`
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+// MetricsConfig of /metrics endpoint, token is required as Bearer when set
+type MetricsConfig struct {
+	Enabled         bool          `yaml:"enabled" env-default:"true"`
+	Token           string        `yaml:"-" env:"METRICS_TOKEN"`
+	StorageInterval time.Duration `yaml:"storage_interval" env-default:"1m"` // storage and user gauges are refreshed this often
+}
+
+// HealthConfig of /readyz probe, each dependency is checked within timeout
+type HealthConfig struct {
+	Timeout      time.Duration `yaml:"timeout" env-default:"2s"`
+	MinFreeSpace uint64        `yaml:"min_free_space" env-default:"1073741824"` // bytes, storage is not ready below it
+}
+
+// FilesConfig describes where uploaded blobs are kept
+type FilesConfig struct {
+	Dir                 string        `yaml:"dir" env-default:"files"`
+	ExpirySweepInterval time.Duration `yaml:"expiry_sweep_interval" env-default:"5m"`
+}
+
+// IntegrityConfig controls the periodic re-hashing of stored blobs and db/storage reconciliation
+type IntegrityConfig struct {
+	ScrubInterval       time.Duration `yaml:"scrub_interval" env-default:"24h"`
+	ReconcileInterval   time.Duration `yaml:"reconcile_interval" env-default:"6h"`
+	ReconcileRepair     bool          `yaml:"reconcile_repair" env-default:"false"`    // when false periodic pass only reports
+	ReconcileGrace      time.Duration `yaml:"reconcile_grace" env-default:"1h"`        // blobs younger than this are never touched
+	ReconcileMaxOrphans float64       `yaml:"reconcile_max_orphans" env-default:"0.5"` // repair is refused when larger share of records miss blobs
+}
+
+// JobsConfig tunes background job workers of this instance
+type JobsConfig struct {
+	Workers      int           `yaml:"workers" env-default:"4"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+	StaleAfter   time.Duration `yaml:"stale_after" env-default:"1h"` // running job whose worker stopped refreshing its lock for this time is requeued
+	Retention    time.Duration `yaml:"retention" env-default:"168h"` // finished jobs are kept for this time
+	RetryBase    time.Duration `yaml:"retry_base" env-default:"10s"`
+	RetryMax     time.Duration `yaml:"retry_max" env-default:"1h"`
+}
+
+// OIDCConfig enables login through external OpenID Connect provider, disabled when issuer is empty
+type OIDCConfig struct {
+	Issuer         string        `yaml:"issuer"`
+	ClientID       string        `yaml:"client_id"`
+	ClientSecret   string        `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL    string        `yaml:"redirect_url"` // public url of /api/oidc/callback
+	Scopes         []string      `yaml:"scopes"`
+	UsernameClaim  string        `yaml:"username_claim" env-default:"preferred_username"`
+	AutoProvision  bool          `yaml:"auto_provision" env-default:"true"`    // create user on first login
+	LinkByUsername bool          `yaml:"link_by_username" env-default:"false"` // attach identity to existing user with same username
+	StateTTL       time.Duration `yaml:"state_ttl" env-default:"10m"`         // time given to user to finish login at provider
+}
+
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// NotifyConfig selects how messages reach users, "fake" driver only logs them and keeps them in memory
+type NotifyConfig struct {
+	Driver string     `yaml:"driver" env-default:"fake"` // smtp | fake
+	From   string     `yaml:"from" env-default:"filedump@localhost"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env-default:"localhost"`
+	Port     string `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// AccountConfig covers self-service account management
+type AccountConfig struct {
+	PasswordResetURL      string        `yaml:"password_reset_url" env-default:"http://localhost:4200/reset-password?token=%s"` // %s is replaced with reset token
+	PasswordResetTTL      time.Duration `yaml:"password_reset_ttl" env-default:"30m"`
+	PasswordResetCooldown time.Duration `yaml:"password_reset_cooldown" env-default:"5m"` // user gets at most one reset message in this time
+	PasswordResetIPLimit  int           `yaml:"password_reset_ip_limit" env-default:"5"`  // reset requests of one client ip within window, 0 is unlimited
+	PasswordResetIPWindow time.Duration `yaml:"password_reset_ip_window" env-default:"1h"`
+}
+
+// LoginConfig throttles password guessing, failures are counted per username and per client ip
+type LoginConfig struct {
+	MaxUserFailures int           `yaml:"max_user_failures" env-default:"5"`
+	MaxIPFailures   int           `yaml:"max_ip_failures" env-default:"0"`  // 0 disables lock of ip, needs real client ip, see trusted_proxies
+	FailureWindow   time.Duration `yaml:"failure_window" env-default:"15m"` // failures older than this are forgotten
+	LockoutDuration time.Duration `yaml:"lockout_duration" env-default:"15m"`
+	DelayBase       time.Duration `yaml:"delay_base" env-default:"250ms"` // doubled with every failure
+	DelayMax        time.Duration `yaml:"delay_max" env-default:"5s"`
+}
+
+// AdminConfig, bootstrap user is promoted to admin on start while there is no admin yet
+type AdminConfig struct {
+	BootstrapUser string `yaml:"bootstrap_user" env:"BOOTSTRAP_ADMIN"`
+}
+
+// JWTConfig selects how tokens are signed. HS256 uses JWT_SECRET_KEY, keys of RS256 and EdDSA are kept in db and rotated
+type JWTConfig struct {
+	Algorithm            string        `yaml:"algorithm" env-default:"HS256"`                             // HS256 | RS256 | EdDSA
+	Secret               string        `yaml:"-" env:"JWT_SECRET_KEY"`                                    // still verifies HS256 tokens when algorithm is asymmetric, unset it once they expire
+	KeyEncryptionKey     string        `yaml:"-" env:"JWT_KEY_ENCRYPTION_KEY"`                            // base64 of 32 bytes, encrypts keys of RS256 and EdDSA stored in db
+	KeyEncryptionKeyFile string        `yaml:"key_encryption_key_file" env:"JWT_KEY_ENCRYPTION_KEY_FILE"` // read when env is not set, e.g. mounted secret
+	Issuer               string        `yaml:"issuer"`                                                    // iss claim, empty to omit
+	RotationInterval     time.Duration `yaml:"rotation_interval" env-default:"720h"`                      // 0 disables scheduled rotation
+	GracePeriod          time.Duration `yaml:"grace_period" env-default:"168h"`                           // retired key still verifies tokens, keep it not less than refresh token ttl
+	ReloadInterval       time.Duration `yaml:"reload_interval" env-default:"1m"`                          // keys rotated by other instances are picked up this often
+}
+
+// AuditConfig, events older than retention are deleted daily, 0 keeps them forever
+type AuditConfig struct {
+	Retention time.Duration `yaml:"retention" env-default:"2160h"`
+}
+
+// WebhooksConfig, delivery failed with network error or non-2xx status is retried with backoff of jobs
+type WebhooksConfig struct {
+	Timeout           time.Duration `yaml:"timeout" env-default:"10s"`
+	MaxAttempts       int           `yaml:"max_attempts" env-default:"8"`
+	MaxPerUser        int           `yaml:"max_per_user" env-default:"10"`
+	AllowPrivate      bool          `yaml:"allow_private" env-default:"false"` // allow endpoints on loopback and private networks
+	DeliveryRetention time.Duration `yaml:"delivery_retention" env-default:"720h"`
+}
+
+// TracingConfig, spans are exported over OTLP/HTTP or printed to stdout for local use
+type TracingConfig struct {
+	Exporter    string            `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"` // none | otlp | stdout
+	Endpoint    string            `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" env-default:"http://localhost:4318"`
+	Headers     map[string]string `yaml:"headers"` // e.g. authorization of collector
+	ServiceName string            `yaml:"service_name" env-default:"filedump"`
+	SampleRatio float64           `yaml:"sample_ratio" env-default:"1"` // share of new traces kept, sampled parent is always followed
+}
+
+// LogConfig, file output is rotated once it grows over max size
+type LogConfig struct {
+	Level      string `yaml:"level" env:"LOG_LEVEL" env-default:"info"`     // debug also logs redacted request headers
+	Format     string `yaml:"format" env:"LOG_FORMAT" env-default:"json"`   // json | text
+	Output     string `yaml:"output" env:"LOG_OUTPUT" env-default:"stdout"` // stdout | file | both
+	File       string `yaml:"file" env-default:"logs/filedump.log"`
+	MaxSizeMB  int    `yaml:"max_size_mb" env-default:"100"`
+	MaxBackups int    `yaml:"max_backups" env-default:"5"`
+	MaxAgeDays int    `yaml:"max_age_days" env-default:"30"`
+	Compress   bool   `yaml:"compress" env-default:"true"` // rotated files are gzipped
 }
 
 func MustLoadConfig() *Config {
@@ -0,0 +1,161 @@
+// Real-time notifications of users, shared by instances through redis pub/sub
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"up-down-server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// every instance listens to one channel and hands events to its own subscribers
+	channel = "filedump:events"
+
+	// events are dropped for subscriber not reading them, client reloads state on reconnect anyway
+	subscriberBuffer = 32
+)
+
+// Subscription receives events of one user until it is closed
+type Subscription struct {
+	C      <-chan *models.Event
+	c      chan *models.Event
+	userId int
+	broker *Broker
+	once   sync.Once
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.unsubscribe(s)
+	})
+}
+
+type Broker struct {
+	cache  models.Cache
+	logger *logrus.Logger
+
+	mu     sync.RWMutex
+	subs   map[int]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBroker(cache models.Cache, logger *logrus.Logger) *Broker {
+	return &Broker{
+		cache:  cache,
+		logger: logger,
+		subs:   make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends event to subscribers of user on every instance, failure is logged only
+func (b *Broker) Publish(ctx context.Context, userId int, eventType string, data any) {
+	raw, err := json.Marshal(&models.Event{
+		ID:     uuid.New().String(),
+		UserID: userId,
+		Type:   eventType,
+		At:     time.Now().UTC(),
+		Data:   data,
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to encode event: %v", err)
+		return
+	}
+
+	if err := b.cache.Publish(context.WithoutCancel(ctx), channel, raw); err != nil {
+		b.logger.Errorf("Failed to publish event %s: %v", eventType, err)
+	}
+}
+
+// Subscribe starts receiving events of user, subscription must be closed.
+// C is closed once broker is closed, subscriber is expected to reconnect to another instance
+func (b *Broker) Subscribe(userId int) *Subscription {
+	c := make(chan *models.Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, userId: userId, broker: b}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(c)
+		return sub
+	}
+	if b.subs[userId] == nil {
+		b.subs[userId] = make(map[*Subscription]struct{})
+	}
+	b.subs[userId][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Run listens to redis channel until ctx is done
+func (b *Broker) Run(ctx context.Context) {
+	pubsub := b.cache.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			event := new(models.Event)
+			if err := json.Unmarshal([]byte(msg.Payload), event); err != nil {
+				b.logger.Errorf("Failed to decode event: %v", err)
+				continue
+			}
+
+			b.deliver(event)
+		}
+	}
+}
+
+// Close ends every subscription, so streams do not hold server that is shutting down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for _, subs := range b.subs {
+		for sub := range subs {
+			close(sub.c)
+		}
+	}
+	b.subs = make(map[int]map[*Subscription]struct{})
+}
+
+func (b *Broker) deliver(event *models.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs[event.UserID] {
+		select {
+		case sub.c <- event:
+		default:
+			b.logger.Warnf("Event %s dropped for slow subscriber of user %d", event.Type, event.UserID)
+		}
+	}
+}
+
+func (b *Broker) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subs[sub.userId], sub)
+	if len(b.subs[sub.userId]) == 0 {
+		delete(b.subs, sub.userId)
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"up-down-server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const probePrefix = ".health-"
+
+// Pinger is dependency answering ping, like cache
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Database is connection pool, its stats are reported as details
+type Database interface {
+	Pinger
+	Stats() sql.DBStats
+}
+
+func DatabaseCheck(db Database) Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		err := db.Ping(ctx)
+
+		stats := db.Stats()
+		return map[string]any{
+			"open":          stats.OpenConnections,
+			"in_use":        stats.InUse,
+			"idle":          stats.Idle,
+			"max_open":      stats.MaxOpenConnections,
+			"wait_count":    stats.WaitCount,
+			"wait_duration": stats.WaitDuration.String(),
+		}, err
+	}
+}
+
+func PingCheck(p Pinger) Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		return nil, p.Ping(ctx)
+	}
+}
+
+// StorageCheck writes probe blob that is aborted so it never becomes visible,
+// storage is down when it is not writable or has less than minFree bytes free
+func StorageCheck(storage models.FileStorage, minFree uint64) Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		details := map[string]any{
+			"writable":       false,
+			"min_free_bytes": minFree,
+		}
+
+		usage, err := storage.DiskUsage()
+		if err != nil {
+			return details, err
+		}
+		details["free_bytes"] = usage.FreeBytes
+		details["total_bytes"] = usage.TotalBytes
+
+		if err := probeWrite(storage); err != nil {
+			return details, err
+		}
+		details["writable"] = true
+
+		if usage.FreeBytes < minFree {
+			return details, fmt.Errorf("free space %d bytes is below minimum of %d bytes", usage.FreeBytes, minFree)
+		}
+
+		return details, nil
+	}
+}
+
+func probeWrite(storage models.FileStorage) error {
+	pending, err := storage.Create(probePrefix + uuid.NewString())
+	if err != nil {
+		return err
+	}
+
+	if _, err := pending.Write([]byte{0}); err != nil {
+		pending.Abort()
+		return err
+	}
+
+	return pending.Abort()
+}
@@ -0,0 +1,112 @@
+// Readiness checks of dependencies, run concurrently each with its own timeout
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check returns details of dependency, error makes it down
+type Check func(ctx context.Context) (map[string]any, error)
+
+var started = time.Now()
+
+// Uptime of the process
+func Uptime() time.Duration {
+	return time.Since(started)
+}
+
+type Result struct {
+	Status     string         `json:"status"`
+	DurationMS int64          `json:"duration_ms"`
+	Error      string         `json:"error,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks[name] = check
+}
+
+// Run executes every check, ready is false when any dependency is down
+func (c *Checker) Run(ctx context.Context) (bool, map[string]*Result) {
+	results := make(map[string]*Result, len(c.names))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range c.names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, c.checks[name])
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		if result.Status != StatusUp {
+			ready = false
+		}
+	}
+
+	return ready, results
+}
+
+func (c *Checker) run(ctx context.Context, check Check) *Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]any
+		err     error
+	}
+	// buffered so check that ignores ctx, like write to hung disk, does not leak blocked goroutine
+	done := make(chan outcome, 1)
+
+	start := time.Now()
+	go func() {
+		details, err := check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	result := &Result{Status: StatusUp}
+	select {
+	case o := <-done:
+		result.Details = o.details
+		if o.err != nil {
+			result.Status = StatusDown
+			result.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = StatusDown
+		result.Error = ctx.Err().Error()
+	}
+	result.DurationMS = time.Since(start).Milliseconds()
+
+	return result
+}
@@ -11,8 +11,13 @@ type contextKey string
 // most used keys in ctx
 const (
 	CtxSessionIDKey contextKey 	= "session_id"
+	CtxTokenExpKey 	contextKey 	= "token_exp"  // time.Time, set only when request is authenticated with access token
 	CtxUserIDKey 	contextKey	= "user_id"
 	CtxFinishedKey 	contextKey 	= "finished"
+	CtxScopesKey 	contextKey 	= "scopes"     // []string granted to credentials of request
+	CtxAPIKeyIDKey 	contextKey 	= "api_key_id" // set only when request is authenticated with API key
+	CtxRoleKey 		contextKey 	= "role"
+	CtxRequestIDKey contextKey 	= "request_id"
 )
 
 func WrapValueIntoRequest(r *http.Request, key contextKey, value any) *http.Request {
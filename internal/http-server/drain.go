@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requests still running after grace period are given this long to clean up once aborted
+const abortTimeout = 5 * time.Second
+
+// inflight counts handlers being run, http.Server tracks connections only,
+// so after forced close there is no other way to know aborted uploads removed their partial files
+type inflight struct {
+	wg sync.WaitGroup
+
+	// base of every request context, cancelled to abort requests when grace period is over
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newInflight() *inflight {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &inflight{ctx: ctx, cancel: cancel}
+}
+
+func (i *inflight) baseContext(net.Listener) context.Context {
+	return i.ctx
+}
+
+func (i *inflight) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.wg.Add(1)
+		defer i.wg.Done()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// abort cancels contexts of requests and waits for their handlers to return, false on timeout
+func (i *inflight) abort(timeout time.Duration) bool {
+	i.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
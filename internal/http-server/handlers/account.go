@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/bcrypthashing"
+	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/lib/validinput"
+	"up-down-server/internal/metrics"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// holds id of user who requested reset, keyed by hash of token so cache dump does not leak usable tokens
+	passwordResetKey = "password reset:%s"
+	// counts reset requests of client ip within window
+	passwordResetIPKey = "password reset:ip:%s"
+	// set while user may not get another reset message
+	passwordResetCooldownKey = "password reset cooldown:%d"
+
+	// holds id of user who has just logged in through identity provider, keyed by session.
+	// User without password confirms sensitive changes with such login instead
+	freshOIDCLoginKey = "oidc fresh login:%s"
+	freshLoginTTL     = 10 * time.Minute
+
+	notifyTimeout = 30 * time.Second
+)
+
+// Changes password of logged in user, every other session of user is revoked.
+// User created by identity provider sets first password after fresh login through provider
+func (h *Handlers) ChangePassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+		sessionId, _ := r.Context().Value(ctx.CtxSessionIDKey).(string)
+
+		var req dto.ChangePasswordRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		if !validinput.IsValidPassword(req.NewPassword) {
+			models.SendErrorJson(w, http.StatusBadRequest, "new password is too weak")
+			return
+		}
+
+		if !h.verifyPassword(w, r, userId, req.CurrentPassword) {
+			return
+		}
+
+		if !h.setPassword(w, r, userId, req.NewPassword) {
+			return
+		}
+
+		revoked, err := h.revokeUserSessions(r, userId, sessionId)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "password changed, but failed to revoke other sessions")
+			return
+		}
+
+		data := models.NewData()
+		data["revoked_sessions"] = revoked
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Sets or removes email used for password reset, requires password or fresh provider login of user without one
+func (h *Handlers) ChangeEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		var req dto.ChangeEmailRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+		if req.Email != "" && !validinput.IsValidEmail(req.Email) {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid email")
+			return
+		}
+
+		if !h.verifyPassword(w, r, userId, req.Password) {
+			return
+		}
+
+		if err := h.userRepo.SetEmail(r.Context(), userId, req.Email); err != nil {
+			switch err.Error() {
+			case postgresql.AlreadyExists:
+				models.SendErrorJson(w, http.StatusConflict, "email is already taken")
+			default:
+				h.log(r).Errorf("Failed to set email: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to set email")
+			}
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Sends reset link to email of user. Response is the same whether user exists or not.
+// Requests are limited per client ip and user gets at most one message per cooldown, so endpoint can not flood mailboxes
+func (h *Handlers) ForgotPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests, err := h.cache.Incr(r.Context(), fmt.Sprintf(passwordResetIPKey, clientip.ClientIP(r)), h.accountCfg.PasswordResetIPWindow)
+		if err != nil {
+			h.log(r).Errorf("failed to count password reset requests: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		if limit := h.accountCfg.PasswordResetIPLimit; limit > 0 && requests > int64(limit) {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimiterPasswordReset).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.accountCfg.PasswordResetIPWindow.Seconds()))))
+			models.SendErrorJson(w, http.StatusTooManyRequests, "too many password reset requests, try again later")
+			return
+		}
+
+		var req dto.ForgotPasswordRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		login := strings.TrimSpace(req.Login)
+		if login == "" {
+			models.SendErrorJson(w, http.StatusBadRequest, "login is required")
+			return
+		}
+
+		userId, email, err := h.userRepo.FindUserForReset(r.Context(), login)
+		if err == nil {
+			err = h.sendPasswordReset(r.Context(), userId, email)
+		}
+
+		if err != nil && err.Error() != postgresql.NotFound {
+			h.log(r).Errorf("Failed to start password reset: %v", err)
+		}
+
+		models.SendSuccessJson(w, http.StatusAccepted, nil)
+	}
+}
+
+// Sets new password with token from reset message, every session of user is revoked
+func (h *Handlers) ResetPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req dto.ResetPasswordRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		if !validinput.IsValidPassword(req.NewPassword) {
+			models.SendErrorJson(w, http.StatusBadRequest, "new password is too weak")
+			return
+		}
+
+		// token is consumed at once, so it works only one time
+		value, err := h.cache.GetDel(r.Context(), fmt.Sprintf(passwordResetKey, hashResetToken(req.Token)))
+		if err == redis.Nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "reset token is invalid or expired")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("failed to read reset token: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		userId, err := strconv.Atoi(value)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "reset token is corrupted")
+			return
+		}
+
+		if !h.setPassword(w, r, userId, req.NewPassword) {
+			return
+		}
+
+		if _, err := h.revokeUserSessions(r, userId, ""); err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "password changed, but failed to revoke sessions")
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Deletes account with its files, blobs, sessions and api keys. Share links die with file records.
+// Requires password, or fresh provider login of user without one, and second factor when enabled
+func (h *Handlers) DeleteAccount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := h.reauthenticate(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := h.revokeUserSessions(r, userId, ""); err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to revoke sessions")
+			return
+		}
+
+		fileUUIDs, err := h.userRepo.DeleteUser(r.Context(), userId)
+		if err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "user not found")
+			default:
+				h.log(r).Errorf("Failed to delete user: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to delete account")
+			}
+			return
+		}
+
+		// records are gone already, blobs failed to remove here are collected by reconciliation
+		for _, fileUUID := range fileUUIDs {
+			if err := h.removeBlob(r, fileUUID); err != nil {
+				h.log(r).Errorf("Failed to remove blob %s of deleted user: %v", fileUUID, err)
+			}
+		}
+
+		data := models.NewData()
+		data["deleted_files"] = len(fileUUIDs)
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// verifyPassword checks current password of logged in user. User without password is accepted
+// when session was started by identity provider login within freshLoginTTL. Error response is sent when false.
+// Failures are counted by login guard together with failed logins, so stolen access token gives no free guesses
+func (h *Handlers) verifyPassword(w http.ResponseWriter, r *http.Request, userId int, password string) bool {
+	username, err := h.userRepo.GetUsername(r.Context(), userId)
+	if err != nil {
+		h.log(r).Errorf("Failed to get username: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "failed to verify password")
+		return false
+	}
+
+	ip := clientip.ClientIP(r)
+	if left, err := h.loginGuard.Locked(r.Context(), username, ip); err != nil {
+		h.log(r).Errorf("Failed to check login lock: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+		return false
+	} else if left > 0 {
+		tooManyAttempts(w, left)
+		return false
+	}
+
+	err = h.userRepo.VerifyPassword(r.Context(), userId, password)
+	if err == nil {
+		if err := h.loginGuard.Success(r.Context(), username); err != nil {
+			h.log(r).Errorf("Failed to reset login failures: %v", err)
+		}
+		return true
+	}
+
+	switch err.Error() {
+	case postgresql.UnAuthorized, postgresql.NotFound:
+		delay, lockedFor, err := h.loginGuard.Failure(r.Context(), username, ip)
+		if err != nil {
+			h.log(r).Errorf("Failed to count password failure: %v", err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return false
+		}
+
+		if lockedFor > 0 {
+			tooManyAttempts(w, lockedFor)
+			return false
+		}
+		models.SendErrorJson(w, http.StatusUnauthorized, "invalid credentials")
+	case postgresql.NoPassword:
+		fresh, err := h.freshOIDCLogin(r, userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to check oidc login: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return false
+		} else if fresh {
+			return true
+		}
+
+		models.SendErrorJson(w, http.StatusForbidden, "account has no password, log in through identity provider again and retry within %s", freshLoginTTL)
+	default:
+		h.log(r).Errorf("Failed to verify password: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "failed to verify password")
+	}
+
+	return false
+}
+
+// freshOIDCLogin reports whether session of request was started by identity provider login not long ago
+func (h *Handlers) freshOIDCLogin(r *http.Request, userId int) (bool, error) {
+	sessionId, _ := r.Context().Value(ctx.CtxSessionIDKey).(string)
+	if sessionId == "" {
+		return false, nil
+	}
+
+	value, err := h.cache.Get(r.Context(), fmt.Sprintf(freshOIDCLoginKey, sessionId))
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return fmt.Sprint(value) == strconv.Itoa(userId), nil
+}
+
+// setPassword hashes and stores password, error response is sent when false
+func (h *Handlers) setPassword(w http.ResponseWriter, r *http.Request, userId int, password string) bool {
+	hashed, err := bcrypthashing.BcryptHashing(password)
+	if err != nil {
+		h.log(r).Errorf("Bcrypt error during hashing: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "Internal Server Error")
+		return false
+	}
+
+	if err := h.userRepo.UpdatePassword(r.Context(), userId, hashed); err != nil {
+		switch err.Error() {
+		case postgresql.NotFound:
+			models.SendErrorJson(w, http.StatusNotFound, "user not found")
+		default:
+			h.log(r).Errorf("Failed to update password: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to update password")
+		}
+		return false
+	}
+
+	return true
+}
+
+// sendPasswordReset stores reset token and sends link with it, delivery runs aside so timing does not tell whether user exists.
+// Nothing is sent while previous message of user is within cooldown
+func (h *Handlers) sendPasswordReset(ctx context.Context, userId int, email string) error {
+	if cooldown := h.accountCfg.PasswordResetCooldown; cooldown > 0 {
+		fresh := h.cache.SetNX(ctx, fmt.Sprintf(passwordResetCooldownKey, userId), 1, cooldown)
+		if err := fresh.Err(); err != nil {
+			return err
+		}
+		if !fresh.Val() {
+			return nil
+		}
+	}
+
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw[:])
+
+	ttl := h.accountCfg.PasswordResetTTL
+	if err := h.cache.Set(ctx, fmt.Sprintf(passwordResetKey, hashResetToken(token)), userId, ttl); err != nil {
+		return err
+	}
+
+	msg := &models.Message{
+		To:      email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Someone requested password reset for your filedump account.\n\n"+
+			"Open the link below within %s to set new password:\n%s\n\n"+
+			"If it was not you, ignore this message.", ttl, fmt.Sprintf(h.accountCfg.PasswordResetURL, token)),
+	}
+
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		if err := h.notifier.Send(sendCtx, msg); err != nil {
+			h.logger.WithContext(ctx).Errorf("Failed to send password reset to user %d: %v", userId, err)
+		}
+	}()
+
+	return nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
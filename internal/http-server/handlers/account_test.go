@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// asSession makes request look authenticated by access token of session
+func asSession(r *http.Request, userId int, sessionId string) *http.Request {
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxUserIDKey, userId)
+	return ctx.WrapValueIntoRequest(r, ctx.CtxSessionIDKey, sessionId)
+}
+
+func TestChangePasswordOfPasswordlessUser(t *testing.T) {
+	h, deps, provider := newOIDCTest(t)
+
+	loginThroughProvider(t, h, provider, "subject-bob", map[string]any{"preferred_username": "bob"})
+	loginThroughProvider(t, h, provider, "subject-bob", map[string]any{"preferred_username": "bob"})
+
+	stale, fresh := deps.sessions.sessions[0], deps.sessions.sessions[1]
+	deps.cache.expire(fmt.Sprintf(freshOIDCLoginKey, stale.SessionID))
+
+	changePassword := func(sessionId, current string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"current_password": %q, "new_password": "NewPassw0rd"}`, current)
+		req := asSession(httptest.NewRequest(http.MethodPost, "/api/account/password", strings.NewReader(body)), stale.UserID, sessionId)
+
+		rec := httptest.NewRecorder()
+		h.ChangePassword()(rec, req)
+		return rec
+	}
+
+	if rec := changePassword(stale.SessionID, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("session without fresh provider login: expected %d, got %d: %s", http.StatusForbidden, rec.Code, rec.Body)
+	}
+
+	if rec := changePassword(fresh.SessionID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("fresh provider login: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	// once password is set it is required like for any other user
+	if err := deps.users.VerifyPassword(t.Context(), stale.UserID, "NewPassw0rd"); err != nil {
+		t.Fatalf("password is not set: %v", err)
+	}
+	if rec := changePassword(fresh.SessionID, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: expected %d, got %d: %s", http.StatusUnauthorized, rec.Code, rec.Body)
+	}
+}
+
+func newResetTest(t *testing.T) (*Handlers, *testDeps, *notify.FakeNotifier) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	notifier := notify.NewFakeNotifier(logger)
+
+	deps := &testDeps{
+		notifier: notifier,
+		account: config.AccountConfig{
+			PasswordResetURL:      "http://localhost/reset-password?token=%s",
+			PasswordResetTTL:      time.Minute,
+			PasswordResetCooldown: time.Minute,
+			PasswordResetIPLimit:  5,
+			PasswordResetIPWindow: time.Hour,
+		},
+	}
+
+	return newTestHandlers(t, deps), deps, notifier
+}
+
+func forgotPassword(h *Handlers, login, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/forgot", strings.NewReader(fmt.Sprintf(`{"login": %q}`, login)))
+	req.RemoteAddr = ip + ":40000"
+
+	rec := httptest.NewRecorder()
+	h.ForgotPassword()(rec, req)
+	return rec
+}
+
+func resetPassword(h *Handlers, token, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"token": %q, "new_password": %q}`, token, password)
+
+	rec := httptest.NewRecorder()
+	h.ResetPassword()(rec, httptest.NewRequest(http.MethodPost, "/api/auth/password/reset", strings.NewReader(body)))
+	return rec
+}
+
+// waitResetToken waits for message number n, delivery runs aside, and returns token of its link
+func waitResetToken(t *testing.T, notifier *notify.FakeNotifier, n int) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(notifier.Sent()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d reset messages, got %d", n, len(notifier.Sent()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	msg := notifier.Sent()[n-1]
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if link, err := url.Parse(line); err == nil && link.Query().Get("token") != "" {
+			return link.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("no reset link in message: %s", msg.Body)
+	return ""
+}
+
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	h, deps, notifier := newResetTest(t)
+	userId := deps.users.add("carol", "OldPassw0rd", "carol@example.com")
+
+	if rec := forgotPassword(h, "carol", "10.0.0.1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot: expected %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body)
+	}
+
+	token := waitResetToken(t, notifier, 1)
+	if to := notifier.Sent()[0].To; to != "carol@example.com" {
+		t.Errorf("message sent to %s, expected carol@example.com", to)
+	}
+
+	if rec := resetPassword(h, token, "NewPassw0rd"); rec.Code != http.StatusOK {
+		t.Fatalf("reset: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if err := deps.users.VerifyPassword(t.Context(), userId, "NewPassw0rd"); err != nil {
+		t.Fatalf("password is not changed: %v", err)
+	}
+
+	if rec := resetPassword(h, token, "OtherPassw0rd"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reused token: expected %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body)
+	}
+	if err := deps.users.VerifyPassword(t.Context(), userId, "NewPassw0rd"); err != nil {
+		t.Fatalf("reused token changed password: %v", err)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	h, deps, notifier := newResetTest(t)
+	userId := deps.users.add("dave", "OldPassw0rd", "dave@example.com")
+
+	forgotPassword(h, "dave@example.com", "10.0.0.1")
+	token := waitResetToken(t, notifier, 1)
+
+	deps.cache.expire(fmt.Sprintf(passwordResetKey, hashResetToken(token)))
+
+	if rec := resetPassword(h, token, "NewPassw0rd"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expired token: expected %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body)
+	}
+	if err := deps.users.VerifyPassword(t.Context(), userId, "OldPassw0rd"); err != nil {
+		t.Fatalf("expired token changed password: %v", err)
+	}
+}
+
+func TestForgotPasswordIsLimited(t *testing.T) {
+	h, deps, notifier := newResetTest(t)
+	deps.users.add("erin", "OldPassw0rd", "erin@example.com")
+
+	// user gets one message per cooldown, asking again looks the same to client
+	for i := 0; i < 3; i++ {
+		if rec := forgotPassword(h, "erin", fmt.Sprintf("10.0.1.%d", i)); rec.Code != http.StatusAccepted {
+			t.Fatalf("forgot: expected %d, got %d: %s", http.StatusAccepted, rec.Code, rec.Body)
+		}
+	}
+	waitResetToken(t, notifier, 1)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(notifier.Sent()); n != 1 {
+		t.Errorf("expected 1 message within cooldown, got %d", n)
+	}
+
+	// one ip may not probe many logins
+	for i := 0; i < deps.account.PasswordResetIPLimit; i++ {
+		forgotPassword(h, fmt.Sprintf("nobody-%d", i), "10.0.2.1")
+	}
+	rec := forgotPassword(h, "nobody", "10.0.2.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over ip limit: expected %d, got %d: %s", http.StatusTooManyRequests, rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Retry-After is not set")
+	}
+}
+
+func TestPasswordConfirmationIsThrottled(t *testing.T) {
+	deps := &testDeps{login: config.LoginConfig{MaxUserFailures: 3, FailureWindow: time.Minute, LockoutDuration: time.Minute}}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("frank", "OldPassw0rd", "frank@example.com")
+
+	changePassword := func(current string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"current_password": %q, "new_password": "NewPassw0rd"}`, current)
+		req := asSession(httptest.NewRequest(http.MethodPost, "/api/account/password", strings.NewReader(body)), userId, "session")
+
+		rec := httptest.NewRecorder()
+		h.ChangePassword()(rec, req)
+		return rec
+	}
+
+	for i := 1; i < deps.login.MaxUserFailures; i++ {
+		if rec := changePassword(fmt.Sprintf("guess-%d", i)); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected %d, got %d: %s", i, http.StatusUnauthorized, rec.Code, rec.Body)
+		}
+	}
+	if rec := changePassword("last guess"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("guess over limit: expected %d, got %d: %s", http.StatusTooManyRequests, rec.Code, rec.Body)
+	}
+
+	// lock holds even for the right password, and covers password login of the same user
+	if rec := changePassword("OldPassw0rd"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("right password while locked: expected %d, got %d: %s", http.StatusTooManyRequests, rec.Code, rec.Body)
+	}
+	if err := deps.users.VerifyPassword(t.Context(), userId, "OldPassw0rd"); err != nil {
+		t.Fatalf("password changed while locked: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.LogIn()(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username": "frank", "password": "OldPassw0rd"}`)))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login while locked: expected %d, got %d: %s", http.StatusTooManyRequests, rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/http-server/middlewares"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 500
+	defaultStatsDays  = 30
+	maxStatsDays      = 365
+)
+
+// Users with storage usage. Optional params "q" to search username or email, "limit" and "offset"
+func (h *Handlers) AdminListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, ok := intParam(query.Get("limit"), defaultUsersLimit, 1, maxUsersLimit)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "limit must be between 1 and %d", maxUsersLimit)
+			return
+		}
+
+		offset, ok := intParam(query.Get("offset"), 0, 0, int(^uint32(0)>>1))
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "offset must not be negative")
+			return
+		}
+
+		users, err := h.adminRepo.ListUsers(r.Context(), query.Get("q"), limit, offset)
+		if err != nil {
+			h.log(r).Errorf("Failed to list users: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list users")
+			return
+		}
+
+		data := models.NewData()
+		data["users"] = users
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+func (h *Handlers) AdminGetUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := h.adminRepo.GetUserSummary(r.Context(), userId)
+		if err != nil {
+			h.sendUserError(w, r, err, "failed to fetch user")
+			return
+		}
+
+		data := models.NewData()
+		data["user"] = user
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Disables account and ends every its session, api keys stop working too
+func (h *Handlers) AdminDisableUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		if userId == r.Context().Value(ctx.CtxUserIDKey).(int) {
+			models.SendErrorJson(w, http.StatusBadRequest, "admin can not disable own account")
+			return
+		}
+
+		if err := h.adminRepo.SetUserDisabled(r.Context(), userId, true); err != nil {
+			h.sendUserError(w, r, err, "failed to disable user")
+			return
+		}
+
+		revoked, err := h.revokeUserSessions(r, userId, "")
+		if err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "user is disabled, but failed to revoke sessions")
+			return
+		}
+
+		h.audit.RecordRequest(r, models.AuditAdminUserDisable, userId, "", map[string]any{"revoked_sessions": revoked})
+
+		data := models.NewData()
+		data["revoked_sessions"] = revoked
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+func (h *Handlers) AdminEnableUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.adminRepo.SetUserDisabled(r.Context(), userId, false); err != nil {
+			h.sendUserError(w, r, err, "failed to enable user")
+			return
+		}
+
+		h.audit.RecordRequest(r, models.AuditAdminUserEnable, userId, "", nil)
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Ends every session of user, access tokens stop working at once
+func (h *Handlers) AdminLogoutUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		revoked, err := h.revokeUserSessions(r, userId, "")
+		if err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to revoke sessions")
+			return
+		}
+
+		h.audit.RecordRequest(r, models.AuditAdminUserLogout, userId, "", map[string]any{"revoked_sessions": revoked})
+
+		data := models.NewData()
+		data["revoked_sessions"] = revoked
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Lifts login lockout of user and forgets its failed attempts, clears its request rate limits on every ip
+// and password reset cooldown
+func (h *Handlers) AdminResetUserLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		username, err := h.userRepo.GetUsername(r.Context(), userId)
+		if err != nil {
+			h.sendUserError(w, r, err, "failed to fetch user")
+			return
+		}
+
+		if err := h.loginGuard.Reset(r.Context(), username); err != nil {
+			h.log(r).Errorf("Failed to reset login limits: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		cleared, err := h.cache.DelMatch(r.Context(), middlewares.RateLimitKeysOf(userId))
+		if err != nil {
+			h.log(r).Errorf("Failed to reset rate limits: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		if err := h.cache.Del(r.Context(), fmt.Sprintf(passwordResetCooldownKey, userId)); err != nil {
+			h.log(r).Errorf("Failed to reset password reset cooldown: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		if err := h.cache.Del(r.Context(), fmt.Sprintf(twoFactorReauthAttemptsKey, userId)); err != nil {
+			h.log(r).Errorf("Failed to reset 2fa attempts: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		h.audit.RecordRequest(r, models.AuditAdminUserResetLimits, userId, "", map[string]any{"username": username, "rate_limits": cleared})
+
+		data := models.NewData()
+		data["rate_limits"] = cleared
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Files of any user, accepts the same filter params as ListFile
+func (h *Handlers) AdminListUserFiles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUserID(w, r)
+		if !ok {
+			return
+		}
+
+		filter, ok := parseFileFilter(r)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid filter, use tag=<tag> and attr=<key>:<value>")
+			return
+		}
+
+		records, err := h.fileRepo.GetUserRecords(r.Context(), userId, filter)
+		if err != nil {
+			h.log(r).Errorf("Failed to retrieve records: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "Record retrieve error")
+			return
+		}
+
+		data := models.NewData()
+		data["records"] = records
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Deletes file of any user, e.g. abusive content
+func (h *Handlers) AdminDeleteFile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileuuid := r.PathValue("id")
+		if uuid.Validate(fileuuid) != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid file id")
+			return
+		}
+
+		filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid)
+		if err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "file not found")
+			default:
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
+			}
+			return
+		}
+
+		if err := h.fileRepo.DeleteFileByUUID(r.Context(), fileuuid); err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "file not found")
+			default:
+				h.log(r).Errorf("Failed to delete record: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "Failed to delete record")
+			}
+			return
+		}
+
+		if err := h.removeBlob(r, fileuuid); err != nil {
+			h.log(r).Errorf("Failed to delete file, left for reconciliation: %v", err)
+		}
+
+		h.audit.RecordRequest(r, models.AuditAdminFileDelete, filemeta.UserID, fileuuid, map[string]any{"filename": filemeta.FileName})
+		h.fileEvent(r, filemeta.UserID, models.WebhookFileDeleted, map[string]any{"file_id": fileuuid, "file_name": filemeta.FileName})
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Totals of users, files and bytes with uploads per day, optional param "days" (default 30)
+func (h *Handlers) AdminStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days, ok := intParam(r.URL.Query().Get("days"), defaultStatsDays, 1, maxStatsDays)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "days must be between 1 and %d", maxStatsDays)
+			return
+		}
+
+		stats, err := h.adminRepo.StorageStats(r.Context(), days)
+		if err != nil {
+			h.log(r).Errorf("Failed to compute stats: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to compute stats")
+			return
+		}
+
+		data := models.NewData()
+		data["stats"] = stats
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+func (h *Handlers) sendUserError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if err.Error() == postgresql.NotFound {
+		models.SendErrorJson(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	h.log(r).Errorf("%s: %v", msg, err)
+	models.SendErrorJson(w, http.StatusInternalServerError, "%s", msg)
+}
+
+// pathUserID parses {id} path value, error response is sent when false
+func pathUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userId <= 0 {
+		models.SendErrorJson(w, http.StatusBadRequest, "invalid user id")
+		return 0, false
+	}
+
+	return userId, true
+}
+
+// intParam parses optional query param, def is used when it is empty
+func intParam(raw string, def, min, max int) (int, bool) {
+	if raw == "" {
+		return def, true
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || value > max {
+		return 0, false
+	}
+
+	return value, true
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/apikey"
+	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/expiry"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+)
+
+const maxAPIKeyNameLength = 64
+
+// Creates API key, full key is returned only in this response
+func (h *Handlers) CreateAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		var req dto.CreateAPIKeyRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+			models.SendErrorJson(w, http.StatusBadRequest, "name is required and must be at most %d characters", maxAPIKeyNameLength)
+			return
+		}
+
+		scopes, ok := normalizeScopes(req.Scopes)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "unknown scope, allowed: %s", strings.Join(models.AllScopes, ", "))
+			return
+		}
+
+		expiresAt, err := expiry.Parse(req.ExpiresAt, req.ExpiresIn, time.Now())
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+
+		key, prefix, hash, err := apikey.Generate()
+		if err != nil {
+			h.log(r).Errorf("Failed to generate api key: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to generate api key")
+			return
+		}
+
+		record := &models.APIKey{
+			KeyID:     uuid.New().String(),
+			UserID:    userId,
+			Name:      req.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+			ExpiresAt: expiresAt,
+		}
+
+		if err := h.apiKeyRepo.CreateAPIKey(r.Context(), record); err != nil {
+			h.log(r).Errorf("Failed to save api key: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to save api key")
+			return
+		}
+
+		data := models.NewData()
+		data["api_key"] = record
+		data["key"] = key
+		models.SendSuccessJson(w, http.StatusCreated, data)
+	}
+}
+
+// Lists API keys of user without secrets
+func (h *Handlers) ListAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		keys, err := h.apiKeyRepo.ListAPIKeys(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to list api keys: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list api keys")
+			return
+		}
+
+		data := models.NewData()
+		data["api_keys"] = keys
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Revokes API key by its id in path, takes effect on the next request made with it
+func (h *Handlers) RevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		keyId := r.PathValue("id")
+		if uuid.Validate(keyId) != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid key id")
+			return
+		}
+
+		if err := h.apiKeyRepo.RevokeAPIKey(r.Context(), userId, keyId); err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "api key not found")
+			default:
+				h.log(r).Errorf("Failed to revoke api key: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to revoke api key")
+			}
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// normalizeScopes drops duplicates, empty list means read only
+func normalizeScopes(scopes []string) ([]string, bool) {
+	if len(scopes) == 0 {
+		return []string{models.ScopeRead}, true
+	}
+
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !models.HasScope(models.AllScopes, scope) {
+			return nil, false
+		}
+
+		if !models.HasScope(result, scope) {
+			result = append(result, scope)
+		}
+	}
+
+	return result, true
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"up-down-server/internal/models"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	cases := []struct {
+		name     string
+		scopes   []string
+		expected []string
+		ok       bool
+	}{
+		{"empty grants read", nil, []string{models.ScopeRead}, true},
+		{"case and spaces", []string{" Upload", "READ "}, []string{models.ScopeUpload, models.ScopeRead}, true},
+		{"duplicates", []string{"share", "share"}, []string{models.ScopeShare}, true},
+		{"unknown", []string{"read", "admin"}, nil, false},
+	}
+
+	for _, tc := range cases {
+		scopes, ok := normalizeScopes(tc.scopes)
+		if ok != tc.ok || !slices.Equal(scopes, tc.expected) {
+			t.Errorf("%s: expected %v %v, got %v %v", tc.name, tc.expected, tc.ok, scopes, ok)
+		}
+	}
+}
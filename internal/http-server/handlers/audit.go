@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Audit log of user: own actions and actions on own files, e.g. downloads via share link.
+// Optional params "event", "file_id", "since" and "until" (RFC3339), "limit" and "before" (id of last event of previous page)
+func (h *Handlers) ListAuditEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, ok := parseAuditFilter(w, r)
+		if !ok {
+			return
+		}
+
+		filter.UserID = r.Context().Value(ctx.CtxUserIDKey).(int)
+		h.sendAuditEvents(w, r, filter)
+	}
+}
+
+// Audit log of every user, accepts the same params as ListAuditEvents and optional "user_id"
+func (h *Handlers) AdminListAuditEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, ok := parseAuditFilter(w, r)
+		if !ok {
+			return
+		}
+
+		if raw := r.URL.Query().Get("user_id"); raw != "" {
+			userId, err := strconv.Atoi(raw)
+			if err != nil || userId <= 0 {
+				models.SendErrorJson(w, http.StatusBadRequest, "invalid user_id")
+				return
+			}
+			filter.UserID = userId
+		}
+
+		h.sendAuditEvents(w, r, filter)
+	}
+}
+
+func (h *Handlers) sendAuditEvents(w http.ResponseWriter, r *http.Request, filter *models.AuditFilter) {
+	events, err := h.auditRepo.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		h.log(r).Errorf("Failed to list audit events: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "failed to list audit events")
+		return
+	}
+
+	data := models.NewData()
+	data["events"] = events
+	if len(events) == filter.Limit {
+		data["next_before"] = events[len(events)-1].ID
+	}
+
+	models.SendSuccessJson(w, http.StatusOK, data)
+}
+
+// parseAuditFilter reads query params, error response is sent when false
+func parseAuditFilter(w http.ResponseWriter, r *http.Request) (*models.AuditFilter, bool) {
+	query := r.URL.Query()
+	filter := &models.AuditFilter{
+		Event:    query.Get("event"),
+		FileUUID: query.Get("file_id"),
+	}
+
+	limit, ok := intParam(query.Get("limit"), defaultAuditLimit, 1, maxAuditLimit)
+	if !ok {
+		models.SendErrorJson(w, http.StatusBadRequest, "limit must be between 1 and %d", maxAuditLimit)
+		return nil, false
+	}
+	filter.Limit = limit
+
+	if raw := query.Get("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid before")
+			return nil, false
+		}
+		filter.BeforeID = before
+	}
+
+	if filter.FileUUID != "" && uuid.Validate(filter.FileUUID) != nil {
+		models.SendErrorJson(w, http.StatusBadRequest, "invalid file_id")
+		return nil, false
+	}
+
+	for param, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s must be RFC3339 time", param)
+			return nil, false
+		}
+		*dst = &t
+	}
+
+	return filter, true
+}
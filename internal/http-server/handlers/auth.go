@@ -7,20 +7,28 @@ Good luck to read my bad-written code. <3
 */
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"up-down-server/internal/http-server/ctx"
 	"up-down-server/internal/lib/bcrypthashing"
 	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/clientip"
 	"up-down-server/internal/lib/jwttool"
 	"up-down-server/internal/lib/validinput"
+	"up-down-server/internal/metrics"
 	"up-down-server/internal/models"
 	"up-down-server/internal/models/dto"
 	"up-down-server/internal/repository/postgresql"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 )
 
 var expTimeAccessToken time.Duration = time.Minute * 15
@@ -28,6 +36,14 @@ var expTimeRefreshToken time.Duration = time.Hour * 168
 
 const (
 	AuthorizationHeader = "Authorization"
+
+	// holds id of the only valid refresh token of session
+	refreshFamilyKey = "refresh family:%s"
+
+	// how user proved identity, kept in audit log
+	loginMethodPassword  = "password"
+	loginMethodTwoFactor = "password+2fa"
+	loginMethodOIDC      = "oidc"
 )
 
 func (h *Handlers) LogIn() http.HandlerFunc {
@@ -38,30 +54,75 @@ func (h *Handlers) LogIn() http.HandlerFunc {
 			return
 		}
 
+		ip := clientip.ClientIP(r)
+		if left, err := h.loginGuard.Locked(r.Context(), loginReq.Username, ip); err != nil {
+			h.log(r).Errorf("failed to check login lock: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		} else if left > 0 {
+			tooManyAttempts(w, left)
+			return
+		}
+
 		userId, err := h.userRepo.AuthentificateUser(r.Context(), loginReq.Username, loginReq.Password)
 		if err != nil {
 			switch err.Error() {
-			case postgresql.NotFound:
-				models.SendErrorJson(w, http.StatusUnauthorized, "invalid credentials")
-			case postgresql.UnAuthorized:
+			case postgresql.NotFound, postgresql.UnAuthorized:
+				h.audit.RecordRequest(r, models.AuditLoginFailed, 0, "", map[string]any{"username": loginReq.Username})
+
+				delay, lockedFor, err := h.loginGuard.Failure(r.Context(), loginReq.Username, ip)
+				if err != nil {
+					h.log(r).Errorf("failed to count login failure: %v", err)
+				}
+
+				// slows down guessing without holding lock of any kind
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+
+				if lockedFor > 0 {
+					tooManyAttempts(w, lockedFor)
+					return
+				}
 				models.SendErrorJson(w, http.StatusUnauthorized, "invalid credentials")
+			case postgresql.Disabled:
+				models.SendErrorJson(w, http.StatusForbidden, "account is disabled")
+			default:
+				h.log(r).Errorf("failed to authenticate user: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to authenticate")
 			}
 			return
 		}
 
-		sessionId := uuid.New().String()
-		accessToken := jwttool.GenerateAccessToken(userId, sessionId, expTimeAccessToken)
-		refreshToken := jwttool.GenerateRefreshToken(userId, expTimeRefreshToken)
+		if err := h.loginGuard.Success(r.Context(), loginReq.Username); err != nil {
+			h.log(r).Errorf("failed to reset login failures: %v", err)
+		}
 
-		data := models.NewData()
-		data["access-token"] = accessToken
-		data["refresh-token"] = refreshToken
-		h.logger.Info(data)
+		twoFactor, err := h.twoFactorEnabled(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("failed to check totp: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to check totp")
+			return
+		}
 
-		if err := h.cache.Set(r.Context(), sessionId, true, expTimeAccessToken); err != nil {
-			h.logger.Errorf("failed to set sessionId: %v", sessionId)
-			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
-			return 
+		if twoFactor {
+			data, err := h.startTwoFactorChallenge(r.Context(), userId)
+			if err != nil {
+				h.log(r).Errorf("failed to start 2fa challenge: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+				return
+			}
+
+			models.SendSuccessJson(w, http.StatusOK, data)
+			return
+		}
+
+		data, err := h.startSession(r, userId, loginMethodPassword)
+		if err != nil {
+			h.sendSessionError(w, r, err)
+			return
 		}
 
 		models.SendSuccessJson(w, http.StatusOK, data)
@@ -81,15 +142,25 @@ func (h *Handlers) Register() http.HandlerFunc {
 			return
 		}
 
+		registerReq.Email = strings.ToLower(strings.TrimSpace(registerReq.Email))
+		if registerReq.Email != "" && !validinput.IsValidEmail(registerReq.Email) {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid email")
+			return
+		}
+
 		hashed, err := bcrypthashing.BcryptHashing(registerReq.Password)
 		if err != nil {
-			h.logger.Errorf("Bcrypt error during hashing: %v", err)
+			h.log(r).Errorf("Bcrypt error during hashing: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
-		if err := h.userRepo.RegisterUser(r.Context(), registerReq.Username, hashed); err != nil {
-			h.logger.Errorf("RegisterUser error: %v", err)
+		if err := h.userRepo.RegisterUser(r.Context(), registerReq.Username, hashed, registerReq.Email); err != nil {
+			if err.Error() == postgresql.AlreadyExists {
+				models.SendErrorJson(w, http.StatusConflict, "username or email is already taken")
+				return
+			}
+			h.log(r).Errorf("RegisterUser error: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "failed to register")
 			return
 		}
@@ -106,16 +177,24 @@ func (h *Handlers) LogOut() http.HandlerFunc {
 			return
 		}
 
-		if err := h.cache.Del(r.Context(), session_id); err != nil {
-			h.logger.Errorf("failed to delete session id: %v", err)
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+		if err := h.sessionRepo.RevokeSession(r.Context(), userId, session_id); err != nil && err.Error() != postgresql.NotFound {
+			h.log(r).Errorf("failed to revoke session record: %v", err)
+		}
+
+		if err := h.endSession(r.Context(), session_id); err != nil {
+			h.log(r).Errorf("failed to delete session id: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
 			return
 		}
 
+		h.audit.RecordRequest(r, models.AuditLogout, userId, "", map[string]any{"session_id": session_id})
 		models.SendSuccessJson(w, http.StatusOK, nil)
 	}
 }
 
+// Refresh token is single use: every call rotates it. Presenting already rotated token
+// means it was stolen or replayed, so the whole session (token family) is revoked.
 func (h *Handlers) RefreshTheToken() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get(AuthorizationHeader)
@@ -136,6 +215,11 @@ func (h *Handlers) RefreshTheToken() http.HandlerFunc {
 			return
 		}
 
+		if jwttool.FetchString(claims, "typ") != models.TokenTypeRefresh {
+			models.SendErrorJson(w, http.StatusUnauthorized, "not a refresh token")
+			return
+		}
+
 		userIdAny, ok := claims["user_id"]
 		if !ok {
 			models.SendErrorJson(w, http.StatusUnauthorized, "user_id is missing in refresh token")
@@ -148,19 +232,145 @@ func (h *Handlers) RefreshTheToken() http.HandlerFunc {
 			return
 		}
 
-		sessionId := uuid.New().String()
-		accessToken := jwttool.GenerateAccessToken(userId, sessionId, expTimeAccessToken)
+		sessionId := jwttool.FetchString(claims, "session_id")
+		tokenId := jwttool.FetchString(claims, "jti")
+		if sessionId == "" || tokenId == "" {
+			models.SendErrorJson(w, http.StatusUnauthorized, "session_id or jti missing in refresh token")
+			return
+		}
 
-		data := models.NewData()
-		data["access-token"] = accessToken
-		h.logger.Info(data)
+		newTokenId := uuid.New().String()
+		previous, err := h.cache.Swap(r.Context(), fmt.Sprintf(refreshFamilyKey, sessionId), newTokenId, expTimeRefreshToken)
+		if err == redis.Nil {
+			models.SendErrorJson(w, http.StatusUnauthorized, "session is revoked or expired")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("failed to rotate refresh token: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		if previous != tokenId {
+			h.log(r).WithFields(logrus.Fields{
+				"user_id":    userId,
+				"session_id": sessionId,
+			}).Warn("refresh token reuse detected, revoking session")
+			h.audit.RecordUser(r, models.AuditRefreshReuse, userId, map[string]any{"session_id": sessionId})
+
+			if err := h.sessionRepo.RevokeSession(r.Context(), userId, sessionId); err != nil {
+				h.log(r).Errorf("failed to revoke session record: %v", err)
+			}
+			if err := h.endSession(r.Context(), sessionId); err != nil {
+				h.log(r).Errorf("failed to revoke session: %v", err)
+			}
+
+			models.SendErrorJson(w, http.StatusUnauthorized, "refresh token reuse detected, session revoked")
+			return
+		}
+
+		// role is read on every refresh, so its change reaches tokens within access token lifetime
+		role, err := h.userRepo.GetUserRole(r.Context(), userId)
+		if err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusUnauthorized, "user does not exist")
+				return
+			case postgresql.Disabled:
+				models.SendErrorJson(w, http.StatusForbidden, "account is disabled")
+				return
+			}
+			h.log(r).Errorf("failed to fetch user role: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to fetch user")
+			return
+		}
 
-		if err := h.cache.Set(r.Context(), sessionId, true, expTimeAccessToken); err != nil {
-			h.logger.Errorf("failed to set session id: %v", err)
+		if err := h.cache.Set(r.Context(), sessionId, userId, expTimeAccessToken); err != nil {
+			h.log(r).Errorf("failed to set session id: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
 			return
 		}
 
+		if err := h.sessionRepo.TouchSession(r.Context(), sessionId, clientip.ClientIP(r), time.Now().Add(expTimeRefreshToken)); err != nil {
+			h.log(r).Errorf("failed to touch session: %v", err)
+		}
+
+		h.audit.RecordUser(r, models.AuditRefresh, userId, map[string]any{"session_id": sessionId})
+
+		data := models.NewData()
+		data["access-token"] = jwttool.GenerateAccessToken(userId, sessionId, role, expTimeAccessToken)
+		data["refresh-token"] = jwttool.GenerateRefreshToken(userId, sessionId, newTokenId, expTimeRefreshToken)
+
 		models.SendSuccessJson(w, http.StatusOK, data)
 	}
 }
+
+// tooManyAttempts responds with 429 telling client when to retry
+func tooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	metrics.RateLimitRejections.WithLabelValues(metrics.LimiterLogin).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	models.SendErrorJson(w, http.StatusTooManyRequests, "too many failed attempts, try again later")
+}
+
+// sendSessionError responds to failed startSession
+func (h *Handlers) sendSessionError(w http.ResponseWriter, r *http.Request, err error) {
+	if err.Error() == postgresql.Disabled {
+		models.SendErrorJson(w, http.StatusForbidden, "account is disabled")
+		return
+	}
+
+	h.log(r).Errorf("failed to start session: %v", err)
+	models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+}
+
+// startSession creates session with new refresh token family and issues token pair, method is recorded in audit log
+func (h *Handlers) startSession(r *http.Request, userId int, method string) (models.Data, error) {
+	role, err := h.userRepo.GetUserRole(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionId := uuid.New().String()
+	tokenId := uuid.New().String()
+
+	if err := h.sessionRepo.CreateSession(r.Context(), &models.Session{
+		SessionID: sessionId,
+		UserID:    userId,
+		UserAgent: r.UserAgent(),
+		IP:        clientip.ClientIP(r),
+		ExpiresAt: time.Now().Add(expTimeRefreshToken),
+	}); err != nil {
+		return nil, err
+	}
+
+	// session key holds owner id, so token of other user can not be used with it
+	if err := h.cache.Set(r.Context(), sessionId, userId, expTimeAccessToken); err != nil {
+		return nil, err
+	}
+
+	if err := h.cache.Set(r.Context(), fmt.Sprintf(refreshFamilyKey, sessionId), tokenId, expTimeRefreshToken); err != nil {
+		return nil, err
+	}
+
+	if method == loginMethodOIDC {
+		if err := h.cache.Set(r.Context(), fmt.Sprintf(freshOIDCLoginKey, sessionId), userId, freshLoginTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	h.audit.RecordUser(r, models.AuditLogin, userId, map[string]any{"session_id": sessionId, "method": method})
+
+	data := models.NewData()
+	data["access-token"] = jwttool.GenerateAccessToken(userId, sessionId, role, expTimeAccessToken)
+	data["refresh-token"] = jwttool.GenerateRefreshToken(userId, sessionId, tokenId, expTimeRefreshToken)
+
+	return data, nil
+}
+
+// endSession invalidates access tokens and refresh token family of session
+func (h *Handlers) endSession(ctx context.Context, sessionId string) error {
+	if err := h.cache.Del(ctx, sessionId); err != nil {
+		return err
+	}
+
+	return h.cache.Del(ctx, fmt.Sprintf(refreshFamilyKey, sessionId))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// loginTokens logs user in with password, returns id of new session and its refresh token
+func loginTokens(t *testing.T, h *Handlers, deps *testDeps, username string) (string, string) {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"username": %q, "password": "Passw0rd"}`, username)
+	rec := httptest.NewRecorder()
+	h.LogIn()(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	_, data := decodeResponse(t, rec)
+
+	sessions := deps.sessions.sessions
+	return sessions[len(sessions)-1].SessionID, data["refresh-token"].(string)
+}
+
+func refresh(h *Handlers, refreshToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+	req.Header.Set(AuthorizationHeader, "Bearer "+refreshToken)
+
+	rec := httptest.NewRecorder()
+	h.RefreshTheToken()(rec, req)
+	return rec
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	deps := &testDeps{}
+	h := newTestHandlers(t, deps)
+	deps.users.add("mallory", "Passw0rd", "")
+
+	_, token := loginTokens(t, h, deps, "mallory")
+
+	// every refresh hands out the next token of family, which works in turn
+	for i := 0; i < 3; i++ {
+		rec := refresh(h, token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh %d: expected %d, got %d: %s", i+1, http.StatusOK, rec.Code, rec.Body)
+		}
+		_, data := decodeResponse(t, rec)
+
+		next, _ := data["refresh-token"].(string)
+		if next == "" || next == token {
+			t.Fatalf("refresh %d: token is not rotated", i+1)
+		}
+		if access, _ := data["access-token"].(string); access == "" {
+			t.Fatalf("refresh %d: access token is missing", i+1)
+		}
+		token = next
+	}
+}
+
+func TestRefreshTokenReplayRevokesSession(t *testing.T) {
+	deps := &testDeps{}
+	h := newTestHandlers(t, deps)
+	deps.users.add("niaj", "Passw0rd", "")
+
+	sessionId, stolen := loginTokens(t, h, deps, "niaj")
+
+	rec := refresh(h, stolen)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	_, data := decodeResponse(t, rec)
+	current := data["refresh-token"].(string)
+
+	// already rotated token shows up again, so one of its holders is not the user
+	if rec := refresh(h, stolen); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replay: expected %d, got %d: %s", http.StatusUnauthorized, rec.Code, rec.Body)
+	}
+
+	if !deps.sessions.revoked[sessionId] {
+		t.Error("session record is not revoked on replay")
+	}
+	if _, err := deps.cache.Get(t.Context(), sessionId); err == nil {
+		t.Error("access tokens of session are still accepted after replay")
+	}
+	if rec := refresh(h, current); rec.Code != http.StatusUnauthorized {
+		t.Errorf("latest token of revoked session: expected %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestConcurrentRefreshIssuesOnePair(t *testing.T) {
+	deps := &testDeps{}
+	h := newTestHandlers(t, deps)
+	deps.users.add("olivia", "Passw0rd", "")
+
+	sessionId, token := loginTokens(t, h, deps, "olivia")
+
+	const racers = 8
+	codes := make(chan int, racers)
+	start := make(chan struct{})
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes <- refresh(h, token).Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusUnauthorized:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+
+	// token is swapped atomically, so only one request rotates it and the rest are replays
+	if succeeded != 1 {
+		t.Errorf("expected exactly one refresh to succeed, got %d", succeeded)
+	}
+	if !deps.sessions.revoked[sessionId] {
+		t.Error("session is not revoked after token was used twice")
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// comment line keeps idle stream alive through proxies
+	sseHeartbeat = 25 * time.Second
+	// reconnect delay suggested to EventSource, in milliseconds
+	sseRetry = 5000
+)
+
+// Streams events about own files as Server-Sent Events: file.uploaded, file.deleted, file.renamed,
+// sharelink.created, sharelink.downloaded and file.integrity. Events sent while client was disconnected are not replayed.
+// Credentials are checked again on every heartbeat, stream ends after logout, revocation, account disable or token expiry
+func (h *Handlers) StreamEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		rc := http.NewResponseController(w)
+		// stream lives longer than server write timeout
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			h.log(r).Errorf("Failed to clear write deadline: %v", err)
+		}
+
+		sub := h.events.Subscribe(userId)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx gateway must not buffer the stream
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+		if err := rc.Flush(); err != nil {
+			h.log(r).Errorf("Streaming is not supported: %v", err)
+			return
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				allowed, err := h.streamAllowed(r, userId)
+				if err != nil {
+					h.log(r).Errorf("Failed to check credentials of event stream: %v", err)
+				}
+				if !allowed {
+					return // client reconnects and is refused by auth
+				}
+				fmt.Fprint(w, ": ping\n\n")
+			case event, ok := <-sub.C:
+				if !ok {
+					return // server is shutting down, client reconnects after retry
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					h.log(r).Errorf("Failed to encode event: %v", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamAllowed checks whether credentials stream was opened with are still valid, false on error
+func (h *Handlers) streamAllowed(r *http.Request, userId int) (bool, error) {
+	c := r.Context()
+
+	if exp, ok := c.Value(ctx.CtxTokenExpKey).(time.Time); ok && time.Now().After(exp) {
+		return false, nil
+	}
+
+	// session key is removed on logout, revocation and account disable
+	if sessionId, _ := c.Value(ctx.CtxSessionIDKey).(string); sessionId != "" {
+		owner, err := h.cache.Get(c, sessionId)
+		if err == redis.Nil {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		return fmt.Sprint(owner) == strconv.Itoa(userId), nil
+	}
+
+	var err error
+	if keyId, _ := c.Value(ctx.CtxAPIKeyIDKey).(string); keyId != "" {
+		// disabled owner is reported as error of role lookup
+		_, err = h.apiKeyRepo.GetAPIKey(c, keyId)
+	} else {
+		// client certificate does not change, account may
+		_, err = h.userRepo.GetUserRole(c, userId)
+	}
+
+	if err != nil {
+		if err.Error() == postgresql.NotFound || err.Error() == postgresql.Disabled {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// fileEvent notifies owner of file about change: webhooks subscribed to event and connected clients
+func (h *Handlers) fileEvent(r *http.Request, ownerId int, event string, data map[string]any) {
+	h.webhooks.Dispatch(r.Context(), ownerId, event, data)
+	h.events.Publish(r.Context(), ownerId, event, data)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+)
+
+func TestStreamAllowed(t *testing.T) {
+	h := newTestHandlers(t, &testDeps{})
+	cache := h.cache.(*memCache)
+
+	const userId = 7
+	cache.Set(t.Context(), "live-session", userId, time.Minute)
+	cache.Set(t.Context(), "other-user-session", userId+1, time.Minute)
+
+	stream := func(sessionId string, exp time.Time) *http.Request {
+		r := asSession(httptest.NewRequest(http.MethodGet, "/api/events", nil), userId, sessionId)
+		return ctx.WrapValueIntoRequest(r, ctx.CtxTokenExpKey, exp)
+	}
+
+	cases := []struct {
+		name    string
+		req     *http.Request
+		allowed bool
+	}{
+		{"live session", stream("live-session", time.Now().Add(time.Minute)), true},
+		{"logged out", stream("ended-session", time.Now().Add(time.Minute)), false},
+		{"session of other user", stream("other-user-session", time.Now().Add(time.Minute)), false},
+		{"token expired", stream("live-session", time.Now().Add(-time.Second)), false},
+	}
+
+	for _, tc := range cases {
+		allowed, err := h.streamAllowed(tc.req, userId)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if allowed != tc.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", tc.name, tc.allowed, allowed)
+		}
+	}
+
+	// revocation of live session ends stream on next heartbeat
+	cache.Del(t.Context(), "live-session")
+	if allowed, _ := h.streamAllowed(cases[0].req, userId); allowed {
+		t.Errorf("stream of revoked session is still allowed")
+	}
+}
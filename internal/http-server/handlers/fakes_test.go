@@ -0,0 +1,543 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/config"
+	"up-down-server/internal/health"
+	"up-down-server/internal/lib/bcrypthashing"
+	"up-down-server/internal/lib/jwttool"
+	"up-down-server/internal/loginguard"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+	"up-down-server/internal/sso"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// fakes embed interface they stand for, so method not used by tests panics instead of passing silently
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+type memCache struct {
+	models.Cache
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func newMemCache() *memCache {
+	return &memCache{entries: make(map[string]*cacheEntry)}
+}
+
+func (c *memCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{value: fmt.Sprint(value)}
+	if raw, ok := value.([]byte); ok {
+		entry.value = string(raw)
+	}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+
+	return nil
+}
+
+func (c *memCache) SetNX(ctx context.Context, key string, value any, ttl time.Duration) *redis.BoolCmd {
+	c.mu.Lock()
+	_, exists := c.live(key)
+	c.mu.Unlock()
+
+	if exists {
+		return redis.NewBoolResult(false, nil)
+	}
+
+	return redis.NewBoolResult(true, c.Set(ctx, key, value, ttl))
+}
+
+func (c *memCache) Get(ctx context.Context, key string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.live(key)
+	if !ok {
+		return nil, redis.Nil
+	}
+
+	return entry.value, nil
+}
+
+func (c *memCache) GetDel(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.live(key)
+	if !ok {
+		return "", redis.Nil
+	}
+	delete(c.entries, key)
+
+	return entry.value, nil
+}
+
+func (c *memCache) Swap(ctx context.Context, key string, value any, ttl time.Duration) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.live(key)
+	if !ok {
+		return "", redis.Nil
+	}
+
+	previous := entry.value
+	entry.value = fmt.Sprint(value)
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	return previous, nil
+}
+
+func (c *memCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.live(key)
+	if !ok {
+		entry = &cacheEntry{value: "0", expires: time.Now().Add(ttl)}
+		c.entries[key] = entry
+	}
+
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	entry.value = strconv.FormatInt(n+1, 10)
+
+	return n + 1, nil
+}
+
+func (c *memCache) Del(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	return nil
+}
+
+// expire moves ttl of key to the past, as if time has passed
+func (c *memCache) expire(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.expires = time.Now().Add(-time.Second)
+	}
+}
+
+func (c *memCache) live(key string) (*cacheEntry, bool) {
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+type fakeUser struct {
+	username string
+	password string // bcrypt hash, empty for user provisioned by identity provider
+	email    string
+}
+
+type fakeUsers struct {
+	models.UserRepository
+
+	mu         sync.Mutex
+	users      map[int]*fakeUser
+	identities map[string]int // issuer and subject to user id
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{
+		users:      make(map[int]*fakeUser),
+		identities: make(map[string]int),
+	}
+}
+
+func (u *fakeUsers) add(username, password, email string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	hashed, _ := bcrypthashing.BcryptHashing(password)
+	userId := len(u.users) + 1
+	u.users[userId] = &fakeUser{username: username, password: hashed, email: email}
+
+	return userId
+}
+
+func (u *fakeUsers) AuthentificateUser(ctx context.Context, username, password string) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for userId, user := range u.users {
+		if user.username != username {
+			continue
+		}
+		if user.password == "" || bcrypthashing.ComparePasswordAndHash(password, user.password) != nil {
+			return 0, errors.New(postgresql.UnAuthorized)
+		}
+		return userId, nil
+	}
+
+	return 0, errors.New(postgresql.NotFound)
+}
+
+func (u *fakeUsers) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	userId, ok := u.identities[issuer+" "+subject]
+	if !ok {
+		return 0, errors.New(postgresql.NotFound)
+	}
+
+	return userId, nil
+}
+
+func (u *fakeUsers) ProvisionUser(ctx context.Context, username, issuer, subject string) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, user := range u.users {
+		if user.username == username {
+			return 0, errors.New(postgresql.AlreadyExists)
+		}
+	}
+
+	userId := len(u.users) + 1
+	u.users[userId] = &fakeUser{username: username}
+	u.identities[issuer+" "+subject] = userId
+
+	return userId, nil
+}
+
+func (u *fakeUsers) GetUsername(ctx context.Context, userId int) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userId]
+	if !ok {
+		return "", errors.New(postgresql.NotFound)
+	}
+
+	return user.username, nil
+}
+
+func (u *fakeUsers) VerifyPassword(ctx context.Context, userId int, password string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userId]
+	if !ok {
+		return errors.New(postgresql.NotFound)
+	}
+	if user.password == "" {
+		return errors.New(postgresql.NoPassword)
+	}
+	if bcrypthashing.ComparePasswordAndHash(password, user.password) != nil {
+		return errors.New(postgresql.UnAuthorized)
+	}
+
+	return nil
+}
+
+func (u *fakeUsers) UpdatePassword(ctx context.Context, userId int, hashedPassword string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userId]
+	if !ok {
+		return errors.New(postgresql.NotFound)
+	}
+	user.password = hashedPassword
+
+	return nil
+}
+
+func (u *fakeUsers) FindUserForReset(ctx context.Context, login string) (int, string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for userId, user := range u.users {
+		if (user.username == login || user.email == login) && user.email != "" {
+			return userId, user.email, nil
+		}
+	}
+
+	return 0, "", errors.New(postgresql.NotFound)
+}
+
+func (u *fakeUsers) GetUserRole(ctx context.Context, userId int) (string, error) {
+	return "user", nil
+}
+
+type fakeSessions struct {
+	models.SessionRepository
+
+	mu       sync.Mutex
+	sessions []*models.Session
+	revoked  map[string]bool
+}
+
+func (s *fakeSessions) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+func (s *fakeSessions) RevokeUserSessions(ctx context.Context, userId int, exceptSessionId string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for _, session := range s.sessions {
+		if session.UserID == userId && session.SessionID != exceptSessionId && !s.revoked[session.SessionID] {
+			s.revoked[session.SessionID] = true
+			ids = append(ids, session.SessionID)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s *fakeSessions) RevokeSession(ctx context.Context, userId int, sessionId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.UserID == userId && session.SessionID == sessionId {
+			s.revoked[sessionId] = true
+			return nil
+		}
+	}
+
+	return errors.New(postgresql.NotFound)
+}
+
+func (s *fakeSessions) TouchSession(ctx context.Context, sessionId, ip string, expiresAt time.Time) error {
+	return nil
+}
+
+type fakeTwoFactor struct {
+	models.TwoFactorRepository
+
+	mu       sync.Mutex
+	totp     map[int]*models.TOTP
+	recovery map[int]map[string]bool // hash to used
+}
+
+func newFakeTwoFactor() *fakeTwoFactor {
+	return &fakeTwoFactor{
+		totp:     make(map[int]*models.TOTP),
+		recovery: make(map[int]map[string]bool),
+	}
+}
+
+func (f *fakeTwoFactor) SaveTOTPSecret(ctx context.Context, userId int, secret string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if t, ok := f.totp[userId]; ok && t.Enabled {
+		return errors.New(postgresql.AlreadyExists)
+	}
+	f.totp[userId] = &models.TOTP{UserID: userId, Secret: secret, CreatedAt: time.Now()}
+
+	return nil
+}
+
+func (f *fakeTwoFactor) ReplaceTOTPSecret(ctx context.Context, userId int, previous, replacement string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if t, ok := f.totp[userId]; ok && t.Secret == previous {
+		t.Secret = replacement
+	}
+
+	return nil
+}
+
+func (f *fakeTwoFactor) GetTOTP(ctx context.Context, userId int) (*models.TOTP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.totp[userId]
+	if !ok {
+		return nil, errors.New(postgresql.NotFound)
+	}
+	copied := *t
+
+	return &copied, nil
+}
+
+func (f *fakeTwoFactor) EnableTOTP(ctx context.Context, userId int, recoveryHashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.totp[userId]
+	if !ok || t.Enabled {
+		return errors.New(postgresql.NotFound)
+	}
+	t.Enabled = true
+	f.replaceRecoveryCodes(userId, recoveryHashes)
+
+	return nil
+}
+
+func (f *fakeTwoFactor) DisableTOTP(ctx context.Context, userId int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.totp, userId)
+	delete(f.recovery, userId)
+
+	return nil
+}
+
+func (f *fakeTwoFactor) UseRecoveryCode(ctx context.Context, userId int, hash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	used, ok := f.recovery[userId][hash]
+	if !ok || used {
+		return errors.New(postgresql.NotFound)
+	}
+	f.recovery[userId][hash] = true
+
+	return nil
+}
+
+func (f *fakeTwoFactor) replaceRecoveryCodes(userId int, hashes []string) {
+	f.recovery[userId] = make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		f.recovery[userId][hash] = false
+	}
+}
+
+type fakeFiles struct {
+	models.FileMetaRepository
+
+	mu    sync.Mutex
+	files map[string]*models.FileMetaData
+}
+
+func (f *fakeFiles) GetFileMeta(ctx context.Context, uuidOfFile string) (*models.FileMetaData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[uuidOfFile]
+	if !ok {
+		return nil, errors.New(postgresql.NotFound)
+	}
+	copied := *file
+
+	return &copied, nil
+}
+
+// dirStorage keeps blobs in plain files of dir
+type dirStorage struct {
+	models.FileStorage
+	dir string
+}
+
+func (s dirStorage) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+type fakeAudit struct {
+	models.AuditRepository
+}
+
+func (fakeAudit) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return nil
+}
+
+type testDeps struct {
+	files     *fakeFiles
+	storage   models.FileStorage
+	users     *fakeUsers
+	sessions  *fakeSessions
+	twoFactor *fakeTwoFactor
+	cache     *memCache
+	oidc      *sso.Provider
+	notifier  models.Notifier
+	health    *health.Checker
+	account   config.AccountConfig
+	login     config.LoginConfig
+	kek       string // key encryption key, none by default
+}
+
+func newTestHandlers(t *testing.T, deps *testDeps) *Handlers {
+	t.Helper()
+
+	if err := jwttool.Setup(context.Background(), config.JWTConfig{Algorithm: jwttool.AlgHS256, Secret: "test secret", KeyEncryptionKey: deps.kek}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if deps.users == nil {
+		deps.users = newFakeUsers()
+	}
+	if deps.sessions == nil {
+		deps.sessions = &fakeSessions{revoked: make(map[string]bool)}
+	}
+	if deps.files == nil {
+		deps.files = &fakeFiles{files: make(map[string]*models.FileMetaData)}
+	}
+	if deps.twoFactor == nil {
+		deps.twoFactor = newFakeTwoFactor()
+	}
+	if deps.cache == nil {
+		deps.cache = newMemCache()
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	recorder := audit.NewRecorder(fakeAudit{}, logger)
+	guard := loginguard.NewGuard(deps.cache, deps.login, recorder, logger)
+
+	return NewHTTPHandlers(deps.files, deps.users, nil, deps.sessions, nil, deps.twoFactor, nil, nil, nil, deps.cache, deps.storage, deps.oidc, deps.notifier, guard,
+		recorder, nil, nil, deps.health, deps.account, logger)
+}
+
+// decodeResponse reads json response, data is nil for errors
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) (models.Status, models.Data) {
+	t.Helper()
+
+	var resp models.JsonResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+
+	return resp.Status, resp.Data
+}
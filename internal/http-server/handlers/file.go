@@ -6,72 +6,141 @@ import (
 	"mime"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
+	"time"
 
 	"up-down-server/internal/http-server/ctx"
 	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/checksum"
+	"up-down-server/internal/lib/expiry"
 	"up-down-server/internal/lib/validinput"
+	"up-down-server/internal/metrics"
 	"up-down-server/internal/models"
 	"up-down-server/internal/models/dto"
 	"up-down-server/internal/repository/postgresql"
+	"up-down-server/internal/tracing"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
 	XWWWFormApplication = "application/x-www-form-urlencoded"
-	downloadDir         = "files"
 	maxSizeForFile      = 10 << 20
+
+	// optional file lifetime, accepted as form fields expires_at / expires_in or as headers
+	ExpiresAtHeader = "X-Expires-At"
+	ExpiresInHeader = "X-Expires-In"
 )
 
 // File upload handler with maxSizeForFile of ~100mb, better to request with Form holding file param with file itself
+// Optional Content-MD5, Digest or Repr-Digest headers describe the file content and are verified after writing
+// Optional expires_at (RFC3339) or expires_in (duration) form field or X-Expires-At / X-Expires-In header sets file lifetime
 func (h *Handlers) UploadFile() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := r.ParseMultipartForm(maxSizeForFile)
+		metrics.ActiveUploads.Inc()
+		defer metrics.ActiveUploads.Dec()
+
+		expected, err := checksum.FromHeaders(r.Header)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+
+		// body is read from client here, large file is spooled to temp file
+		_, span := tracing.Start(r.Context(), "upload.ParseMultipartForm")
+		err = r.ParseMultipartForm(maxSizeForFile)
+		tracing.End(span, err)
 		if err != nil {
-			h.logger.Errorf("Parse error: %v", err)
+			h.log(r).Errorf("Parse error: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to parse MultipartForm")
 			return
 		}
 
 		f, handler, err := r.FormFile("file")
 		if err != nil {
-			h.logger.Errorf("FormFile error: %v", err)
+			h.log(r).Errorf("FormFile error: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to parse file from Form")
 			return
 		}
 		defer f.Close()
 
+		expiresAt, err := expiry.Parse(formOrHeader(r, "expires_at", ExpiresAtHeader), formOrHeader(r, "expires_in", ExpiresInHeader), time.Now())
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+
 		uuidOfNewFIle := uuid.New().String()
-		dir := filepath.Join(".", "files")
-		fullPath := filepath.Join(dir, uuidOfNewFIle)
+		fullPath := h.storage.Path(uuidOfNewFIle)
 		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
 
-		metadata := models.NewFileMetaData(uuidOfNewFIle, handler, fullPath, userId)
-		if err := h.fileRepo.InsertFileName(r.Context(), metadata); err != nil {
-			h.logger.Errorf("InsertFileName error: %v", err)
-			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to insert recors")
+		// blob is committed before the record, so record never points to a partial file,
+		// blob left behind by a crash before insert is collected by reconciliation
+		_, span = tracing.Start(r.Context(), "storage.Create", attribute.String("file.id", uuidOfNewFIle))
+		dst, err := h.storage.Create(uuidOfNewFIle)
+		tracing.End(span, err)
+		if err != nil {
+			h.log(r).Errorf("Create error: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to save file")
 			return
 		}
 
-		dst, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE, os.ModePerm)
+		hasher := checksum.NewHasher()
+		_, span = tracing.Start(r.Context(), "storage.Write", attribute.String("file.id", uuidOfNewFIle))
+		written, err := io.Copy(io.MultiWriter(dst, hasher), f)
+		span.SetAttributes(attribute.Int64("file.size", written))
+		tracing.End(span, err)
 		if err != nil {
-			h.logger.Errorf("OpenFile error: %v", err)
-			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to save file")
+			h.log(r).Errorf("Copy error: %v", err)
+			dst.Abort()
+			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to write file")
 			return
 		}
-		defer dst.Close()
 
-		if _, err := io.Copy(dst, f); err != nil {
-			h.logger.Errorf("Copy error: %v", err)
-			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to write file")
+		if err := hasher.Verify(expected); err != nil {
+			dst.Abort()
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
 			return
 		}
 
-		h.logger.Infof("Uploaded file saved as: %s\n", fullPath)
+		// sync and rename, the costly part on slow disk
+		_, span = tracing.Start(r.Context(), "storage.Commit", attribute.String("file.id", uuidOfNewFIle))
+		err = dst.Commit()
+		tracing.End(span, err)
+		if err != nil {
+			h.log(r).Errorf("Commit error: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to save file")
+			return
+		}
+
+		metadata := models.NewFileMetaData(uuidOfNewFIle, handler, fullPath, userId)
+		metadata.SHA256 = hasher.SHA256()
+		metadata.IntegrityStatus = models.IntegrityOK
+		metadata.ExpiresAt = expiresAt
+		if err := h.fileRepo.InsertFileName(r.Context(), metadata); err != nil {
+			h.log(r).Errorf("InsertFileName error: %v", err)
+			h.removeBlob(r, uuidOfNewFIle)
+			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to insert recors")
+			return
+		}
+		metrics.UploadedBytes.Add(float64(written))
+
+		h.log(r).Infof("Uploaded file saved as: %s", fullPath)
+		h.audit.RecordRequest(r, models.AuditFileUpload, userId, uuidOfNewFIle, map[string]any{"filename": metadata.FileName, "size": metadata.Size})
+		h.fileEvent(r, userId, models.WebhookFileUploaded, map[string]any{
+			"file_id":    uuidOfNewFIle,
+			"file_name":  metadata.FileName,
+			"size":       metadata.Size,
+			"sha256":     metadata.SHA256,
+			"expires_at": expiresAt,
+		})
 		resp := models.NewData()
 		resp["file_id"] = uuidOfNewFIle
+		resp["sha256"] = metadata.SHA256
+		if expiresAt != nil {
+			resp["expires_at"] = expiresAt
+		}
 		models.SendSuccessJson(w, http.StatusCreated, resp)
 	}
 }
@@ -94,19 +163,20 @@ func (h *Handlers) DownloadFile() http.HandlerFunc {
 			case postgresql.NotFound:
 				models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			default:
-				h.logger.Errorf("Failed to fetch file metadata: %v", err)
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
 				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
 			}
 			return
 		} else if fileMeta.UserID != reqUserID {
 			models.SendErrorJson(w, http.StatusUnauthorized, "access denied")
+			return
 		}
 
-		if _, err := os.Stat(filepath.Join("./", fileMeta.FilePath)); os.IsNotExist(err) {
+		if _, err := os.Stat(h.storage.Path(fileMeta.FileUUID)); os.IsNotExist(err) {
 			models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			return
 		} else if err != nil {
-			h.logger.Errorf("Failed to stat file: %v", err)
+			h.log(r).Errorf("Failed to stat file: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "server error")
 			return
 		}
@@ -116,23 +186,32 @@ func (h *Handlers) DownloadFile() http.HandlerFunc {
 			mimeType = "application/octet-stream"
 		}
 
+		h.audit.RecordRequest(r, models.AuditFileDownload, fileMeta.UserID, fileMeta.FileUUID, nil)
+
 		w.Header().Set("Content-Type", mimeType)
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileMeta.FileName))
 		w.Header().Set("Content-Transfer-Encoding", "binary") // Optional, helps in some clients
 		w.Header().Set("Cache-Control", "no-cache")           // Optional
 
-		http.ServeFile(w, r, fileMeta.FilePath)
+		h.serveBlob(metrics.CountBody(w, metrics.DownloadedBytes.WithLabelValues(metrics.DownloadOwner)), r, fileMeta)
 	}
 }
 
 // File metadata list as JSON array of FileMetaData
+// Optional repeated "tag" params and "attr" params as key:value narrow the list to files matching all of them
 func (h *Handlers) ListFile() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userIdInt := r.Context().Value(ctx.CtxUserIDKey).(int)
 
-		records, err := h.fileRepo.GetUserRecords(r.Context(), userIdInt)
+		filter, ok := parseFileFilter(r)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid filter, use tag=<tag> and attr=<key>:<value>")
+			return
+		}
+
+		records, err := h.fileRepo.GetUserRecords(r.Context(), userIdInt, filter)
 		if err != nil {
-			h.logger.Errorf("Failed to retrieve records: %v", err)
+			h.log(r).Errorf("Failed to retrieve records: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "Record retrieve error")
 			return
 		}
@@ -160,12 +239,13 @@ func (h *Handlers) DeleteFile() http.HandlerFunc {
 			return
 		}
 
-		if filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid); err != nil {
+		filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid)
+		if err != nil {
 			switch err.Error() {
 			case postgresql.NotFound:
 				models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			default:
-				h.logger.Errorf("Failed to fetch file metadata: %v", err)
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
 				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
 			}
 			return
@@ -175,18 +255,18 @@ func (h *Handlers) DeleteFile() http.HandlerFunc {
 		}
 
 		if err := h.fileRepo.DeleteFileByUUID(r.Context(), fileuuid); err != nil {
-			h.logger.Errorf("Failed to delete record: %v", err)
+			h.log(r).Errorf("Failed to delete record: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to delete record")
 			return
 		}
 
-		pathToFile := path.Join(downloadDir, fileuuid)
-		if err := os.Remove(pathToFile); err != nil {
-			h.logger.Errorf("Failed to delete file: %v", err)
-			models.SendErrorJson(w, http.StatusInternalServerError, "Failed to delete file")
-			return
+		// record is gone, so file is already unreachable, blob that failed to be removed is collected by reconciliation
+		if err := h.removeBlob(r, fileuuid); err != nil {
+			h.log(r).Errorf("Failed to delete file, left for reconciliation: %v", err)
 		}
 
+		h.audit.RecordRequest(r, models.AuditFileDelete, filemeta.UserID, fileuuid, map[string]any{"filename": filemeta.FileName})
+		h.fileEvent(r, filemeta.UserID, models.WebhookFileDeleted, map[string]any{"file_id": fileuuid, "file_name": filemeta.FileName})
 		models.SendSuccessJson(w, http.StatusOK, nil)
 	}
 }
@@ -209,12 +289,13 @@ func (h *Handlers) GetFileMetaData() http.HandlerFunc {
 			case postgresql.NotFound:
 				models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			default:
-				h.logger.Errorf("Failed to fetch file metadata: %v", err)
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
 				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
 			}
 			return
 		} else if filemeta.UserID != reqUserID {
 			models.SendErrorJson(w, http.StatusUnauthorized, "access denied")
+			return
 		}
 
 		data := models.NewData()
@@ -234,12 +315,13 @@ func (h *Handlers) UpdateFileName() http.HandlerFunc {
 			return
 		}
 
-		if filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid); err != nil {
+		filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid)
+		if err != nil {
 			switch err.Error() {
 			case postgresql.NotFound:
 				models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			default:
-				h.logger.Errorf("Failed to fetch file metadata: %v", err)
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
 				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
 			}
 			return
@@ -266,12 +348,98 @@ func (h *Handlers) UpdateFileName() http.HandlerFunc {
 			case postgresql.UnAuthorized:
 				models.SendErrorJson(w, http.StatusUnauthorized, "access denied")
 			default:
-				h.logger.Errorf("Failed to update filename: %v", err)
+				h.log(r).Errorf("Failed to update filename: %v", err)
 				models.SendErrorJson(w, http.StatusInternalServerError, "failed to update filename")
 			}
 			return
 		}
 
+		h.audit.RecordRequest(r, models.AuditFileRename, filemeta.UserID, fileuuid, map[string]any{"from": filemeta.FileName, "to": updateReq.Filename})
+		h.fileEvent(r, filemeta.UserID, models.WebhookFileRenamed, map[string]any{
+			"file_id":            fileuuid,
+			"file_name":          updateReq.Filename,
+			"previous_file_name": filemeta.FileName,
+		})
 		models.SendSuccessJson(w, http.StatusOK, nil)
 	}
-}
\ No newline at end of file
+}
+
+// Expiry update handler, body with expires_at or expires_in sets new lifetime, empty body fields remove expiry
+func (h *Handlers) UpdateFileExpiry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqUserID := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		fileuuid := r.URL.Query().Get("file_id")
+		if fileuuid == "" {
+			models.SendErrorJson(w, http.StatusBadRequest, "file_id is required")
+			return
+		}
+
+		if filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid); err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "file not found")
+			default:
+				h.log(r).Errorf("Failed to fetch file metadata: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
+			}
+			return
+		} else if filemeta.UserID != reqUserID {
+			models.SendErrorJson(w, http.StatusUnauthorized, "access denied")
+			return
+		}
+
+		var updateReq dto.UpdateExpiryRequest
+		if err := bindjson.BindJson(r.Body, &updateReq); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		expiresAt, err := expiry.Parse(updateReq.ExpiresAt, updateReq.ExpiresIn, time.Now())
+		if err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+
+		if err := h.fileRepo.SetExpiry(r.Context(), fileuuid, expiresAt); err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "file not found")
+			default:
+				h.log(r).Errorf("Failed to update expiry: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to update expiry")
+			}
+			return
+		}
+
+		data := models.NewData()
+		data["expires_at"] = expiresAt
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// formOrHeader returns form value, falling back to header
+func formOrHeader(r *http.Request, field, header string) string {
+	if v := r.FormValue(field); v != "" {
+		return v
+	}
+
+	return r.Header.Get(header)
+}
+
+// serveBlob sends file content, span covers reading disk and writing to client.
+// Blob is read where storage keeps it now, like scrub and reconciliation do, path stored at upload may be stale
+func (h *Handlers) serveBlob(w http.ResponseWriter, r *http.Request, file *models.FileMetaData) {
+	_, span := tracing.Start(r.Context(), "storage.Serve", attribute.String("file.id", file.FileUUID), attribute.Int64("file.size", file.Size))
+	defer span.End()
+
+	http.ServeFile(w, r, h.storage.Path(file.FileUUID))
+}
+
+func (h *Handlers) removeBlob(r *http.Request, name string) error {
+	_, span := tracing.Start(r.Context(), "storage.Remove", attribute.String("file.id", name))
+	err := h.storage.Remove(name)
+	tracing.End(span, err)
+
+	return err
+}
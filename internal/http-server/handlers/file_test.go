@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"up-down-server/internal/models"
+)
+
+func TestDownloadReadsBlobThroughStorage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "blob-1"), []byte("content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := &testDeps{storage: dirStorage{dir: dir}}
+	h := newTestHandlers(t, deps)
+
+	// stored path is relative to working directory of older deployment
+	for _, uuid := range []string{"blob-1", "blob-2"} {
+		deps.files.files[uuid] = &models.FileMetaData{FileUUID: uuid, FileName: uuid + ".txt", FilePath: "./files/" + uuid, UserID: 1}
+	}
+
+	download := func(uuid string) *httptest.ResponseRecorder {
+		req := asSession(httptest.NewRequest(http.MethodGet, "/api/download?file_id="+uuid, nil), 1, "session")
+
+		rec := httptest.NewRecorder()
+		h.DownloadFile()(rec, req)
+		return rec
+	}
+
+	if rec := download("blob-1"); rec.Code != http.StatusOK || rec.Body.String() != "content" {
+		t.Fatalf("expected %d with blob content, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if rec := download("blob-2"); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing blob: expected %d, got %d: %s", http.StatusNotFound, rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"up-down-server/internal/health"
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Healthz is liveness probe, it answers while process serves requests and does not touch dependencies,
+// so outage of database does not make orchestrator restart every instance
+func (h *Handlers) Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		models.SendSuccessJson(w, http.StatusOK, models.Data{
+			"status": health.StatusUp,
+			"uptime": health.Uptime().Round(time.Second).String(),
+		})
+	}
+}
+
+// Readyz is readiness probe, 503 when any dependency is down. Publicly only up or down of every dependency is told,
+// errors, timings and details are logged and returned to requests carrying detailsToken as Bearer, when it is set
+func (h *Handlers) Readyz(detailsToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ready, checks := h.health.Run(r.Context())
+
+		data := models.Data{"checks": checks}
+		if !detailed(r, detailsToken) {
+			statuses := make(map[string]string, len(checks))
+			for name, result := range checks {
+				statuses[name] = result.Status
+			}
+			data["checks"] = statuses
+		}
+
+		if ready {
+			data["status"] = health.StatusUp
+			models.SendSuccessJson(w, http.StatusOK, data)
+			return
+		}
+
+		for name, result := range checks {
+			if result.Status != health.StatusUp {
+				h.log(r).WithFields(logrus.Fields{"dependency": name, "details": result.Details}).Warnf("Readiness check failed: %s", result.Error)
+			}
+		}
+
+		data["status"] = health.StatusDown
+		w.Header().Set(models.ContentType, models.AppJson)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(models.NewJsonResponse(models.StatusError("service is not ready"), data))
+	}
+}
+
+// detailed reports whether request carries token, empty token shows details to nobody
+func detailed(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get(AuthorizationHeader), "Bearer ")
+	return token != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
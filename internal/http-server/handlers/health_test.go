@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"up-down-server/internal/health"
+)
+
+func TestReadyzHidesDetails(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) (map[string]any, error) {
+		return map[string]any{"open_connections": 3}, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+
+	h := newTestHandlers(t, &testDeps{health: checker})
+	readyz := h.Readyz("metrics token")
+
+	probe := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		if authorization != "" {
+			req.Header.Set(AuthorizationHeader, authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		readyz(rec, req)
+		return rec
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong token"} {
+		rec := probe(authorization)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected %d, got %d: %s", http.StatusServiceUnavailable, rec.Code, rec.Body)
+		}
+		if body := rec.Body.String(); strings.Contains(body, "10.0.0.5") || strings.Contains(body, "open_connections") {
+			t.Errorf("authorization %q: details of dependency are public: %s", authorization, body)
+		}
+		if _, data := decodeResponse(t, rec); data["checks"].(map[string]any)["database"] != health.StatusDown {
+			t.Errorf("authorization %q: database is not reported down: %v", authorization, data)
+		}
+	}
+
+	if body := probe("Bearer metrics token").Body.String(); !strings.Contains(body, "10.0.0.5") {
+		t.Errorf("details are not shown with metrics token: %s", body)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"up-down-server/internal/models"
+)
+
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 500
+)
+
+// Background jobs status: counts per kind and status, recurring schedules and latest jobs.
+// Optional params "status" to filter jobs and "limit" for their count
+func (h *Handlers) ListJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+
+		limit := defaultJobsLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 || parsed > maxJobsLimit {
+				models.SendErrorJson(w, http.StatusBadRequest, "limit must be between 1 and %d", maxJobsLimit)
+				return
+			}
+			limit = parsed
+		}
+
+		stats, err := h.jobRepo.JobStats(r.Context())
+		if err != nil {
+			h.log(r).Errorf("Failed to get job stats: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to get job stats")
+			return
+		}
+
+		schedules, err := h.jobRepo.ListSchedules(r.Context())
+		if err != nil {
+			h.log(r).Errorf("Failed to list schedules: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list schedules")
+			return
+		}
+
+		jobs, err := h.jobRepo.ListJobs(r.Context(), status, limit)
+		if err != nil {
+			h.log(r).Errorf("Failed to list jobs: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list jobs")
+			return
+		}
+
+		data := models.NewData()
+		data["stats"] = stats
+		data["schedules"] = schedules
+		data["jobs"] = jobs
+
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
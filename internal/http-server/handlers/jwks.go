@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"up-down-server/internal/lib/jwttool"
+)
+
+// JWKS publishes public keys of access and refresh tokens, so other services can verify them.
+// Response is a plain JWK Set (RFC 7517) instead of usual envelope
+func (h *Handlers) JWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// short, verifiers refetch on unknown kid anyway
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(jwttool.JWKS()); err != nil {
+			h.log(r).Errorf("Failed to write jwks: %v", err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/validinput"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+	"up-down-server/internal/repository/postgresql"
+)
+
+const (
+	maxTagsPerFile       = 32
+	maxAttributesPerFile = 32
+)
+
+// Tags add handler, "file_id" param and JSON body with tags array
+func (h *Handlers) AddTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileuuid, ok := h.ownedFileID(w, r)
+		if !ok {
+			return
+		}
+
+		var tagsReq dto.TagsRequest
+		if err := bindjson.BindJson(r.Body, &tagsReq); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		tags, ok := normalizeTags(tagsReq.Tags)
+		if !ok || len(tags) == 0 {
+			models.SendErrorJson(w, http.StatusBadRequest, "tags must be 1-%d chars of letters, digits, '_', '.', ':' or '-'", validinput.MaxTagLength)
+			return
+		}
+
+		if err := h.fileRepo.AddTags(r.Context(), fileuuid, tags, maxTagsPerFile); err != nil {
+			h.sendLabelError(w, r, err, "failed to add tags", maxTagsPerFile)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Tags remove handler, "file_id" param and one or more "tag" params
+func (h *Handlers) RemoveTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileuuid, ok := h.ownedFileID(w, r)
+		if !ok {
+			return
+		}
+
+		tags, ok := normalizeTags(r.URL.Query()["tag"])
+		if !ok || len(tags) == 0 {
+			models.SendErrorJson(w, http.StatusBadRequest, "tag is required")
+			return
+		}
+
+		if err := h.fileRepo.RemoveTags(r.Context(), fileuuid, tags); err != nil {
+			h.sendLabelError(w, r, err, "failed to remove tags", maxTagsPerFile)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Attributes set handler, "file_id" param and JSON body with attributes object, existing keys are overwritten
+func (h *Handlers) SetAttributes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileuuid, ok := h.ownedFileID(w, r)
+		if !ok {
+			return
+		}
+
+		var attrReq dto.AttributesRequest
+		if err := bindjson.BindJson(r.Body, &attrReq); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		if len(attrReq.Attributes) == 0 {
+			models.SendErrorJson(w, http.StatusBadRequest, "attributes are required")
+			return
+		}
+
+		for key, value := range attrReq.Attributes {
+			if !validinput.IsValidAttributeKey(key) || !validinput.IsValidAttributeValue(value) {
+				models.SendErrorJson(w, http.StatusBadRequest, "attribute keys must be 1-%d chars of letters, digits, '_', '.' or '-', values at most %d bytes", validinput.MaxAttributeKeyLength, validinput.MaxAttributeValueLength)
+				return
+			}
+		}
+
+		if err := h.fileRepo.SetAttributes(r.Context(), fileuuid, attrReq.Attributes, maxAttributesPerFile); err != nil {
+			h.sendLabelError(w, r, err, "failed to set attributes", maxAttributesPerFile)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Attributes remove handler, "file_id" param and one or more "key" params
+func (h *Handlers) RemoveAttributes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileuuid, ok := h.ownedFileID(w, r)
+		if !ok {
+			return
+		}
+
+		keys := r.URL.Query()["key"]
+		if len(keys) == 0 {
+			models.SendErrorJson(w, http.StatusBadRequest, "key is required")
+			return
+		}
+
+		if err := h.fileRepo.RemoveAttributes(r.Context(), fileuuid, keys); err != nil {
+			h.sendLabelError(w, r, err, "failed to remove attributes", maxAttributesPerFile)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// ownedFileID reads "file_id" param and checks that file belongs to requesting user, error response is sent when false
+func (h *Handlers) ownedFileID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	reqUserID := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+	fileuuid := r.URL.Query().Get("file_id")
+	if fileuuid == "" {
+		models.SendErrorJson(w, http.StatusBadRequest, "file_id is required")
+		return "", false
+	}
+
+	filemeta, err := h.fileRepo.GetFileMeta(r.Context(), fileuuid)
+	if err != nil {
+		switch err.Error() {
+		case postgresql.NotFound:
+			models.SendErrorJson(w, http.StatusNotFound, "file not found")
+		default:
+			h.log(r).Errorf("Failed to fetch file metadata: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to retrieve metadata")
+		}
+		return "", false
+	}
+
+	if filemeta.UserID != reqUserID {
+		models.SendErrorJson(w, http.StatusUnauthorized, "access denied")
+		return "", false
+	}
+
+	return fileuuid, true
+}
+
+func (h *Handlers) sendLabelError(w http.ResponseWriter, r *http.Request, err error, msg string, limit int) {
+	switch err.Error() {
+	case postgresql.LimitExceeded:
+		models.SendErrorJson(w, http.StatusBadRequest, "at most %d per file", limit)
+	default:
+		h.log(r).Errorf("%s: %v", msg, err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "%s", msg)
+	}
+}
+
+// normalizeTags trims, lowercases and dedupes tags, false when any tag is invalid
+func normalizeTags(raw []string) ([]string, bool) {
+	seen := make(map[string]struct{}, len(raw))
+	tags := make([]string, 0, len(raw))
+
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !validinput.IsValidTag(tag) {
+			return nil, false
+		}
+
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags, true
+}
+
+// parseFileFilter reads repeated "tag" params and "attr" params in key:value form
+func parseFileFilter(r *http.Request) (*models.FileFilter, bool) {
+	query := r.URL.Query()
+	if len(query["tag"]) == 0 && len(query["attr"]) == 0 {
+		return nil, true
+	}
+
+	tags, ok := normalizeTags(query["tag"])
+	if !ok {
+		return nil, false
+	}
+
+	filter := &models.FileFilter{
+		Tags:       tags,
+		Attributes: make(map[string]string),
+	}
+
+	for _, attr := range query["attr"] {
+		key, value, found := strings.Cut(attr, ":")
+		if !found || !validinput.IsValidAttributeKey(key) {
+			return nil, false
+		}
+		filter.Attributes[key] = value
+	}
+
+	return filter, true
+}
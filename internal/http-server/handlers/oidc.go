@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"up-down-server/internal/models"
+	"up-down-server/internal/sso"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// holds sso.Pending of login started with given state
+	oidcStateKey    = "oidc state:%s"
+	oidcStateCookie = "oidc_state"
+)
+
+// Redirects to identity provider, state is also set as cookie so callback can be finished only by the same browser
+func (h *Handlers) OIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authURL, state, pending, err := h.oidc.Begin(r.Context())
+		if err != nil {
+			h.log(r).Errorf("Failed to start oidc login: %v", err)
+			models.SendErrorJson(w, http.StatusBadGateway, "identity provider is unavailable")
+			return
+		}
+
+		raw, err := json.Marshal(pending)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to start login")
+			return
+		}
+
+		if err := h.cache.Set(r.Context(), fmt.Sprintf(oidcStateKey, state), raw, h.oidc.StateTTL()); err != nil {
+			h.log(r).Errorf("failed to save oidc state: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/api/oidc",
+			MaxAge:   int(h.oidc.StateTTL().Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// Provider redirects back here with code, response carries the same token pair as LogIn
+func (h *Handlers) OIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			models.SendErrorJson(w, http.StatusUnauthorized, "identity provider refused login: %s %s", providerErr, query.Get("error_description"))
+			return
+		}
+
+		state, code := query.Get("state"), query.Get("code")
+		if state == "" || code == "" {
+			models.SendErrorJson(w, http.StatusBadRequest, "state and code are required")
+			return
+		}
+
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || cookie.Value != state {
+			models.SendErrorJson(w, http.StatusBadRequest, "state does not match login started by this browser")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/oidc", MaxAge: -1})
+
+		// state is consumed at once, so callback can not be replayed
+		raw, err := h.cache.GetDel(r.Context(), fmt.Sprintf(oidcStateKey, state))
+		if err == redis.Nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "login attempt is expired or unknown")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("failed to read oidc state: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		var pending sso.Pending
+		if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "login attempt is corrupted")
+			return
+		}
+
+		identity, err := h.oidc.Finish(r.Context(), code, &pending)
+		if err != nil {
+			h.log(r).Warnf("oidc login rejected: %v", err)
+			models.SendErrorJson(w, http.StatusUnauthorized, "failed to verify identity")
+			return
+		}
+
+		userId, err := h.oidc.ResolveUser(r.Context(), h.userRepo, identity)
+		if err != nil {
+			if err.Error() == sso.NotLinked {
+				models.SendErrorJson(w, http.StatusForbidden, "no account is linked to this identity")
+				return
+			}
+			h.log(r).Errorf("failed to resolve oidc user: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to resolve user")
+			return
+		}
+
+		data, err := h.startSession(r, userId, loginMethodOIDC)
+		if err != nil {
+			h.sendSessionError(w, r, err)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/sso"
+	"up-down-server/internal/sso/ssotest"
+)
+
+const testClientID = "filedump"
+
+func newOIDCTest(t *testing.T) (*Handlers, *testDeps, *ssotest.Provider) {
+	t.Helper()
+
+	provider, err := ssotest.NewProvider(testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	deps := &testDeps{
+		oidc: sso.NewProvider(config.OIDCConfig{
+			Issuer:        provider.Issuer(),
+			ClientID:      testClientID,
+			RedirectURL:   "http://localhost/api/oidc/callback",
+			UsernameClaim: "preferred_username",
+			AutoProvision: true,
+		}),
+	}
+
+	return newTestHandlers(t, deps), deps, provider
+}
+
+// startOIDCLogin returns url of provider browser is sent to and state cookie set for callback
+func startOIDCLogin(t *testing.T, h *Handlers) (string, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.OIDCLogin()(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: expected %d, got %d: %s", http.StatusFound, rec.Code, rec.Body)
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return rec.Header().Get("Location"), cookie
+		}
+	}
+
+	t.Fatal("login: state cookie is not set")
+	return "", nil
+}
+
+func oidcCallback(h *Handlers, state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	h.OIDCCallback()(rec, req)
+	return rec
+}
+
+// loginThroughProvider goes through the whole login as subject, fails test unless token pair is issued
+func loginThroughProvider(t *testing.T, h *Handlers, provider *ssotest.Provider, subject string, claims map[string]any) {
+	t.Helper()
+
+	authURL, cookie := startOIDCLogin(t, h)
+	state, code, err := provider.Authorize(authURL, subject, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := oidcCallback(h, state, code, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	_, data := decodeResponse(t, rec)
+	if data["access-token"] == "" || data["access-token"] == nil || data["refresh-token"] == nil {
+		t.Fatalf("token pair is missing in response: %v", data)
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	h, deps, provider := newOIDCTest(t)
+
+	authURL, cookie := startOIDCLogin(t, h)
+	state, code, err := provider.Authorize(authURL, "subject-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// state of login started in another browser
+	_, otherCookie := startOIDCLogin(t, h)
+
+	for name, c := range map[string]*http.Cookie{"no cookie": nil, "other browser": otherCookie} {
+		rec := oidcCallback(h, state, code, c)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d: %s", name, http.StatusBadRequest, rec.Code, rec.Body)
+		}
+	}
+
+	if len(deps.sessions.sessions) != 0 {
+		t.Errorf("session was started on state mismatch")
+	}
+
+	// rejected callbacks do not consume state of the real login
+	if rec := oidcCallback(h, state, code, cookie); rec.Code != http.StatusOK {
+		t.Errorf("matching state: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+}
+
+func TestOIDCCallbackNonceMismatch(t *testing.T) {
+	h, deps, provider := newOIDCTest(t)
+
+	authURL, cookie := startOIDCLogin(t, h)
+	state, code, err := provider.Authorize(authURL, "subject-1", map[string]any{"nonce": "forged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := oidcCallback(h, state, code, cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d: %s", http.StatusUnauthorized, rec.Code, rec.Body)
+	}
+
+	if len(deps.users.users) != 0 || len(deps.sessions.sessions) != 0 {
+		t.Errorf("user or session was created for token with wrong nonce")
+	}
+
+	// state is consumed by failed attempt, so the same callback can not be retried
+	if rec := oidcCallback(h, state, code, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("replay: expected %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body)
+	}
+}
+
+func TestOIDCCallbackProvisionThenLinkedLogin(t *testing.T) {
+	h, deps, provider := newOIDCTest(t)
+	claims := map[string]any{"preferred_username": "alice", "email": "alice@example.com", "email_verified": true}
+
+	loginThroughProvider(t, h, provider, "subject-alice", claims)
+
+	if len(deps.users.users) != 1 {
+		t.Fatalf("first login: expected 1 provisioned user, got %d", len(deps.users.users))
+	}
+	userId, err := deps.users.GetUserIDByIdentity(t.Context(), provider.Issuer(), "subject-alice")
+	if err != nil {
+		t.Fatalf("first login: identity is not linked: %v", err)
+	}
+	if name := deps.users.users[userId].username; name != "alice" {
+		t.Errorf("first login: expected username alice, got %s", name)
+	}
+
+	loginThroughProvider(t, h, provider, "subject-alice", claims)
+
+	if len(deps.users.users) != 1 {
+		t.Fatalf("second login: expected linked user to be reused, got %d users", len(deps.users.users))
+	}
+	if len(deps.sessions.sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(deps.sessions.sessions))
+	}
+	for _, session := range deps.sessions.sessions {
+		if session.UserID != userId {
+			t.Errorf("session %s belongs to user %d, expected %d", session.SessionID, session.UserID, userId)
+		}
+	}
+}
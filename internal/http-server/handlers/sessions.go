@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+)
+
+// Active sessions of user, the one used by request is marked as current
+func (h *Handlers) ListSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+		currentSessionId, _ := r.Context().Value(ctx.CtxSessionIDKey).(string)
+
+		sessions, err := h.sessionRepo.ListUserSessions(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to list sessions: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list sessions")
+			return
+		}
+
+		for _, session := range sessions {
+			session.Current = session.SessionID == currentSessionId
+		}
+
+		data := models.NewData()
+		data["sessions"] = sessions
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Revokes single session of user by its id in path
+func (h *Handlers) RevokeSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		sessionId := r.PathValue("id")
+		if uuid.Validate(sessionId) != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid session id")
+			return
+		}
+
+		if err := h.sessionRepo.RevokeSession(r.Context(), userId, sessionId); err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "session not found")
+			default:
+				h.log(r).Errorf("Failed to revoke session: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to revoke session")
+			}
+			return
+		}
+
+		if err := h.endSession(r.Context(), sessionId); err != nil {
+			h.log(r).Errorf("Failed to delete session from cache: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Log out everywhere, with "keep_current=true" param the session of request stays active
+func (h *Handlers) RevokeAllSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		var except string
+		if r.URL.Query().Get("keep_current") == "true" {
+			except, _ = r.Context().Value(ctx.CtxSessionIDKey).(string)
+		}
+
+		revoked, err := h.revokeUserSessions(r, userId, except)
+		if err != nil {
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to revoke sessions")
+			return
+		}
+
+		data := models.NewData()
+		data["revoked"] = revoked
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// revokeUserSessions ends every session of user except given one and returns their count
+func (h *Handlers) revokeUserSessions(r *http.Request, userId int, exceptSessionId string) (int, error) {
+	ids, err := h.sessionRepo.RevokeUserSessions(r.Context(), userId, exceptSessionId)
+	if err != nil {
+		h.log(r).Errorf("Failed to revoke sessions: %v", err)
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := h.endSession(r.Context(), id); err != nil {
+			h.log(r).Errorf("Failed to delete session %s from cache: %v", id, err)
+			return 0, err
+		}
+	}
+
+	return len(ids), nil
+}
@@ -7,9 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 	"up-down-server/internal/http-server/ctx"
 	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/clientip"
 	"up-down-server/internal/lib/linkgeneration"
+	"up-down-server/internal/metrics"
 	"up-down-server/internal/models"
 	"up-down-server/internal/models/dto"
 	"up-down-server/internal/repository/postgresql"
@@ -33,7 +36,7 @@ func (h *Handlers) CreateShareLink() http.HandlerFunc {
 		filemeta, err := h.fileRepo.GetFileMeta(r.Context(), slr.FileUUID)
 		if err != nil {
 			if err.Error() != postgresql.NotFound {
-				h.logger.WithError(err).Error("failed to get filemeta data")
+				h.log(r).WithError(err).Error("failed to get filemeta data")
 			}
 			models.SendErrorJson(w, http.StatusInternalServerError, "failed to get filemeta data")
 			return
@@ -44,13 +47,20 @@ func (h *Handlers) CreateShareLink() http.HandlerFunc {
 			return
 		}
 
+		// link never outlives the file
+		if filemeta.ExpiresAt != nil {
+			if untilExpiry := time.Until(*filemeta.ExpiresAt); slr.Duration > untilExpiry {
+				slr.Duration = untilExpiry
+			}
+		}
+
 		link, err := linkgeneration.GenerateRandomLink(slr.FileUUID, slr.Duration)
 		if err != nil {
 			switch err.Error() {
 			case linkgeneration.InvalidInput, linkgeneration.WayTooLong:
 				models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
 			default:
-				h.logger.WithError(err).Error("internal error during link generation")
+				h.log(r).WithError(err).Error("internal error during link generation")
 				models.SendErrorJson(w, http.StatusInternalServerError, "internal error")
 			}
 
@@ -61,7 +71,7 @@ func (h *Handlers) CreateShareLink() http.HandlerFunc {
 
 		set := h.cache.SetNX(r.Context(), key, slr.FileUUID, slr.Duration)
 		if set.Err() != nil {
-			h.logger.WithError(set.Err()).Error("cache error during share link creation")
+			h.log(r).WithError(set.Err()).Error("cache error during share link creation")
 			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
 			return
 		}
@@ -70,8 +80,17 @@ func (h *Handlers) CreateShareLink() http.HandlerFunc {
 			return
 		}
 
+		h.audit.RecordRequest(r, models.AuditShareLinkCreate, filemeta.UserID, slr.FileUUID, map[string]any{"ttl": slr.Duration.String()})
+		// link itself is not sent, it is a credential
+		h.fileEvent(r, filemeta.UserID, models.WebhookShareLinkCreated, map[string]any{
+			"file_id":    slr.FileUUID,
+			"file_name":  filemeta.FileName,
+			"expires_at": time.Now().Add(slr.Duration).UTC(),
+		})
+
 		data := models.NewData()
 		data["link"] = link
+		data["ttl"] = slr.Duration
 
 		models.SendSuccessJson(w, http.StatusOK, data)
 	}
@@ -84,7 +103,6 @@ func (h *Handlers) DownloadFileViaSharedLink() http.HandlerFunc {
 			return
 		}
 		hash := strings.TrimPrefix(r.URL.Path, prefix)
-		h.logger.Info("link", hash)
 
 		var fileuuid string
 		if fileuuidAny, err := h.cache.Get(r.Context(), fmt.Sprintf(shareLinkKey, hash)); err != nil {
@@ -111,11 +129,11 @@ func (h *Handlers) DownloadFileViaSharedLink() http.HandlerFunc {
 			return
 		}
 
-		if _, err := os.Stat(filepath.Join("./", filemeta.FilePath)); os.IsNotExist(err) {
+		if _, err := os.Stat(h.storage.Path(filemeta.FileUUID)); os.IsNotExist(err) {
 			models.SendErrorJson(w, http.StatusNotFound, "file not found")
 			return
 		} else if err != nil {
-			h.logger.Errorf("Failed to stat file: %v", err)
+			h.log(r).Errorf("Failed to stat file: %v", err)
 			models.SendErrorJson(w, http.StatusInternalServerError, "server error")
 			return
 		}
@@ -125,11 +143,28 @@ func (h *Handlers) DownloadFileViaSharedLink() http.HandlerFunc {
 			mimeType = "application/octet-stream"
 		}
 
+		// link itself is a credential, only its prefix is kept
+		h.audit.RecordRequest(r, models.AuditFileDownloadShared, filemeta.UserID, fileuuid, map[string]any{"link": linkPrefix(hash)})
+		h.fileEvent(r, filemeta.UserID, models.WebhookShareLinkDownloaded, map[string]any{
+			"file_id":   fileuuid,
+			"file_name": filemeta.FileName,
+			"ip":        clientip.ClientIP(r),
+		})
+
 		w.Header().Set("Content-Type", mimeType)
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filemeta.FileName))
 		w.Header().Set("Content-Transfer-Encoding", "binary") // Optional, helps in some clients
 		w.Header().Set("Cache-Control", "no-cache")           // Optional
 
-		http.ServeFile(w, r, filemeta.FilePath)
+		h.serveBlob(metrics.CountBody(w, metrics.DownloadedBytes.WithLabelValues(metrics.DownloadShared)), r, filemeta)
 	}
 }
+
+// linkPrefix identifies share link in audit log without revealing it
+func linkPrefix(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8] + "..."
+	}
+
+	return hash
+}
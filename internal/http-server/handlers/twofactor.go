@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/lib/jwttool"
+	"up-down-server/internal/lib/twofactor"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// holds id of user who passed password check and has to provide second factor
+	twoFactorChallengeKey = "2fa challenge:%s"
+	twoFactorAttemptsKey  = "2fa attempts:%s"
+	// wrong codes given to confirm sensitive change, limited per user the same way as per challenge
+	twoFactorReauthAttemptsKey = "2fa reauth attempts:%d"
+	// marks accepted code, so it can not be replayed within its validity window
+	totpUsedKey = "totp used:%d:%s"
+
+	twoFactorChallengeTTL = 5 * time.Minute
+	maxTwoFactorAttempts  = 5
+)
+
+// Starts TOTP enrolment, returns secret, otpauth uri and QR code as base64 PNG. Not enforced until confirmed
+func (h *Handlers) EnrollTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		username, err := h.userRepo.GetUsername(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to fetch username: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to fetch user")
+			return
+		}
+
+		secret, uri, qrPNG, err := twofactor.NewKey(username)
+		if err != nil {
+			h.log(r).Errorf("Failed to generate totp key: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to generate totp key")
+			return
+		}
+
+		sealed, err := jwttool.SealString(totpSecretID(userId), secret)
+		if errors.Is(err, jwttool.ErrNoKEK) {
+			h.log(r).Warnf("TOTP enrolment refused: %v", err)
+			models.SendErrorJson(w, http.StatusServiceUnavailable, "two-factor authentication is not available")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("Failed to encrypt totp secret: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to save totp secret")
+			return
+		}
+
+		if err := h.twoFactorRepo.SaveTOTPSecret(r.Context(), userId, sealed); err != nil {
+			switch err.Error() {
+			case postgresql.AlreadyExists:
+				models.SendErrorJson(w, http.StatusConflict, "totp is already enabled")
+			default:
+				h.log(r).Errorf("Failed to save totp secret: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to save totp secret")
+			}
+			return
+		}
+
+		data := models.NewData()
+		data["secret"] = secret
+		data["otpauth_uri"] = uri
+		data["qr_png"] = base64.StdEncoding.EncodeToString(qrPNG)
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Confirms enrolment with the first code from authenticator, returns recovery codes once
+func (h *Handlers) ConfirmTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		var req dto.SecondFactorRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		enrolment, err := h.openTOTP(r.Context(), userId)
+		if err != nil {
+			switch err.Error() {
+			case postgresql.NotFound:
+				models.SendErrorJson(w, http.StatusNotFound, "totp enrolment is not started")
+			default:
+				h.log(r).Errorf("Failed to fetch totp: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to fetch totp")
+			}
+			return
+		}
+
+		if enrolment.Enabled {
+			models.SendErrorJson(w, http.StatusConflict, "totp is already enabled")
+			return
+		}
+
+		if !twofactor.Validate(req.Code, enrolment.Secret) {
+			models.SendErrorJson(w, http.StatusUnauthorized, "invalid code")
+			return
+		}
+
+		codes, hashes, err := twofactor.RecoveryCodes()
+		if err != nil {
+			h.log(r).Errorf("Failed to generate recovery codes: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to generate recovery codes")
+			return
+		}
+
+		if err := h.twoFactorRepo.EnableTOTP(r.Context(), userId, hashes); err != nil {
+			h.log(r).Errorf("Failed to enable totp: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to enable totp")
+			return
+		}
+
+		data := models.NewData()
+		data["recovery_codes"] = codes
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Whether TOTP is enabled and how many recovery codes are left
+func (h *Handlers) TwoFactorStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		enabled, err := h.twoFactorEnabled(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to fetch totp: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to fetch totp")
+			return
+		}
+
+		data := models.NewData()
+		data["totp_enabled"] = enabled
+
+		if enabled {
+			left, err := h.twoFactorRepo.CountRecoveryCodes(r.Context(), userId)
+			if err != nil {
+				h.log(r).Errorf("Failed to count recovery codes: %v", err)
+				models.SendErrorJson(w, http.StatusInternalServerError, "failed to count recovery codes")
+				return
+			}
+			data["recovery_codes_left"] = left
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Turns TOTP off or cancels unconfirmed enrolment, requires password and current second factor
+func (h *Handlers) DisableTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := h.reauthenticate(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.twoFactorRepo.DisableTOTP(r.Context(), userId); err != nil {
+			h.log(r).Errorf("Failed to disable totp: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to disable totp")
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Replaces recovery codes with new ones, requires password and current second factor
+func (h *Handlers) RegenerateRecoveryCodes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := h.reauthenticate(w, r)
+		if !ok {
+			return
+		}
+
+		if enabled, err := h.twoFactorEnabled(r.Context(), userId); err != nil {
+			h.log(r).Errorf("Failed to check totp: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to check totp")
+			return
+		} else if !enabled {
+			models.SendErrorJson(w, http.StatusConflict, "totp is not enabled")
+			return
+		}
+
+		codes, hashes, err := twofactor.RecoveryCodes()
+		if err != nil {
+			h.log(r).Errorf("Failed to generate recovery codes: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to generate recovery codes")
+			return
+		}
+
+		if err := h.twoFactorRepo.ReplaceRecoveryCodes(r.Context(), userId, hashes); err != nil {
+			h.log(r).Errorf("Failed to save recovery codes: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to save recovery codes")
+			return
+		}
+
+		data := models.NewData()
+		data["recovery_codes"] = codes
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Second step of login for users with TOTP, challenge is given by LogIn after password check
+func (h *Handlers) LogInSecondFactor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req dto.LoginSecondFactorRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		if uuid.Validate(req.Challenge) != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid challenge")
+			return
+		}
+
+		challengeKey := fmt.Sprintf(twoFactorChallengeKey, req.Challenge)
+		value, err := h.cache.Get(r.Context(), challengeKey)
+		if err == redis.Nil {
+			models.SendErrorJson(w, http.StatusUnauthorized, "login attempt is expired, log in again")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("failed to read 2fa challenge: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		userId, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil {
+			models.SendErrorJson(w, http.StatusUnauthorized, "login attempt is corrupted, log in again")
+			return
+		}
+
+		// challenge is burnt after few wrong codes, so codes can not be brute forced within its lifetime
+		attempts, err := h.cache.Incr(r.Context(), fmt.Sprintf(twoFactorAttemptsKey, req.Challenge), twoFactorChallengeTTL)
+		if err != nil {
+			h.log(r).Errorf("failed to count 2fa attempts: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		if attempts > maxTwoFactorAttempts {
+			h.cache.Del(r.Context(), challengeKey)
+			models.SendErrorJson(w, http.StatusUnauthorized, "too many attempts, log in again")
+			return
+		}
+
+		ok, err := h.verifySecondFactor(r.Context(), userId, req.SecondFactorRequest)
+		if err != nil {
+			h.log(r).Errorf("failed to verify second factor: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to verify code")
+			return
+		} else if !ok {
+			models.SendErrorJson(w, http.StatusUnauthorized, "invalid code")
+			return
+		}
+
+		// only one request may turn challenge into session
+		if _, err := h.cache.GetDel(r.Context(), challengeKey); err == redis.Nil {
+			models.SendErrorJson(w, http.StatusUnauthorized, "login attempt is already used")
+			return
+		} else if err != nil {
+			h.log(r).Errorf("failed to delete 2fa challenge: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+			return
+		}
+
+		data, err := h.startSession(r, userId, loginMethodTwoFactor)
+		if err != nil {
+			h.sendSessionError(w, r, err)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// startTwoFactorChallenge is used by LogIn instead of starting session when user has TOTP enabled
+func (h *Handlers) startTwoFactorChallenge(ctx context.Context, userId int) (models.Data, error) {
+	challenge := uuid.New().String()
+	if err := h.cache.Set(ctx, fmt.Sprintf(twoFactorChallengeKey, challenge), userId, twoFactorChallengeTTL); err != nil {
+		return nil, err
+	}
+
+	data := models.NewData()
+	data["2fa_required"] = true
+	data["challenge"] = challenge
+	data["expires_in"] = int(twoFactorChallengeTTL.Seconds())
+
+	return data, nil
+}
+
+func (h *Handlers) twoFactorEnabled(ctx context.Context, userId int) (bool, error) {
+	enrolment, err := h.twoFactorRepo.GetTOTP(ctx, userId)
+	if err != nil {
+		if err.Error() == postgresql.NotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return enrolment.Enabled, nil
+}
+
+// verifySecondFactor accepts authenticator code, each code only once, or unused recovery code
+func (h *Handlers) verifySecondFactor(ctx context.Context, userId int, req dto.SecondFactorRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		err := h.twoFactorRepo.UseRecoveryCode(ctx, userId, twofactor.HashRecoveryCode(req.RecoveryCode))
+		if err != nil {
+			if err.Error() == postgresql.NotFound {
+				return false, nil
+			}
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	enrolment, err := h.openTOTP(ctx, userId)
+	if err != nil {
+		if err.Error() == postgresql.NotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !enrolment.Enabled || !twofactor.Validate(req.Code, enrolment.Secret) {
+		return false, nil
+	}
+
+	fresh := h.cache.SetNX(ctx, fmt.Sprintf(totpUsedKey, userId, req.Code), 1, twofactor.Period*(2*twofactor.Skew+1))
+	if err := fresh.Err(); err != nil {
+		return false, err
+	}
+
+	return fresh.Val(), nil
+}
+
+func totpSecretID(userId int) string {
+	return fmt.Sprintf("totp/%d", userId)
+}
+
+// openTOTP fetches enrolment with decrypted secret, secret kept in plain by older version is encrypted on the way
+func (h *Handlers) openTOTP(ctx context.Context, userId int) (*models.TOTP, error) {
+	enrolment, err := h.twoFactorRepo.GetTOTP(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := enrolment.Secret
+	enrolment.Secret, err = jwttool.OpenString(totpSecretID(userId), stored)
+	if err != nil {
+		return nil, fmt.Errorf("totp secret: %w", err)
+	}
+
+	if !jwttool.StringSealed(stored) {
+		sealed, err := jwttool.SealString(totpSecretID(userId), enrolment.Secret)
+		if err == nil {
+			err = h.twoFactorRepo.ReplaceTOTPSecret(ctx, userId, stored, sealed)
+		}
+		if err != nil && !errors.Is(err, jwttool.ErrNoKEK) {
+			h.logger.WithContext(ctx).Errorf("Failed to encrypt totp secret of user %d: %v", userId, err)
+		}
+	}
+
+	return enrolment, nil
+}
+
+// reauthenticate checks password, or fresh provider login of user without one, and, when TOTP is enabled,
+// second factor of logged in user. Error response is sent when false
+func (h *Handlers) reauthenticate(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+	var req dto.ReauthRequest
+	if err := bindjson.BindJson(r.Body, &req); err != nil {
+		models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+		return 0, false
+	}
+
+	if !h.verifyPassword(w, r, userId, req.Password) {
+		return 0, false
+	}
+
+	enabled, err := h.twoFactorEnabled(r.Context(), userId)
+	if err != nil {
+		h.log(r).Errorf("Failed to check totp: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "failed to check totp")
+		return 0, false
+	} else if !enabled {
+		return userId, true
+	}
+
+	// password alone must not let codes be brute forced, so attempts are limited like login challenge
+	attemptsKey := fmt.Sprintf(twoFactorReauthAttemptsKey, userId)
+	attempts, err := h.cache.Incr(r.Context(), attemptsKey, twoFactorChallengeTTL)
+	if err != nil {
+		h.log(r).Errorf("Failed to count 2fa attempts: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+		return 0, false
+	}
+
+	if attempts > maxTwoFactorAttempts {
+		tooManyAttempts(w, twoFactorChallengeTTL)
+		return 0, false
+	}
+
+	ok, err := h.verifySecondFactor(r.Context(), userId, req.SecondFactorRequest)
+	if err != nil {
+		h.log(r).Errorf("Failed to verify second factor: %v", err)
+		models.SendErrorJson(w, http.StatusInternalServerError, "failed to verify code")
+		return 0, false
+	} else if !ok {
+		models.SendErrorJson(w, http.StatusUnauthorized, "invalid code")
+		return 0, false
+	}
+
+	if err := h.cache.Del(r.Context(), attemptsKey); err != nil {
+		h.log(r).Errorf("Failed to reset 2fa attempts: %v", err)
+	}
+
+	return userId, true
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"up-down-server/internal/lib/jwttool"
+	"up-down-server/internal/lib/twofactor"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func newTestKEK(t *testing.T) string {
+	t.Helper()
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// totpCode of secret at given time, the same way authenticator app computes it
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    uint(twofactor.Period.Seconds()),
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func postAs(h http.HandlerFunc, userId int, body string) *httptest.ResponseRecorder {
+	req := asSession(httptest.NewRequest(http.MethodPost, "/api/account/2fa", strings.NewReader(body)), userId, "session")
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// enrollTOTP enables TOTP of user, returns plain secret and recovery codes
+func enrollTOTP(t *testing.T, h *Handlers, userId int) (string, []string) {
+	t.Helper()
+
+	rec := postAs(h.EnrollTOTP(), userId, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enroll: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	_, data := decodeResponse(t, rec)
+	secret := data["secret"].(string)
+
+	rec = postAs(h.ConfirmTOTP(), userId, fmt.Sprintf(`{"code": %q}`, totpCode(t, secret, time.Now())))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm: expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	_, data = decodeResponse(t, rec)
+
+	var codes []string
+	for _, code := range data["recovery_codes"].([]any) {
+		codes = append(codes, code.(string))
+	}
+
+	return secret, codes
+}
+
+func TestTOTPSecretIsEncrypted(t *testing.T) {
+	deps := &testDeps{kek: newTestKEK(t)}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("grace", "Passw0rd", "")
+
+	secret, _ := enrollTOTP(t, h, userId)
+
+	stored := deps.twoFactor.totp[userId].Secret
+	if !jwttool.StringSealed(stored) || strings.Contains(stored, secret) {
+		t.Fatalf("totp secret is stored in plain: %s", stored)
+	}
+
+	// secret stored in plain by older version keeps working and gets encrypted on first use
+	legacy := deps.users.add("heidi", "Passw0rd", "")
+	deps.twoFactor.totp[legacy] = &models.TOTP{UserID: legacy, Secret: secret, Enabled: true}
+
+	ok, err := h.verifySecondFactor(t.Context(), legacy, dto.SecondFactorRequest{Code: totpCode(t, secret, time.Now())})
+	if err != nil || !ok {
+		t.Fatalf("legacy secret is not accepted: %v", err)
+	}
+	if !jwttool.StringSealed(deps.twoFactor.totp[legacy].Secret) {
+		t.Error("legacy secret is not encrypted after use")
+	}
+}
+
+func TestTOTPEnrolmentRequiresKEK(t *testing.T) {
+	deps := &testDeps{}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("ivan", "Passw0rd", "")
+
+	if rec := postAs(h.EnrollTOTP(), userId, ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d: %s", http.StatusServiceUnavailable, rec.Code, rec.Body)
+	}
+	if len(deps.twoFactor.totp) != 0 {
+		t.Error("totp secret is stored without key encryption key")
+	}
+}
+
+func TestTOTPCodeIsSingleUse(t *testing.T) {
+	deps := &testDeps{kek: newTestKEK(t)}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("judy", "Passw0rd", "")
+
+	secret, _ := enrollTOTP(t, h, userId)
+
+	// code of the next period, the one of confirmation is spent already
+	code := totpCode(t, secret, time.Now().Add(twofactor.Period))
+	for i, expected := range []bool{true, false} {
+		ok, err := h.verifySecondFactor(t.Context(), userId, dto.SecondFactorRequest{Code: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("use %d: expected %v, got %v", i+1, expected, ok)
+		}
+	}
+
+	if ok, _ := h.verifySecondFactor(t.Context(), userId, dto.SecondFactorRequest{Code: "000000"}); ok {
+		t.Error("wrong code is accepted")
+	}
+}
+
+func TestRecoveryCodeLogin(t *testing.T) {
+	deps := &testDeps{kek: newTestKEK(t)}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("ken", "Passw0rd", "")
+
+	_, codes := enrollTOTP(t, h, userId)
+	if len(codes) != twofactor.RecoveryCodesCount {
+		t.Fatalf("expected %d recovery codes, got %d", twofactor.RecoveryCodesCount, len(codes))
+	}
+
+	login := func() string {
+		rec := httptest.NewRecorder()
+		h.LogIn()(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username": "ken", "password": "Passw0rd"}`)))
+		_, data := decodeResponse(t, rec)
+
+		challenge, _ := data["challenge"].(string)
+		if challenge == "" {
+			t.Fatalf("password login of user with totp did not return challenge: %v", data)
+		}
+		return challenge
+	}
+
+	secondFactor := func(challenge, recoveryCode string) int {
+		body := fmt.Sprintf(`{"challenge": %q, "recovery_code": %q}`, challenge, recoveryCode)
+
+		rec := httptest.NewRecorder()
+		h.LogInSecondFactor()(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// recovery code is typed as user likes
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if code := secondFactor(login(), typed); code != http.StatusOK {
+		t.Fatalf("recovery code: expected %d, got %d", http.StatusOK, code)
+	}
+	if code := secondFactor(login(), codes[0]); code != http.StatusUnauthorized {
+		t.Fatalf("used recovery code: expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	// challenge is burnt after too many wrong codes, even the right one does not help then
+	challenge := login()
+	for i := 0; i < maxTwoFactorAttempts; i++ {
+		secondFactor(challenge, "wrong-code")
+	}
+	if code := secondFactor(challenge, codes[1]); code != http.StatusUnauthorized {
+		t.Fatalf("burnt challenge: expected %d, got %d", http.StatusUnauthorized, code)
+	}
+	if len(deps.sessions.sessions) != 1 {
+		t.Errorf("expected 1 session, got %d", len(deps.sessions.sessions))
+	}
+}
+
+func TestReauthSecondFactorIsLimited(t *testing.T) {
+	deps := &testDeps{kek: newTestKEK(t)}
+	h := newTestHandlers(t, deps)
+	userId := deps.users.add("leo", "Passw0rd", "")
+
+	secret, _ := enrollTOTP(t, h, userId)
+
+	disable := func(code string) int {
+		return postAs(h.DisableTOTP(), userId, fmt.Sprintf(`{"password": "Passw0rd", "code": %q}`, code)).Code
+	}
+
+	for i := 0; i < maxTwoFactorAttempts; i++ {
+		if code := disable("000000"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: expected %d, got %d", i+1, http.StatusUnauthorized, code)
+		}
+	}
+
+	if code := disable(totpCode(t, secret, time.Now().Add(twofactor.Period))); code != http.StatusTooManyRequests {
+		t.Fatalf("right code over limit: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+	if _, ok := deps.twoFactor.totp[userId]; !ok {
+		t.Error("totp is disabled over attempt limit")
+	}
+}
@@ -2,7 +2,16 @@
 package handlers
 
 import (
+	"net/http"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/config"
+	"up-down-server/internal/events"
+	"up-down-server/internal/health"
+	"up-down-server/internal/loginguard"
 	"up-down-server/internal/models"
+	"up-down-server/internal/sso"
+	"up-down-server/internal/webhook"
 
 	"github.com/sirupsen/logrus"
 )
@@ -10,17 +19,56 @@ import (
 type Handlers struct {
 	fileRepo models.FileMetaRepository
 	userRepo models.UserRepository
-	cache    models.Cache
+	jobRepo  models.JobRepository
+
+	sessionRepo   models.SessionRepository
+	apiKeyRepo    models.APIKeyRepository
+	twoFactorRepo models.TwoFactorRepository
+	adminRepo     models.AdminRepository
+	auditRepo     models.AuditRepository
+	webhookRepo   models.WebhookRepository
+	cache         models.Cache
+	oidc          *sso.Provider // nil when oidc login is disabled
+	notifier      models.Notifier
+	loginGuard    *loginguard.Guard
+	audit         *audit.Recorder
+	webhooks      *webhook.Dispatcher
+	events        *events.Broker
+	accountCfg    config.AccountConfig
+	storage       models.FileStorage
+	health        *health.Checker
 
 	logger *logrus.Logger
 }
 
-func NewHTTPHandlers(file models.FileMetaRepository, user models.UserRepository, cache models.Cache, logger *logrus.Logger) *Handlers {
+func NewHTTPHandlers(file models.FileMetaRepository, user models.UserRepository, job models.JobRepository, session models.SessionRepository, apiKey models.APIKeyRepository, twoFactor models.TwoFactorRepository, admin models.AdminRepository, auditRepo models.AuditRepository, webhookRepo models.WebhookRepository, cache models.Cache, storage models.FileStorage, oidc *sso.Provider, notifier models.Notifier, loginGuard *loginguard.Guard, audit *audit.Recorder, webhooks *webhook.Dispatcher, events *events.Broker, health *health.Checker, accountCfg config.AccountConfig, logger *logrus.Logger) *Handlers {
 	return &Handlers{
 		fileRepo: file,
 		userRepo: user,
-		cache:    cache,
+		jobRepo:  job,
+
+		sessionRepo:   session,
+		apiKeyRepo:    apiKey,
+		twoFactorRepo: twoFactor,
+		adminRepo:     admin,
+		auditRepo:     auditRepo,
+		webhookRepo:   webhookRepo,
+		cache:         cache,
+		storage:       storage,
+		oidc:          oidc,
+		notifier:      notifier,
+		loginGuard:    loginGuard,
+		audit:         audit,
+		webhooks:      webhooks,
+		events:        events,
+		health:        health,
+		accountCfg:    accountCfg,
 
 		logger: logger,
 	}
-}
\ No newline at end of file
+}
+
+// log returns logger entry carrying request id and trace of r
+func (h *Handlers) log(r *http.Request) *logrus.Entry {
+	return h.logger.WithContext(r.Context())
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/bindjson"
+	"up-down-server/internal/models"
+	"up-down-server/internal/models/dto"
+	"up-down-server/internal/repository/postgresql"
+	"up-down-server/internal/webhook"
+
+	"github.com/google/uuid"
+)
+
+const maxWebhookDeliveries = 100
+
+// Registers webhook, secret signing its payloads is returned only in this response
+func (h *Handlers) CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		var req dto.CreateWebhookRequest
+		if err := bindjson.BindJson(r.Body, &req); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "failed to bind request")
+			return
+		}
+
+		req.URL = strings.TrimSpace(req.URL)
+		if err := webhook.ValidateURL(req.URL); err != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+
+		events, ok := normalizeWebhookEvents(req.Events)
+		if !ok {
+			models.SendErrorJson(w, http.StatusBadRequest, "at least one event is required, allowed: %s", strings.Join(models.WebhookEvents, ", "))
+			return
+		}
+
+		hook, err := h.webhooks.Create(r.Context(), userId, req.URL, events)
+		if err != nil {
+			if err.Error() == webhook.TooManyWebhooks {
+				models.SendErrorJson(w, http.StatusConflict, "%s", err.Error())
+				return
+			}
+
+			h.log(r).Errorf("Failed to save webhook: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to save webhook")
+			return
+		}
+
+		data := models.NewData()
+		data["webhook"] = hook
+		data["secret"] = hook.Secret
+		models.SendSuccessJson(w, http.StatusCreated, data)
+	}
+}
+
+func (h *Handlers) ListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		hooks, err := h.webhookRepo.ListWebhooks(r.Context(), userId)
+		if err != nil {
+			h.log(r).Errorf("Failed to list webhooks: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list webhooks")
+			return
+		}
+
+		data := models.NewData()
+		data["webhooks"] = hooks
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Deletes webhook, queued deliveries of it are dropped
+func (h *Handlers) DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+		webhookId := r.PathValue("id")
+		if uuid.Validate(webhookId) != nil {
+			models.SendErrorJson(w, http.StatusBadRequest, "invalid webhook id")
+			return
+		}
+
+		if err := h.webhookRepo.DeleteWebhook(r.Context(), userId, webhookId); err != nil {
+			h.sendWebhookError(w, r, err)
+			return
+		}
+
+		models.SendSuccessJson(w, http.StatusOK, nil)
+	}
+}
+
+// Latest delivery attempts of webhook, retries of one event share delivery_id
+func (h *Handlers) ListWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hook, ok := h.ownWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		deliveries, err := h.webhookRepo.ListWebhookDeliveries(r.Context(), hook.WebhookID, maxWebhookDeliveries)
+		if err != nil {
+			h.log(r).Errorf("Failed to list webhook deliveries: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to list deliveries")
+			return
+		}
+
+		data := models.NewData()
+		data["deliveries"] = deliveries
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// Sends ping event to webhook at once and returns the attempt, it is not retried
+func (h *Handlers) TestWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hook, ok := h.ownWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		delivery, err := h.webhooks.Test(r.Context(), hook)
+		if err != nil {
+			h.log(r).Errorf("Failed to test webhook: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to test webhook")
+			return
+		}
+
+		data := models.NewData()
+		data["delivery"] = delivery
+		models.SendSuccessJson(w, http.StatusOK, data)
+	}
+}
+
+// ownWebhook fetches {id} webhook of request user, error response is sent when false
+func (h *Handlers) ownWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	userId := r.Context().Value(ctx.CtxUserIDKey).(int)
+
+	webhookId := r.PathValue("id")
+	if uuid.Validate(webhookId) != nil {
+		models.SendErrorJson(w, http.StatusBadRequest, "invalid webhook id")
+		return nil, false
+	}
+
+	hook, err := h.webhookRepo.GetWebhook(r.Context(), webhookId)
+	if err != nil {
+		h.sendWebhookError(w, r, err)
+		return nil, false
+	}
+
+	// webhook of other user is reported as missing, not to reveal it exists
+	if hook.UserID != userId {
+		models.SendErrorJson(w, http.StatusNotFound, "webhook not found")
+		return nil, false
+	}
+
+	return hook, true
+}
+
+func (h *Handlers) sendWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if err.Error() == postgresql.NotFound {
+		models.SendErrorJson(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	h.log(r).Errorf("Failed to fetch webhook: %v", err)
+	models.SendErrorJson(w, http.StatusInternalServerError, "failed to fetch webhook")
+}
+
+// normalizeWebhookEvents validates and deduplicates events, at least one is required
+func normalizeWebhookEvents(events []string) ([]string, bool) {
+	var result []string
+	for _, event := range events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !models.IsValidWebhookEvent(event) {
+			return nil, false
+		}
+
+		if !slices.Contains(result, event) {
+			result = append(result, event)
+		}
+	}
+
+	return result, len(result) > 0
+}
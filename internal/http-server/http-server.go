@@ -1,54 +1,112 @@
 package httpserver
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"sync"
 	"time"
+	"up-down-server/internal/audit"
 	"up-down-server/internal/config"
+	"up-down-server/internal/events"
+	"up-down-server/internal/health"
 	"up-down-server/internal/http-server/handlers"
 	"up-down-server/internal/http-server/middlewares"
+	"up-down-server/internal/lib/certreload"
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/loginguard"
+	"up-down-server/internal/metrics"
 	"up-down-server/internal/models"
+	"up-down-server/internal/sso"
+	"up-down-server/internal/webhook"
 
 	"github.com/ayayaakasvin/lightmux"
 	"github.com/sirupsen/logrus"
 )
 
 type ServerApp struct {
-	server *http.Server
+	server   *http.Server
+	redirect *http.Server         // plain http redirecting to https, nil when not configured
+	certs    *certreload.Reloader // nil when TLS is terminated by gateway
 
 	lmux *lightmux.LightMux
 
 	cfg      *config.HTTPServer
 	fileRepo models.FileMetaRepository
 	userRepo models.UserRepository
-	cache    models.Cache
-	wg       *sync.WaitGroup
+	jobRepo  models.JobRepository
+
+	sessionRepo   models.SessionRepository
+	apiKeyRepo    models.APIKeyRepository
+	twoFactorRepo models.TwoFactorRepository
+	adminRepo     models.AdminRepository
+	auditRepo     models.AuditRepository
+	webhookRepo   models.WebhookRepository
+	cache         models.Cache
+	oidc          *sso.Provider // nil when oidc login is disabled
+	notifier      models.Notifier
+	loginGuard    *loginguard.Guard
+	audit         *audit.Recorder
+	webhooks      *webhook.Dispatcher
+	events        *events.Broker
+	health        *health.Checker
+	account       config.AccountConfig
+	storage       models.FileStorage
+	inflight      *inflight
 
 	logger *logrus.Logger
 }
 
-func NewServerApp(cfg *config.HTTPServer, file models.FileMetaRepository, user models.UserRepository, cache models.Cache, logger *logrus.Logger, wg *sync.WaitGroup) *ServerApp {
+func NewServerApp(cfg *config.HTTPServer, file models.FileMetaRepository, user models.UserRepository, job models.JobRepository, session models.SessionRepository, apiKey models.APIKeyRepository, twoFactor models.TwoFactorRepository, admin models.AdminRepository, auditRepo models.AuditRepository, webhookRepo models.WebhookRepository, cache models.Cache, storage models.FileStorage, oidc *sso.Provider, notifier models.Notifier, loginGuard *loginguard.Guard, audit *audit.Recorder, webhooks *webhook.Dispatcher, events *events.Broker, health *health.Checker, account config.AccountConfig, logger *logrus.Logger) *ServerApp {
 	return &ServerApp{
 		cfg:      cfg,
 		fileRepo: file,
 		userRepo: user,
-		cache:    cache,
-		logger:   logger,
-		wg:       wg,
+		jobRepo:  job,
+
+		sessionRepo:   session,
+		apiKeyRepo:    apiKey,
+		twoFactorRepo: twoFactor,
+		adminRepo:     admin,
+		auditRepo:     auditRepo,
+		webhookRepo:   webhookRepo,
+		cache:         cache,
+		storage:       storage,
+		oidc:          oidc,
+		notifier:      notifier,
+		loginGuard:    loginGuard,
+		audit:         audit,
+		webhooks:      webhooks,
+		events:        events,
+		health:        health,
+		account:       account,
+		logger:        logger,
+		inflight:      newInflight(),
 	}
 }
 
-func (s *ServerApp) Run() {
-	defer s.wg.Done()
-
-	s.setupServer()
+// Run serves requests until ctx is done, then stops accepting connections and drains in-flight requests.
+// Requests not finished within shutdown timeout are aborted, so uploads remove their partial files.
+// Dependencies must be closed only after Run returns
+func (s *ServerApp) Run(ctx context.Context) error {
+	if err := s.setupServer(); err != nil {
+		return err
+	}
 
 	s.setupLightMux()
 
-	s.startServer()
+	return s.startServer(ctx)
 }
 
-func (s *ServerApp) startServer() {
+func (s *ServerApp) startServer(ctx context.Context) error {
+	// lightmux.Run handles signals itself and gives requests 5 seconds, so routes are applied here and server is run directly
+	s.lmux.ApplyRoutes()
+	s.lmux.ApplyGlobalMiddlewares()
+	s.server.Handler = s.inflight.track(s.server.Handler)
+
+	// event streams never finish on their own, they are ended as soon as shutdown begins
+	s.server.RegisterOnShutdown(s.events.Close)
+
 	s.logger.Infof("Server has been started on port: %s", s.cfg.Address)
 	s.logger.Infof("Available handlers:\n")
 
@@ -57,20 +115,87 @@ func (s *ServerApp) startServer() {
 
 	go func() {
 		ticker := time.NewTicker(time.Minute * 5)
-		for range ticker.C {
-			s.logger.Info("Server is running...")
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.logger.Info("Server is running...")
+			}
 		}
 	}()
 
-	// RunTLS can be run when server is hosted on domain, acts as seperate service of file storing, for my project, id chose to encapsulate servers under one docker-compose and make nginx-gateaway for my api like auth, file, user service
-	// if err := s.lmux.RunTLS(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile); err != nil {
-	if err := s.lmux.Run(); err != nil {
-		s.logger.Fatalf("Server exited with error: %v", err)
+	serveErr := make(chan error, 2)
+	go func() {
+		// without TLS the service is expected behind nginx gateway of docker-compose, which terminates it
+		if s.certs == nil {
+			serveErr <- s.server.ListenAndServe()
+			return
+		}
+
+		// certificate comes from reloader through TLSConfig.GetCertificate
+		serveErr <- s.server.ListenAndServeTLS("", "")
+	}()
+
+	if s.certs != nil {
+		go func() {
+			if err := s.certs.Watch(ctx); err != nil {
+				s.logger.Errorf("Certificate is not watched for changes: %v", err)
+			}
+		}()
+	}
+
+	if s.redirect != nil {
+		s.logger.Infof("Redirecting http on %s to https", s.redirect.Addr)
+		go func() {
+			serveErr <- fmt.Errorf("redirect listener: %w", s.redirect.ListenAndServe())
+		}()
 	}
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server exited: %w", err)
+	case <-ctx.Done():
+	}
+
+	return s.shutdown()
 }
 
-// setuping server by pointer, so we dont have to return any value
-func (s *ServerApp) setupServer() {
+func (s *ServerApp) shutdown() error {
+	s.logger.Infof("Shutting down server, waiting up to %s for in-flight requests", s.cfg.ShutdownTimeout)
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if s.redirect != nil {
+		// redirects are instant, nothing to drain there
+		s.redirect.Close()
+	}
+
+	err := s.server.Shutdown(graceCtx)
+	if err == nil {
+		s.logger.Info("Server has been shut down gracefully")
+		return nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("shutdown failed: %w", err)
+	}
+
+	s.logger.Warn("Grace period is over, aborting requests still in flight")
+	s.server.Close()
+
+	if !s.inflight.abort(abortTimeout) {
+		return errors.New("aborted requests did not finish in time")
+	}
+
+	s.logger.Info("Aborted requests have finished")
+	return nil
+}
+
+// setupServer configures server by pointer, error is returned for invalid TLS or proxy settings
+func (s *ServerApp) setupServer() error {
 	if s.server == nil {
 		// s.logger.Warn("Server is nil, creating a new server pointer")
 		s.server = &http.Server{}
@@ -80,45 +205,147 @@ func (s *ServerApp) setupServer() {
 	s.server.IdleTimeout = s.cfg.IdleTimeout
 	s.server.ReadTimeout = s.cfg.Timeout
 	s.server.WriteTimeout = s.cfg.Timeout
+	s.server.BaseContext = s.inflight.baseContext
+
+	if err := clientip.SetTrustedProxies(s.cfg.TrustedProxies); err != nil {
+		return err
+	}
+
+	if s.cfg.TLS.Enabled {
+		if err := s.setupTLS(); err != nil {
+			return err
+		}
+
+		if s.cfg.TLS.RedirectAddress != "" {
+			s.redirect = s.redirectServer()
+		}
+	}
 
 	s.logger.Info("Server has been set up")
+	return nil
 }
 
 func (s *ServerApp) setupLightMux() {
 	s.lmux = lightmux.NewLightMux(s.server)
 
-	mws := middlewares.NewHTTPMiddlewares(s.logger, s.cache, s.cfg.Cors)
-	handlers := handlers.NewHTTPHandlers(s.fileRepo, s.userRepo, s.cache, s.logger)
+	mws := middlewares.NewHTTPMiddlewares(s.logger, s.cache, s.apiKeyRepo, s.userRepo, s.cfg.Cors, s.cfg.TLS.ClientAuth)
+	handlers := handlers.NewHTTPHandlers(s.fileRepo, s.userRepo, s.jobRepo, s.sessionRepo, s.apiKeyRepo, s.twoFactorRepo, s.adminRepo, s.auditRepo, s.webhookRepo, s.cache, s.storage, s.oidc, s.notifier, s.loginGuard, s.audit, s.webhooks, s.events, s.health, s.account, s.logger)
 
-	// global middlewares usage | recovery from panic, logger for logging(logrus) and cors
-	s.lmux.Use(mws.RecoverMiddleware, mws.LoggerMiddleware, mws.CorsMiddleware)
+	// global middlewares usage | request id, recovery from panic, tracing, logger for logging(logrus) and cors
+	s.lmux.Use(mws.RequestIDMiddleware, mws.RecoverMiddleware, mws.TracingMiddleware, mws.LoggerMiddleware, mws.CorsMiddleware)
 
 	s.lmux.NewRoute("/api/ping").Handle(http.MethodGet, handlers.PingHandler())
+	s.lmux.NewRoute("/.well-known/jwks.json").Handle(http.MethodGet, handlers.JWKS())
+
+	// /healthz liveness and /readyz readiness probes for orchestrator, no auth. Details of /readyz need metrics token
+	s.lmux.NewRoute("/healthz").Handle(http.MethodGet, handlers.Healthz())
+	s.lmux.NewRoute("/readyz").Handle(http.MethodGet, handlers.Readyz(s.cfg.Metrics.Token))
 
-	// /api file GET | POST
-	apiGroup := s.lmux.NewGroup("/api", mws.JWTAuthMiddleware)
-	apiGroup.NewRoute("/upload", mws.RateLimitMiddleware).Handle(http.MethodPost, handlers.UploadFile())
-	apiGroup.NewRoute("/download", mws.RateLimitMiddleware).Handle(http.MethodGet, handlers.DownloadFile())
-	apiGroup.NewRoute("/download/shared/", mws.RateLimitMiddleware).Handle(http.MethodGet, handlers.DownloadFileViaSharedLink())
-	apiGroup.NewRoute("/sharelink", mws.RateLimitMiddleware).Handle(http.MethodGet, handlers.CreateShareLink())
+	// /metrics for prometheus, protected by static token when METRICS_TOKEN is set
+	if s.cfg.Metrics.Enabled {
+		s.lmux.NewRoute("/metrics", mws.RequireStaticToken(s.cfg.Metrics.Token)).Handle(http.MethodGet, metrics.Handler().ServeHTTP)
+	}
+
+	// /api file GET | POST, accessible with access token or API key having required scope
+	apiGroup := s.lmux.NewGroup("/api", mws.AuthMiddleware)
+	apiGroup.NewRoute("/upload", mws.RateLimitMiddleware, mws.RequireScope(models.ScopeUpload)).Handle(http.MethodPost, handlers.UploadFile())
+	apiGroup.NewRoute("/download", mws.RateLimitMiddleware, mws.RequireScope(models.ScopeRead)).Handle(http.MethodGet, handlers.DownloadFile())
+	apiGroup.NewRoute("/download/shared/", mws.RateLimitMiddleware, mws.RequireScope(models.ScopeRead)).Handle(http.MethodGet, handlers.DownloadFileViaSharedLink())
+	apiGroup.NewRoute("/sharelink", mws.RateLimitMiddleware, mws.RequireScope(models.ScopeShare)).Handle(http.MethodGet, handlers.CreateShareLink())
 
-	// /api/files metadata CRUD
+	// /api/files metadata CRUD, scope depends on method so it wraps handler
 	filesRoute := apiGroup.NewRoute("/files")
-	filesRoute.Handle(http.MethodGet, handlers.ListFile())
-	filesRoute.Handle(http.MethodDelete, handlers.DeleteFile())
-	apiGroup.NewRoute("/files/metadata").Handle(http.MethodGet, handlers.GetFileMetaData())
-	apiGroup.NewRoute("/files/rename").Handle(http.MethodPatch, handlers.UpdateFileName())
+	filesRoute.Handle(http.MethodGet, mws.RequireScope(models.ScopeRead)(handlers.ListFile()))
+	filesRoute.Handle(http.MethodDelete, mws.RequireScope(models.ScopeDelete)(handlers.DeleteFile()))
+	apiGroup.NewRoute("/files/metadata", mws.RequireScope(models.ScopeRead)).Handle(http.MethodGet, handlers.GetFileMetaData())
+	apiGroup.NewRoute("/files/rename", mws.RequireScope(models.ScopeUpload)).Handle(http.MethodPatch, handlers.UpdateFileName())
+	apiGroup.NewRoute("/files/expiry", mws.RequireScope(models.ScopeUpload)).Handle(http.MethodPatch, handlers.UpdateFileExpiry())
+
+	// /api/files user defined tags and key/value attributes
+	tagsRoute := apiGroup.NewRoute("/files/tags", mws.RequireScope(models.ScopeUpload))
+	tagsRoute.Handle(http.MethodPost, handlers.AddTags())
+	tagsRoute.Handle(http.MethodDelete, handlers.RemoveTags())
+	attributesRoute := apiGroup.NewRoute("/files/attributes", mws.RequireScope(models.ScopeUpload))
+	attributesRoute.Handle(http.MethodPut, handlers.SetAttributes())
+	attributesRoute.Handle(http.MethodDelete, handlers.RemoveAttributes())
 
-	// /api auth 
+	// /api/events stream of changes of own files, EventSource may pass token in access_token param
+	s.lmux.NewRoute("/api/events", mws.AccessTokenQueryMiddleware, mws.AuthMiddleware, mws.RequireScope(models.ScopeRead)).Handle(http.MethodGet, handlers.StreamEvents())
+
+	// /api auth
 	authGroup := s.lmux.NewGroup("/api")
 	authGroup.NewRoute("/login").Handle(http.MethodPost, handlers.LogIn())
+	authGroup.NewRoute("/login/2fa").Handle(http.MethodPost, handlers.LogInSecondFactor())
 	authGroup.NewRoute("/register").Handle(http.MethodPost, handlers.Register())
 	authGroup.NewRoute("/logout", mws.JWTAuthMiddleware).Handle(http.MethodDelete, handlers.LogOut())
 	authGroup.NewRoute("/refresh").Handle(http.MethodPost, handlers.RefreshTheToken())
+	authGroup.NewRoute("/password/forgot").Handle(http.MethodPost, handlers.ForgotPassword())
+	authGroup.NewRoute("/password/reset").Handle(http.MethodPost, handlers.ResetPassword())
+
+	// /api/oidc login through external identity provider
+	if s.oidc != nil {
+		authGroup.NewRoute("/oidc/login").Handle(http.MethodGet, handlers.OIDCLogin())
+		authGroup.NewRoute("/oidc/callback").Handle(http.MethodGet, handlers.OIDCCallback())
+	}
+
+	// /api account management, API keys are not accepted here so leaked key can not mint new ones
+	accountGroup := s.lmux.NewGroup("/api", mws.JWTAuthMiddleware)
+
+	// /api/audit own actions and actions on own files
+	accountGroup.NewRoute("/audit").Handle(http.MethodGet, handlers.ListAuditEvents())
+
+	// /api/webhooks endpoints notified about file events
+	webhooksRoute := accountGroup.NewRoute("/webhooks")
+	webhooksRoute.Handle(http.MethodGet, handlers.ListWebhooks())
+	webhooksRoute.Handle(http.MethodPost, handlers.CreateWebhook())
+	accountGroup.NewRoute("/webhooks/{id}").Handle(http.MethodDelete, handlers.DeleteWebhook())
+	accountGroup.NewRoute("/webhooks/{id}/deliveries").Handle(http.MethodGet, handlers.ListWebhookDeliveries())
+	accountGroup.NewRoute("/webhooks/{id}/test").Handle(http.MethodPost, handlers.TestWebhook())
+
+	// /api/sessions active logins of user
+	sessionsRoute := accountGroup.NewRoute("/sessions")
+	sessionsRoute.Handle(http.MethodGet, handlers.ListSessions())
+	sessionsRoute.Handle(http.MethodDelete, handlers.RevokeAllSessions())
+	accountGroup.NewRoute("/sessions/{id}").Handle(http.MethodDelete, handlers.RevokeSession())
+
+	// /api/keys personal API keys
+	keysRoute := accountGroup.NewRoute("/keys")
+	keysRoute.Handle(http.MethodGet, handlers.ListAPIKeys())
+	keysRoute.Handle(http.MethodPost, handlers.CreateAPIKey())
+	accountGroup.NewRoute("/keys/{id}").Handle(http.MethodDelete, handlers.RevokeAPIKey())
+
+	// /api/account self-service account management
+	accountGroup.NewRoute("/account").Handle(http.MethodDelete, handlers.DeleteAccount())
+	accountGroup.NewRoute("/account/password").Handle(http.MethodPut, handlers.ChangePassword())
+	accountGroup.NewRoute("/account/email").Handle(http.MethodPut, handlers.ChangeEmail())
+
+	// /api/2fa authenticator app enrolment and recovery codes
+	accountGroup.NewRoute("/2fa").Handle(http.MethodGet, handlers.TwoFactorStatus())
+	totpRoute := accountGroup.NewRoute("/2fa/totp")
+	totpRoute.Handle(http.MethodPost, handlers.EnrollTOTP())
+	totpRoute.Handle(http.MethodDelete, handlers.DisableTOTP())
+	accountGroup.NewRoute("/2fa/totp/confirm").Handle(http.MethodPost, handlers.ConfirmTOTP())
+	accountGroup.NewRoute("/2fa/recovery-codes").Handle(http.MethodPost, handlers.RegenerateRecoveryCodes())
+
+	// /api/admin service state
+	adminGroup := s.lmux.NewGroup("/api/admin", mws.JWTAuthMiddleware, mws.RequireRole(models.RoleAdmin))
+	adminGroup.NewRoute("/jobs").Handle(http.MethodGet, handlers.ListJobs())
+	adminGroup.NewRoute("/stats").Handle(http.MethodGet, handlers.AdminStats())
+	adminGroup.NewRoute("/audit").Handle(http.MethodGet, handlers.AdminListAuditEvents())
+
+	// /api/admin user and content management
+	adminGroup.NewRoute("/users").Handle(http.MethodGet, handlers.AdminListUsers())
+	adminGroup.NewRoute("/users/{id}").Handle(http.MethodGet, handlers.AdminGetUser())
+	adminGroup.NewRoute("/users/{id}/disable").Handle(http.MethodPost, handlers.AdminDisableUser())
+	adminGroup.NewRoute("/users/{id}/enable").Handle(http.MethodPost, handlers.AdminEnableUser())
+	adminGroup.NewRoute("/users/{id}/logout").Handle(http.MethodPost, handlers.AdminLogoutUser())
+	adminGroup.NewRoute("/users/{id}/reset-limits").Handle(http.MethodPost, handlers.AdminResetUserLimits())
+	adminGroup.NewRoute("/users/{id}/files").Handle(http.MethodGet, handlers.AdminListUserFiles())
+	adminGroup.NewRoute("/files/{id}").Handle(http.MethodDelete, handlers.AdminDeleteFile())
 
 	// /swagger/ that idk why not working and / route for redirecting to 404 page, that has to be done
 	// s.lmux.Mux().HandleFunc("/swagger/", handlers.SwaggerHandler())
 	s.lmux.Mux().HandleFunc("/", handlers.NotFound404())
 
 	s.logger.Info("LightMux has been set up")
-}
\ No newline at end of file
+}
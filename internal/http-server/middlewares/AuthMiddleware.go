@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/apikey"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/ayayaakasvin/lightmux"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	// last_used_at of API key is written at most once per this period
+	apiKeyTouchPeriod = time.Minute
+	apiKeyTouchKey    = "apikey touched:%s"
+)
+
+// AuthMiddleware accepts either access token or API key, as "Authorization: Bearer <key>" or X-API-Key header.
+// Without them verified TLS client certificate is accepted, when mutual TLS is on.
+// Granted scopes are put into ctx, routes check them with RequireScope
+func (m *Middlewares) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := bearerToken(r)
+		if !ok {
+			tokenString = r.Header.Get(APIKeyHeader)
+		}
+
+		cert := clientCertificate(r)
+		if tokenString == "" && cert == nil {
+			unauthorized(w, "authorization header missing")
+			return
+		}
+
+		if tokenString == "" {
+			r, ok = m.authenticateClientCert(w, r, cert)
+		} else if apikey.IsAPIKey(tokenString) {
+			r, ok = m.authenticateAPIKey(w, r, tokenString)
+		} else {
+			r, ok = m.authenticateJWT(w, r, tokenString)
+		}
+
+		if !ok {
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// authenticateAPIKey looks key up by its hash, error response is sent when false
+func (m *Middlewares) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string) (*http.Request, bool) {
+	apiKey, err := m.apiKeys.GetAPIKeyByHash(r.Context(), apikey.Hash(key))
+	if err != nil {
+		if err.Error() == postgresql.NotFound {
+			unauthorized(w, "invalid api key")
+		} else if err.Error() == postgresql.Disabled {
+			models.SendErrorJson(w, http.StatusForbidden, "account is disabled")
+		} else {
+			m.logger.WithContext(r.Context()).Errorf("Failed to look up api key: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to check api key")
+		}
+		return nil, false
+	}
+
+	touch := m.cache.SetNX(r.Context(), fmt.Sprintf(apiKeyTouchKey, apiKey.KeyID), "1", apiKeyTouchPeriod)
+	if touch.Err() == nil && touch.Val() {
+		if err := m.apiKeys.TouchAPIKey(r.Context(), apiKey.KeyID); err != nil {
+			m.logger.WithContext(r.Context()).Errorf("Failed to update api key last use: %v", err)
+		}
+	}
+
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxUserIDKey, apiKey.UserID)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxAPIKeyIDKey, apiKey.KeyID)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxRoleKey, apiKey.Role)
+	// key never grants more than role of its owner allows now
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxScopesKey, models.IntersectScopes(apiKey.Scopes, models.RoleScopes(apiKey.Role)))
+
+	return r, true
+}
+
+// RequireScope rejects requests whose credentials were not granted scope, goes after AuthMiddleware
+func (m *Middlewares) RequireScope(scope string) lightmux.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := r.Context().Value(ctx.CtxScopesKey).([]string)
+			if !models.HasScope(scopes, scope) {
+				models.SendErrorJson(w, http.StatusForbidden, "%s scope is required", scope)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// RequireRole rejects requests of users having none of roles, goes after JWTAuthMiddleware or AuthMiddleware
+func (m *Middlewares) RequireRole(roles ...string) lightmux.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(ctx.CtxRoleKey).(string)
+			if !models.HasRole(roles, role) {
+				models.SendErrorJson(w, http.StatusForbidden, "access denied for role %q", role)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
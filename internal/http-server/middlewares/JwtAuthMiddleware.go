@@ -1,7 +1,9 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"up-down-server/internal/http-server/ctx"
 	"up-down-server/internal/lib/jwttool"
@@ -14,59 +16,98 @@ const (
 	AuthorizationHeader = "Authorization"
 )
 
-// JWTAuthMiddleware is a middleware for http.HandlerFunc
+// JWTAuthMiddleware is a middleware for http.HandlerFunc, accepts access tokens only
 func (m *Middlewares) JWTAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get(AuthorizationHeader)
-		if authHeader == "" {
+		tokenString, ok := bearerToken(r)
+		if !ok {
 			unauthorized(w, "authorization header missing")
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			unauthorized(w, "authorization header missing")
+		r, ok = m.authenticateJWT(w, r, tokenString)
+		if !ok {
 			return
 		}
 
-		claims, err := jwttool.ValidateJWT(tokenString)
-		if err != nil {
-			unauthorized(w, "failed to validate jwt")
-			return
-		}
+		next(w, r)
+	}
+}
 
-		sessionIdAny, exists := claims["session_id"]
-		if !exists {
-			unauthorized(w, "session_id missing")
-			return
-		}
+// authenticateJWT validates access token and its session, error response is sent when false
+func (m *Middlewares) authenticateJWT(w http.ResponseWriter, r *http.Request, tokenString string) (*http.Request, bool) {
+	claims, err := jwttool.ValidateJWT(tokenString)
+	if err != nil {
+		unauthorized(w, "failed to validate jwt")
+		return nil, false
+	}
 
-		sessionId := sessionIdAny.(string)
+	if jwttool.FetchString(claims, "typ") != models.TokenTypeAccess {
+		unauthorized(w, "not an access token")
+		return nil, false
+	}
 
-		if _, err := m.cache.Get(r.Context(), sessionId); err == redis.Nil {
-			unauthorized(w, "session is expired")
-			return
-		}
+	sessionId, ok := claims["session_id"].(string)
+	if !ok || sessionId == "" {
+		unauthorized(w, "session_id missing")
+		return nil, false
+	}
 
-		userIdAny, ok := claims["user_id"]
-		if !ok || userIdAny == nil {
-			unauthorized(w, "user_id missing")
-			return
-		}
+	userIdAny, ok := claims["user_id"]
+	if !ok || userIdAny == nil {
+		unauthorized(w, "user_id missing")
+		return nil, false
+	}
 
-		userIdInt, err := jwttool.FetchUserID(userIdAny)
-		if err != nil {
-			unauthorized(w, "user_id is invalid")
-			return
-		}
+	userIdInt, err := jwttool.FetchUserID(userIdAny)
+	if err != nil {
+		unauthorized(w, "user_id is invalid")
+		return nil, false
+	}
+
+	// session key holds id of user who owns the session
+	owner, err := m.cache.Get(r.Context(), sessionId)
+	if err == redis.Nil {
+		unauthorized(w, "session is expired")
+		return nil, false
+	} else if err != nil {
+		models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
+		return nil, false
+	}
 
-		r = ctx.WrapValueIntoRequest(r, ctx.CtxUserIDKey, userIdInt)
-		r = ctx.WrapValueIntoRequest(r, ctx.CtxSessionIDKey, sessionId)
+	if fmt.Sprint(owner) != strconv.Itoa(userIdInt) {
+		unauthorized(w, "session does not belong to user")
+		return nil, false
+	}
 
-		next(w, r)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxUserIDKey, userIdInt)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxSessionIDKey, sessionId)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		r = ctx.WrapValueIntoRequest(r, ctx.CtxTokenExpKey, exp.Time)
+	}
+	// tokens issued before roles existed carry no role
+	role := jwttool.FetchString(claims, "role")
+	if role == "" {
+		role = models.RoleUser
 	}
+
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxRoleKey, role)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxScopesKey, models.RoleScopes(role))
+
+	return r, true
 }
 
-func unauthorized(w http.ResponseWriter, msg string)  {
+// bearerToken extracts token from "Authorization: Bearer <token>"
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get(AuthorizationHeader)
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || tokenString == authHeader {
+		return "", false
+	}
+
+	return tokenString, true
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
 	models.SendErrorJson(w, http.StatusUnauthorized, "%s", msg)
-}
\ No newline at end of file
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+)
+
+const (
+	CertUserCommonName = "common_name"
+	CertUserEmail      = "email"
+)
+
+// clientCertificate is leaf of chain verified against client CA, nil when client presented none.
+// Unverified certificates are never looked at, handshake accepts them only when client auth is off
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// authenticateClientCert maps certificate to user by configured field, error response is sent when false.
+// Certificate grants scopes of role of user, same as access token
+func (m *Middlewares) authenticateClientCert(w http.ResponseWriter, r *http.Request, cert *x509.Certificate) (*http.Request, bool) {
+	var (
+		userId int
+		err    error
+	)
+
+	switch m.certUserField {
+	case CertUserEmail:
+		if len(cert.EmailAddresses) == 0 {
+			unauthorized(w, "client certificate has no email")
+			return nil, false
+		}
+		userId, err = m.users.GetUserIDByEmail(r.Context(), cert.EmailAddresses[0])
+	default:
+		userId, err = m.users.GetUserIDByUsername(r.Context(), cert.Subject.CommonName)
+	}
+
+	var role string
+	if err == nil {
+		role, err = m.users.GetUserRole(r.Context(), userId)
+	}
+
+	if err != nil {
+		if err.Error() == postgresql.NotFound {
+			unauthorized(w, "client certificate does not belong to any user")
+		} else if err.Error() == postgresql.Disabled {
+			models.SendErrorJson(w, http.StatusForbidden, "account is disabled")
+		} else {
+			m.logger.WithContext(r.Context()).Errorf("Failed to look up user of client certificate: %v", err)
+			models.SendErrorJson(w, http.StatusInternalServerError, "failed to check client certificate")
+		}
+		return nil, false
+	}
+
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxUserIDKey, userId)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxRoleKey, role)
+	r = ctx.WrapValueIntoRequest(r, ctx.CtxScopesKey, models.RoleScopes(role))
+
+	return r, true
+}
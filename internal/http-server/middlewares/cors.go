@@ -19,6 +19,7 @@ func (m *Middlewares) CorsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		w.Header().Set("Access-Control-Allow-Methods", m.allowed_methods)
 		w.Header().Set("Access-Control-Allow-Headers", m.allowed_headers)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -1,93 +1,162 @@
 package middlewares
 
 import (
-	"fmt"
-	"math/rand"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
-)
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/metrics"
 
-var randomizer *rand.Rand
+	"github.com/sirupsen/logrus"
+)
 
-func init() {
-	randomizer = rand.New(rand.NewSource(time.Now().UnixNano()))
+// headers carrying credentials, their values never reach logs
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	APIKeyHeader:          true,
 }
 
-const (
-	ColorRed     = "\033[31m"
-	ColorGreen   = "\033[32m"
-	ColorYellow  = "\033[33m"
-	ColorBlue    = "\033[34m"
-	ColorMagenta = "\033[35m"
-	ColorCyan    = "\033[36m"
-	ColorReset   = "\033[0m"
-)
-
+// LoggerMiddleware writes one structured entry per finished request, headers are logged on debug level only
 func (m *Middlewares) LoggerMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		reqID := uuid.New().String()
-		coloredReqID := fmt.Sprintf("%s%s\033[0m", randomColorOfReqID(), reqID)
-		m.logger.Info(requestInfo(r, coloredReqID))
+		log := m.logger.WithContext(r.Context())
+		if m.logger.IsLevelEnabled(logrus.DebugLevel) {
+			log.WithFields(logrus.Fields{
+				"method":  r.Method,
+				"url":     redactedURL(r),
+				"headers": redactedHeaders(r.Header),
+			}).Debug("Request started")
+		}
+
 		start := time.Now()
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		defer func() {
-			result := "failed"
-			color := "\033[31m"
 			duration := time.Since(start)
+			observeRequest(r, rw, duration)
 
-			if rw.finished {
-				result = "successfully"
-				color = "\033[32m"
-			}
+			entry := log.WithFields(logrus.Fields{
+				"method":      r.Method,
+				"url":         redactedURL(r),
+				"route":       r.Pattern,
+				"status":      rw.statusCode,
+				"duration_ms": float64(duration.Microseconds()) / 1000,
+				"bytes":       rw.written,
+				"remote_addr": r.RemoteAddr,
+				"client_ip":   clientip.ClientIP(r),
+				"user_agent":  r.UserAgent(),
+			})
 
-			m.logger.Infof("[END]\n\tReqID=%s\n\tStatus=%d\n\tDuration=%s\n\tResult=%s%s\033[0m\n",
-				coloredReqID,
-				rw.statusCode,
-				duration,
-				color,
-				result,
-			)
+			if rw.statusCode >= http.StatusInternalServerError {
+				entry.Error("Request finished")
+			} else {
+				entry.Info("Request finished")
+			}
 		}()
 
 		next.ServeHTTP(rw, r)
 	}
 }
 
-func requestInfo(r *http.Request, coloredReqID string) string {
-	return fmt.Sprintf(
-		"[START]\n\tReqID=%s\n\tMethod=%s\n\tURL=%s\n\tRemoteAddr=%s\n\tUserAgent=%s\n\tHeaders=%v\n",
-		coloredReqID,
-		r.Method,
-		r.URL.String(),
-		r.RemoteAddr,
-		r.UserAgent(),
-		r.Header,
-	)
+// redactedHeaders flattens headers for logging with credentials hidden
+func redactedHeaders(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			result[key] = "REDACTED"
+			continue
+		}
+
+		result[key] = strings.Join(values, ", ")
+	}
+
+	return result
+}
+
+// credentials passed in url, see AccessTokenQueryMiddleware, oidc callback and share links
+var (
+	sensitiveQueryParams  = []string{AccessTokenQueryParam, "code", "state"}
+	sensitivePathPrefixes = []string{"/api/download/shared/"}
+)
+
+// redactedURL hides credentials in url
+func redactedURL(r *http.Request) string {
+	u := *r.URL
+	for _, prefix := range sensitivePathPrefixes {
+		if strings.HasPrefix(u.Path, prefix) && len(u.Path) > len(prefix) {
+			u.Path = prefix + "REDACTED"
+			u.RawPath = ""
+		}
+	}
+
+	query := u.Query()
+	for _, param := range sensitiveQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	return u.String()
+}
+
+// observeRequest records request in metrics, route is the matched pattern so ids in paths do not become labels
+func observeRequest(r *http.Request, rw *responseWriter, duration time.Duration) {
+	route := r.Pattern
+	if route == "" || route == "/" {
+		route = metrics.UnmatchedRoute
+	}
+	method := r.Method
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "OTHER"
+	}
+	status := strconv.Itoa(rw.statusCode)
+
+	metrics.HTTPRequests.WithLabelValues(route, method, status).Inc()
+	metrics.HTTPDuration.WithLabelValues(route, method, status).Observe(duration.Seconds())
+	metrics.HTTPResponseBytes.WithLabelValues(route).Add(float64(rw.written))
 }
 
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
-	finished   bool
+	written    int64
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.written += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps sendfile of underlying writer used by http.ServeFile
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(rw.ResponseWriter, src)
+	}
+
+	rw.written += n
+	return n, err
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
-	rw.finished = true
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func randomColorOfReqID() string {
-	colors := []string{
-		ColorRed,
-		ColorGreen,
-		ColorYellow,
-		ColorBlue,
-		ColorMagenta,
-		ColorCyan,
-	}
-	return colors[randomizer.Intn(len(colors))]
-}
\ No newline at end of file
+// Unwrap lets http.ResponseController reach Flush of underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/ayayaakasvin/lightmux"
+)
+
+// RequireStaticToken lets through requests carrying token as Bearer, e.g. scrapes of /metrics. Empty token disables the check
+func (m *Middlewares) RequireStaticToken(token string) lightmux.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if token != "" {
+				got, ok := bearerToken(r)
+				if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+					unauthorized(w, "invalid token")
+					return
+				}
+			}
+
+			next(w, r)
+		}
+	}
+}
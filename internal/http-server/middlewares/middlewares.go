@@ -9,18 +9,26 @@ import (
 )
 
 type Middlewares struct {
-	cache  models.Cache
-	logger *logrus.Logger
+	cache   models.Cache
+	apiKeys models.APIKeyRepository
+	users   models.UserRepository
+	logger  *logrus.Logger
+
+	certUserField string // field of client certificate naming user
 
 	allowed_origins []string
 	allowed_headers string
 	allowed_methods string
 }
 
-func NewHTTPMiddlewares(logger *logrus.Logger, cache models.Cache, cfg config.CORSConfig) *Middlewares {
+func NewHTTPMiddlewares(logger *logrus.Logger, cache models.Cache, apiKeys models.APIKeyRepository, users models.UserRepository, cfg config.CORSConfig, clientAuth config.ClientAuthConfig) *Middlewares {
 	return &Middlewares{
-		logger: logger,
-		cache:  cache,
+		logger:  logger,
+		cache:   cache,
+		apiKeys: apiKeys,
+		users:   users,
+
+		certUserField: clientAuth.UserField,
 
 		allowed_origins: cfg.AllowedOrigins,
 		allowed_headers: strings.Join(cfg.AllowedHeaders, ", "),
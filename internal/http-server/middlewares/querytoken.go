@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+)
+
+// AccessTokenQueryParam carries token for clients unable to set headers, e.g. browser EventSource
+const AccessTokenQueryParam = "access_token"
+
+// AccessTokenQueryMiddleware moves access_token query param into Authorization header when header is absent,
+// param is removed from url so it does not reach handlers
+func (m *Middlewares) AccessTokenQueryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if token := query.Get(AccessTokenQueryParam); token != "" {
+			r = r.Clone(r.Context())
+			if r.Header.Get(AuthorizationHeader) == "" {
+				r.Header.Set(AuthorizationHeader, "Bearer "+token)
+			}
+
+			query.Del(AccessTokenQueryParam)
+			r.URL.RawQuery = query.Encode()
+		}
+
+		next(w, r)
+	}
+}
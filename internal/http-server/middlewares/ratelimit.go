@@ -2,10 +2,11 @@ package middlewares
 
 import (
 	"fmt"
-	"net"
 	"net/http"
 	"time"
 	"up-down-server/internal/http-server/ctx"
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/metrics"
 	"up-down-server/internal/models"
 )
 
@@ -16,17 +17,16 @@ const (
 	ratelimitformatstring = "ratelimit:%d/%s" // where %d is ip -> plan is like SET: ratelimitformatstring -> true
 )
 
+// RateLimitKeysOf is pattern matching request limits of user from every ip
+func RateLimitKeysOf(userId int) string {
+	return fmt.Sprintf("ratelimit:%d/*", userId)
+}
+
 func (m *Middlewares) RateLimitMiddleware(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userId := r.Context().Value(ctx.CtxUserIDKey).(int)
 
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			models.SendErrorJson(w, http.StatusInternalServerError, "invalid remote address")
-			return
-		}
-
-		key := fmt.Sprintf(ratelimitformatstring, userId, ip)
+		key := fmt.Sprintf(ratelimitformatstring, userId, clientip.ClientIP(r))
 		set := m.cache.SetNX(r.Context(), key, "1", expTimeForRateLimit);
 		if err := set.Err(); err != nil {
 			models.SendErrorJson(w, http.StatusInternalServerError, "cache error")
@@ -34,6 +34,7 @@ func (m *Middlewares) RateLimitMiddleware(h http.HandlerFunc) http.HandlerFunc {
 		}
 
 		if !set.Val() {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimiterRequests).Inc()
 			models.SendErrorJson(w, http.StatusTooManyRequests, "rate limit")
 			return
 		}
@@ -1,7 +1,6 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 )
@@ -10,8 +9,7 @@ func (mw *Middlewares) RecoverMiddleware(next http.HandlerFunc) http.HandlerFunc
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				msg := fmt.Sprintf("panic recovered: %v", rec)
-				mw.logger.Errorf("%s%s\n%s", ColorRed, msg, debug.Stack())
+				mw.logger.WithContext(r.Context()).WithField("stack", string(debug.Stack())).Errorf("panic recovered: %v", rec)
 
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
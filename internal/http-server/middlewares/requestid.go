@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"up-down-server/internal/http-server/ctx"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware puts id of request into ctx and response, id set by client or proxy is kept when it looks sane
+func (m *Middlewares) RequestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = uuid.New().String()
+		}
+
+		w.Header().Set(RequestIDHeader, requestId)
+		next(w, ctx.WrapValueIntoRequest(r, ctx.CtxRequestIDKey, requestId))
+	}
+}
+
+// validRequestID accepts ids safe to echo and log, e.g. uuids and ids of load balancers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
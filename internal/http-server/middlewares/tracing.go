@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"up-down-server/internal/lib/clientip"
+	"up-down-server/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts server span of request, continuing trace of caller passed in traceparent header.
+// Span is named after matched route once handler is done, so ids in paths do not make every name unique
+func (m *Middlewares) TracingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		c, span := tracing.Tracer().Start(c, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.ClientAddress(clientip.ClientIP(r)),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		))
+		defer span.End()
+
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		r = r.WithContext(c)
+		next.ServeHTTP(rw, r)
+
+		if r.Pattern != "" && r.Pattern != "/" {
+			span.SetName(fmt.Sprintf("%s %s", r.Method, r.Pattern))
+			span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rw.statusCode))
+		if rw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rw.statusCode))
+		}
+	}
+}
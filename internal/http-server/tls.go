@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/http-server/middlewares"
+	"up-down-server/internal/lib/certreload"
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// setupTLS makes server serve HTTPS with certificate reloaded from disk
+func (s *ServerApp) setupTLS() error {
+	cfg := s.cfg.TLS
+
+	reloader, err := certreload.New(cfg.CertFile, cfg.KeyFile, s.logger)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return fmt.Errorf("unsupported tls min_version %q, use 1.2 or 1.3", cfg.MinVersion)
+	}
+
+	ciphers, err := cipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if err := setupClientAuth(tlsConfig, cfg.ClientAuth); err != nil {
+		return err
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2)
+
+	s.server.TLSConfig = tlsConfig
+	s.server.Protocols = protocols
+	s.certs = reloader
+
+	return nil
+}
+
+// cipherSuites maps names to ids, suites known to be insecure are refused. TLS 1.3 suites are not configurable
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func setupClientAuth(tlsConfig *tls.Config, cfg config.ClientAuthConfig) error {
+	switch cfg.Mode {
+	case "", ClientAuthNone:
+		return nil
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("unknown client_auth mode %q", cfg.Mode)
+	}
+
+	switch cfg.UserField {
+	case "", middlewares.CertUserCommonName, middlewares.CertUserEmail:
+	default:
+		return fmt.Errorf("unknown client_auth user_field %q, expected %s or %s", cfg.UserField, middlewares.CertUserCommonName, middlewares.CertUserEmail)
+	}
+
+	if cfg.CAFile == "" {
+		return errors.New("client_auth requires ca_file")
+	}
+
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client ca: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", cfg.CAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	return nil
+}
+
+// redirectServer answers plain http with permanent redirect to https on port of main server
+func (s *ServerApp) redirectServer() *http.Server {
+	_, port, _ := net.SplitHostPort(s.cfg.Address)
+
+	return &http.Server{
+		Addr:              s.cfg.TLS.RedirectAddress,
+		ReadHeaderTimeout: s.cfg.Timeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			if port != "" && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+
+			// 308 keeps method and body, 301 is understood by older clients for plain navigation
+			code := http.StatusPermanentRedirect
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				code = http.StatusMovedPermanently
+			}
+
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+		}),
+	}
+}
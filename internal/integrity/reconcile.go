@@ -0,0 +1,182 @@
+package integrity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReconcileJob is kind of job running Reconciler
+const ReconcileJob = "integrity.reconcile"
+
+// DefaultGracePeriod protects uploads in flight: their blob may already exist while record is not inserted yet
+const DefaultGracePeriod = time.Hour
+
+// DefaultMaxOrphanRatio is share of records allowed to be missing blobs before repair is refused,
+// so misconfigured storage directory does not wipe every record
+const DefaultMaxOrphanRatio = 0.5
+
+// ReconcileReport lists inconsistencies between db and storage, and whether they were repaired
+type ReconcileReport struct {
+	DryRun     bool     `json:"dry_run"`
+	OrphanRows []string `json:"orphan_rows,omitempty"` // records without blob
+	StrayBlobs []string `json:"stray_blobs,omitempty"` // blobs without record
+	StaleTemp  []string `json:"stale_temp,omitempty"`  // unfinished uploads
+	Repaired   int      `json:"repaired"`
+	Failed     int      `json:"failed,omitempty"`
+	Refused    string   `json:"refused,omitempty"` // why orphan rows were not deleted
+}
+
+// Reconciler finds and removes orphaned records and stray blobs
+type Reconciler struct {
+	repo    models.FileMetaRepository
+	storage models.FileStorage
+	logger  *logrus.Logger
+
+	grace          time.Duration
+	maxOrphanRatio float64
+}
+
+func NewReconciler(repo models.FileMetaRepository, storage models.FileStorage, logger *logrus.Logger, grace time.Duration, maxOrphanRatio float64) *Reconciler {
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+
+	if maxOrphanRatio <= 0 || maxOrphanRatio > 1 {
+		maxOrphanRatio = DefaultMaxOrphanRatio
+	}
+
+	return &Reconciler{
+		repo:           repo,
+		storage:        storage,
+		logger:         logger,
+		grace:          grace,
+		maxOrphanRatio: maxOrphanRatio,
+	}
+}
+
+// ReconcilePayload is payload of ReconcileJob
+type ReconcilePayload struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// RunJob is jobs.Handler running single reconciliation
+func (rc *Reconciler) RunJob(ctx context.Context, payload json.RawMessage) error {
+	var p ReconcilePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	_, err := rc.Reconcile(ctx, p.DryRun)
+	return err
+}
+
+// Reconcile compares records with blobs, when dryRun is set nothing is changed
+func (rc *Reconciler) Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	// blobs are listed before records, so blob committed between the two reads is not reported as stray
+	blobs, err := rc.storage.List()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := rc.repo.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{DryRun: dryRun}
+	known := make(map[string]struct{}, len(records))
+	cutoff := time.Now().Add(-rc.grace)
+
+	for _, record := range records {
+		known[record.FileUUID] = struct{}{}
+
+		// blob is looked up where storage keeps it now, path stored at upload may be relative to another cwd or dir
+		path := rc.storage.Path(record.FileUUID)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			report.OrphanRows = append(report.OrphanRows, record.FileUUID)
+		} else if err != nil {
+			rc.logger.Errorf("Failed to stat %s: %v", path, err)
+			report.Failed++
+		}
+	}
+
+	if reason := rc.refuseOrphanRepair(len(report.OrphanRows), len(records)); reason != "" {
+		report.Refused = reason
+		rc.logger.Errorf("Orphan rows are not deleted: %s", reason)
+	} else {
+		for _, uuid := range report.OrphanRows {
+			rc.repair(report, dryRun, func() error {
+				return rc.repo.DeleteFileByUUID(ctx, uuid)
+			})
+		}
+	}
+
+	for _, blob := range blobs {
+		if blob.ModTime.After(cutoff) {
+			continue
+		}
+
+		switch {
+		case blob.Temp:
+			report.StaleTemp = append(report.StaleTemp, blob.Name)
+		default:
+			if _, ok := known[blob.Name]; ok {
+				continue
+			}
+			report.StrayBlobs = append(report.StrayBlobs, blob.Name)
+		}
+
+		rc.repair(report, dryRun, func() error {
+			return rc.storage.Remove(blob.Name)
+		})
+	}
+
+	rc.logger.WithFields(logrus.Fields{
+		"dry_run":     dryRun,
+		"orphan_rows": len(report.OrphanRows),
+		"stray_blobs": len(report.StrayBlobs),
+		"stale_temp":  len(report.StaleTemp),
+		"repaired":    report.Repaired,
+		"failed":      report.Failed,
+	}).Info("Reconciliation finished")
+
+	return report, nil
+}
+
+// refuseOrphanRepair explains why so many records are missing blobs that storage is more likely misconfigured than damaged
+func (rc *Reconciler) refuseOrphanRepair(orphans, records int) string {
+	if orphans == 0 {
+		return ""
+	}
+
+	if orphans == records {
+		return fmt.Sprintf("every one of %d records is missing its blob, check storage directory", records)
+	}
+
+	if ratio := float64(orphans) / float64(records); ratio > rc.maxOrphanRatio {
+		return fmt.Sprintf("%d of %d records are missing blobs, more than allowed share of %.2f", orphans, records, rc.maxOrphanRatio)
+	}
+
+	return ""
+}
+
+func (rc *Reconciler) repair(report *ReconcileReport, dryRun bool, fix func() error) {
+	if dryRun {
+		return
+	}
+
+	if err := fix(); err != nil {
+		rc.logger.Errorf("Reconciliation repair failed: %v", err)
+		report.Failed++
+		return
+	}
+
+	report.Repaired++
+}
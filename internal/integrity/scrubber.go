@@ -0,0 +1,134 @@
+// Integrity checks between metadata stored in db and blobs stored on disk
+package integrity
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"up-down-server/internal/lib/checksum"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ScrubJob is kind of job running Scrubber
+const ScrubJob = "integrity.scrub"
+
+// ScrubReport is result of a single scrub pass
+type ScrubReport struct {
+	Checked    int      `json:"checked"`
+	Corrupted  []string `json:"corrupted,omitempty"`  // uuids of files with checksum mismatch
+	Missing    []string `json:"missing,omitempty"`    // uuids of files absent on disk
+	Backfilled int      `json:"backfilled,omitempty"` // files that had no checksum before
+	Failed     int      `json:"failed,omitempty"`     // files that could not be checked
+}
+
+// Scrubber re-hashes stored blobs and flags mismatches in db, owners are notified when status of file changes
+type Scrubber struct {
+	repo      models.FileMetaRepository
+	storage   models.FileStorage
+	publisher models.EventPublisher // optional
+	logger    *logrus.Logger
+}
+
+func NewScrubber(repo models.FileMetaRepository, storage models.FileStorage, publisher models.EventPublisher, logger *logrus.Logger) *Scrubber {
+	return &Scrubber{
+		repo:      repo,
+		storage:   storage,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+// RunJob is jobs.Handler running single scrub pass
+func (s *Scrubber) RunJob(ctx context.Context, _ json.RawMessage) error {
+	_, err := s.Scrub(ctx)
+	return err
+}
+
+// Scrub checks every file record once
+func (s *Scrubber) Scrub(ctx context.Context) (*ScrubReport, error) {
+	records, err := s.repo.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(ScrubReport)
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		report.Checked++
+
+		var (
+			sum    string
+			status string
+		)
+
+		// blob is read where storage keeps it now, path stored at upload may be relative to another cwd or dir
+		computed, err := checksum.SumFile(s.storage.Path(record.FileUUID))
+		switch {
+		case os.IsNotExist(err):
+			status = models.IntegrityMissing
+		case err != nil:
+			s.logger.Errorf("Failed to hash %s: %v", record.FileUUID, err)
+			report.Failed++
+			continue
+		case record.SHA256 == "":
+			sum, status = computed, models.IntegrityOK
+		case record.SHA256 != computed:
+			status = models.IntegrityCorrupted
+		default:
+			status = models.IntegrityOK
+		}
+
+		if err := s.repo.UpdateIntegrity(ctx, record.FileUUID, sum, status); err != nil {
+			// file deleted while scrub was running, its blob is gone for a good reason
+			if err.Error() == postgresql.NotFound {
+				report.Checked--
+				continue
+			}
+
+			s.logger.Errorf("Failed to update integrity of %s: %v", record.FileUUID, err)
+			report.Failed++
+			continue
+		}
+
+		switch {
+		case status == models.IntegrityMissing:
+			report.Missing = append(report.Missing, record.FileUUID)
+		case status == models.IntegrityCorrupted:
+			report.Corrupted = append(report.Corrupted, record.FileUUID)
+		case sum != "":
+			report.Backfilled++
+		}
+
+		if s.publisher != nil && status != record.IntegrityStatus {
+			s.publisher.Publish(ctx, record.UserID, models.EventFileIntegrity, map[string]any{
+				"file_id":          record.FileUUID,
+				"file_name":        record.FileName,
+				"integrity_status": status,
+				"previous_status":  record.IntegrityStatus,
+			})
+		}
+	}
+
+	entry := s.logger.WithFields(logrus.Fields{
+		"checked":    report.Checked,
+		"corrupted":  len(report.Corrupted),
+		"missing":    len(report.Missing),
+		"backfilled": report.Backfilled,
+		"failed":     report.Failed,
+	})
+
+	if len(report.Corrupted) > 0 || len(report.Missing) > 0 {
+		entry.Warnf("Integrity scrub found damaged files: corrupted=%v missing=%v", report.Corrupted, report.Missing)
+	} else {
+		entry.Info("Integrity scrub finished")
+	}
+
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"up-down-server/internal/lib/checksum"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/sirupsen/logrus"
+)
+
+type dirStorage struct {
+	models.FileStorage
+	dir string
+}
+
+func (s dirStorage) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+type fakeFiles struct {
+	models.FileMetaRepository
+
+	records []*models.FileMetaData
+	deleted map[string]bool // deleted while scrub is running
+	status  map[string]string
+}
+
+func (f *fakeFiles) GetAllRecords(ctx context.Context) ([]*models.FileMetaData, error) {
+	return f.records, nil
+}
+
+func (f *fakeFiles) UpdateIntegrity(ctx context.Context, uuidOfFile, sum, status string) error {
+	if f.deleted[uuidOfFile] {
+		return errors.New(postgresql.NotFound)
+	}
+	f.status[uuidOfFile] = status
+	return nil
+}
+
+func TestScrubReadsBlobsThroughStorage(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := checksum.SumFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	okSum := write("ok", "intact")
+	write("corrupted", "changed on disk")
+	write("legacy", "uploaded before checksums")
+
+	// stored path is relative to working directory of older deployment and points nowhere now
+	stale := func(uuid, sum string) *models.FileMetaData {
+		return &models.FileMetaData{FileUUID: uuid, FilePath: "./files/" + uuid, SHA256: sum, IntegrityStatus: models.IntegrityOK}
+	}
+
+	repo := &fakeFiles{
+		records: []*models.FileMetaData{
+			stale("ok", okSum),
+			stale("corrupted", okSum),
+			stale("legacy", ""),
+			stale("missing", okSum),
+			stale("deleted", okSum),
+		},
+		deleted: map[string]bool{"deleted": true},
+		status:  make(map[string]string),
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	report, err := NewScrubber(repo, dirStorage{dir: dir}, nil, logger).Scrub(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"ok":        models.IntegrityOK,
+		"corrupted": models.IntegrityCorrupted,
+		"legacy":    models.IntegrityOK,
+		"missing":   models.IntegrityMissing,
+	}
+	for uuid, status := range expected {
+		if repo.status[uuid] != status {
+			t.Errorf("%s: expected %s, got %s", uuid, status, repo.status[uuid])
+		}
+	}
+
+	if report.Checked != 4 || report.Backfilled != 1 || report.Failed != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "missing" {
+		t.Errorf("file deleted during scrub is reported, missing: %v", report.Missing)
+	}
+}
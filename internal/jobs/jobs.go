@@ -0,0 +1,421 @@
+// Background jobs backed by postgres queue, every instance runs a pool of workers claiming jobs with SKIP LOCKED
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultTimeout     = 30 * time.Minute
+	defaultPoll        = 5 * time.Second
+	maintenanceEvery   = time.Minute
+)
+
+// Handler executes a single job, returned error schedules retry
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Options of registered job kind
+type Options struct {
+	MaxAttempts int           // attempts before job is marked failed, default 5
+	Concurrency int           // jobs of this kind run at once on one instance, default 1
+	Timeout     time.Duration // default 30m
+}
+
+type kind struct {
+	handler Handler
+	opts    Options
+	slots   chan struct{}
+}
+
+// Runner claims and executes queued jobs and fires recurring schedules
+type Runner struct {
+	repo   models.JobRepository
+	cfg    config.JobsConfig
+	logger *logrus.Logger
+
+	workerID  string
+	kinds     map[string]*kind
+	schedules []*models.JobSchedule
+	wake      chan struct{}
+}
+
+func NewRunner(repo models.JobRepository, cfg config.JobsConfig, logger *logrus.Logger) *Runner {
+	host, _ := os.Hostname()
+
+	// zero interval would make tickers panic and idle workers spin
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPoll
+	}
+
+	return &Runner{
+		repo:     repo,
+		cfg:      cfg,
+		logger:   logger,
+		workerID: fmt.Sprintf("%s/%s", host, uuid.New().String()[:8]),
+		kinds:    make(map[string]*kind),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Every is a spec for schedule firing each d, empty spec when d is not positive
+func Every(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	return "@every " + d.String()
+}
+
+// Register adds handler for job kind, must be called before Start
+func (r *Runner) Register(name string, handler Handler, opts Options) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	r.kinds[name] = &kind{
+		handler: handler,
+		opts:    opts,
+		slots:   make(chan struct{}, opts.Concurrency),
+	}
+}
+
+// Schedule makes job of registered kind recurring, spec is standard 5 field cron or descriptor like @hourly, @every 1h.
+// Empty spec disables schedule. Must be called before Start.
+func (r *Runner) Schedule(name, spec, kindName string, payload any) error {
+	if spec == "" {
+		r.logger.Warnf("Schedule %s is disabled", name)
+		return nil
+	}
+
+	k, ok := r.kinds[kindName]
+	if !ok {
+		return fmt.Errorf("job kind %s is not registered", kindName)
+	}
+
+	next, err := nextRun(spec, time.Now())
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	r.schedules = append(r.schedules, &models.JobSchedule{
+		Name:        name,
+		Kind:        kindName,
+		Spec:        spec,
+		Payload:     raw,
+		MaxAttempts: k.opts.MaxAttempts,
+		NextRunAt:   next,
+	})
+
+	return nil
+}
+
+// Enqueue adds job to be run as soon as possible
+func (r *Runner) Enqueue(ctx context.Context, kindName string, payload any) (int64, error) {
+	return r.EnqueueAt(ctx, kindName, payload, time.Now())
+}
+
+// EnqueueAt adds job to be run not earlier than runAt
+func (r *Runner) EnqueueAt(ctx context.Context, kindName string, payload any, runAt time.Time) (int64, error) {
+	k, ok := r.kinds[kindName]
+	if !ok {
+		return 0, fmt.Errorf("job kind %s is not registered", kindName)
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := r.repo.EnqueueJob(ctx, &models.Job{
+		Kind:        kindName,
+		Payload:     raw,
+		MaxAttempts: k.opts.MaxAttempts,
+		RunAt:       runAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+
+	return id, nil
+}
+
+// Start registers schedules and runs workers until ctx is done, blocks till every running job returns
+func (r *Runner) Start(ctx context.Context) {
+	for _, schedule := range r.schedules {
+		if err := r.repo.UpsertSchedule(ctx, schedule); err != nil {
+			r.logger.Errorf("Failed to register schedule %s: %v", schedule.Name, err)
+		}
+	}
+
+	workers := r.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.maintain(ctx)
+	}()
+
+	r.logger.Infof("Job runner %s started with %d workers", r.workerID, workers)
+	wg.Wait()
+	r.logger.Info("Job runner stopped")
+}
+
+func (r *Runner) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := r.runOne(ctx)
+		if err != nil {
+			r.logger.Errorf("Job worker error: %v", err)
+		}
+
+		if claimed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-r.wake:
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// runOne claims job of a kind with free slot and executes it, reports whether job was found
+func (r *Runner) runOne(ctx context.Context) (bool, error) {
+	var acquired []string
+	for name, k := range r.kinds {
+		select {
+		case k.slots <- struct{}{}:
+			acquired = append(acquired, name)
+		default:
+		}
+	}
+
+	release := func(except string) {
+		for _, name := range acquired {
+			if name != except {
+				<-r.kinds[name].slots
+			}
+		}
+	}
+
+	if len(acquired) == 0 {
+		return false, nil
+	}
+
+	job, err := r.repo.ClaimJob(ctx, acquired, r.workerID)
+	if err != nil || job == nil {
+		release("")
+		return false, err
+	}
+
+	release(job.Kind)
+	defer func() { <-r.kinds[job.Kind].slots }()
+
+	r.execute(ctx, job)
+	return true, nil
+}
+
+func (r *Runner) execute(ctx context.Context, job *models.Job) {
+	k := r.kinds[job.Kind]
+	entry := r.logger.WithFields(logrus.Fields{
+		"job_id":  job.ID,
+		"kind":    job.Kind,
+		"attempt": job.Attempts,
+	})
+
+	jobCtx, cancel := context.WithTimeout(ctx, k.opts.Timeout)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		r.heartbeat(jobCtx, job.ID, entry)
+	}()
+
+	start := time.Now()
+	err := safeCall(jobCtx, k.handler, job.Payload)
+	cancel()
+	<-heartbeatDone
+
+	// job state is saved even when runner is stopping
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+
+	if err == nil {
+		if err := r.repo.CompleteJob(saveCtx, job.ID, r.workerID); err != nil {
+			r.saveFailed(entry, "Failed to complete job", err)
+			return
+		}
+		entry.Infof("Job succeeded in %s", time.Since(start))
+		return
+	}
+
+	// job cut off by shutdown did not fail, it goes back to queue without using an attempt
+	if ctx.Err() != nil {
+		if err := r.repo.ReleaseJob(saveCtx, job.ID, r.workerID); err != nil {
+			entry.Errorf("Failed to release interrupted job: %v", err)
+		}
+		entry.Warnf("Job interrupted by shutdown, returned to queue: %v", err)
+		return
+	}
+
+	var retryAt *time.Time
+	if job.Attempts < job.MaxAttempts {
+		at := time.Now().Add(r.backoff(job.Attempts))
+		retryAt = &at
+	}
+
+	if err := r.repo.FailJob(saveCtx, job.ID, r.workerID, err.Error(), retryAt); err != nil {
+		r.saveFailed(entry, "Failed to save job failure", err)
+		return
+	}
+
+	if retryAt != nil {
+		entry.Warnf("Job failed, retry at %s: %v", retryAt.Format(time.RFC3339), err)
+	} else {
+		entry.Errorf("Job failed, no attempts left: %v", err)
+	}
+}
+
+// saveFailed logs failure to save result of job, job taken over by another worker is not an error of this one
+func (r *Runner) saveFailed(entry *logrus.Entry, msg string, err error) {
+	if err.Error() == postgresql.NotFound {
+		entry.Warn("Job is no longer held by this worker, e.g. it was requeued as stale, result is discarded")
+		return
+	}
+
+	entry.Errorf("%s: %v", msg, err)
+}
+
+// heartbeat refreshes lock of job until ctx is done, so maintenance of any instance
+// does not requeue job that runs longer than StaleAfter
+func (r *Runner) heartbeat(ctx context.Context, jobID int64, entry *logrus.Entry) {
+	every := r.cfg.StaleAfter / 3
+	if every <= 0 {
+		every = time.Minute
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.repo.TouchJob(ctx, jobID, r.workerID); err != nil && ctx.Err() == nil {
+				entry.Errorf("Failed to refresh job lock: %v", err)
+			}
+		}
+	}
+}
+
+// backoff grows exponentially from RetryBase up to RetryMax with +-20% jitter
+func (r *Runner) backoff(attempt int) time.Duration {
+	delay := r.cfg.RetryBase
+	for i := 1; i < attempt && delay < r.cfg.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > r.cfg.RetryMax {
+		delay = r.cfg.RetryMax
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/5*2+1)) - delay/5
+	return delay + jitter
+}
+
+// maintain fires due schedules, returns jobs of dead workers to queue and purges old finished jobs
+func (r *Runner) maintain(ctx context.Context) {
+	fire := time.NewTicker(r.cfg.PollInterval)
+	defer fire.Stop()
+	cleanup := time.NewTicker(maintenanceEvery)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-fire.C:
+			n, err := r.repo.FireDueSchedules(ctx, nextRun)
+			if err != nil {
+				r.logger.Errorf("Failed to fire schedules: %v", err)
+			}
+			if n > 0 {
+				select {
+				case r.wake <- struct{}{}:
+				default:
+				}
+			}
+		case <-cleanup.C:
+			if n, err := r.repo.RequeueStaleJobs(ctx, time.Now().Add(-r.cfg.StaleAfter)); err != nil {
+				r.logger.Errorf("Failed to requeue stale jobs: %v", err)
+			} else if n > 0 {
+				r.logger.Warnf("Requeued %d jobs of lost workers", n)
+			}
+
+			if _, err := r.repo.PurgeFinishedJobs(ctx, time.Now().Add(-r.cfg.Retention)); err != nil {
+				r.logger.Errorf("Failed to purge finished jobs: %v", err)
+			}
+		}
+	}
+}
+
+func nextRun(spec string, from time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(from), nil
+}
+
+func safeCall(ctx context.Context, handler Handler, payload json.RawMessage) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %v", rec)
+		}
+	}()
+
+	return handler(ctx, payload)
+}
@@ -0,0 +1,243 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeJobs records how runner saves results, jobs are claimed from queue
+type fakeJobs struct {
+	models.JobRepository
+
+	mu       sync.Mutex
+	queue    []*models.Job
+	done     map[int64]string // job id -> worker id
+	failed   map[int64]*time.Time
+	released map[int64]string
+	saveErr  error
+}
+
+func newFakeJobs(jobs ...*models.Job) *fakeJobs {
+	return &fakeJobs{
+		queue:    jobs,
+		done:     make(map[int64]string),
+		failed:   make(map[int64]*time.Time),
+		released: make(map[int64]string),
+	}
+}
+
+func (f *fakeJobs) ClaimJob(ctx context.Context, kinds []string, workerID string) (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.queue) == 0 {
+		return nil, nil
+	}
+
+	job := f.queue[0]
+	f.queue = f.queue[1:]
+	job.Attempts++
+	job.LockedBy = workerID
+	return job, nil
+}
+
+func (f *fakeJobs) CompleteJob(ctx context.Context, jobID int64, workerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.saveErr != nil {
+		return f.saveErr
+	}
+	f.done[jobID] = workerID
+	return nil
+}
+
+func (f *fakeJobs) FailJob(ctx context.Context, jobID int64, workerID, errMsg string, retryAt *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.saveErr != nil {
+		return f.saveErr
+	}
+	f.failed[jobID] = retryAt
+	return nil
+}
+
+func (f *fakeJobs) ReleaseJob(ctx context.Context, jobID int64, workerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.released[jobID] = workerID
+	return nil
+}
+
+func (f *fakeJobs) TouchJob(ctx context.Context, jobID int64, workerID string) error {
+	return nil
+}
+
+func (f *fakeJobs) FireDueSchedules(ctx context.Context, next func(spec string, from time.Time) (time.Time, error)) (int, error) {
+	return 0, nil
+}
+
+var testConfig = config.JobsConfig{
+	Workers:      1,
+	PollInterval: 10 * time.Millisecond,
+	StaleAfter:   time.Minute,
+	RetryBase:    time.Second,
+	RetryMax:     time.Minute,
+}
+
+func newTestRunner(repo *fakeJobs, cfg config.JobsConfig) *Runner {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return NewRunner(repo, cfg, logger)
+}
+
+func testJob(id int64, maxAttempts int) *models.Job {
+	return &models.Job{ID: id, Kind: "test", Payload: json.RawMessage("{}"), MaxAttempts: maxAttempts}
+}
+
+func runNext(t *testing.T, r *Runner, ctx context.Context) {
+	t.Helper()
+
+	claimed, err := r.runOne(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("no job is claimed")
+	}
+}
+
+func TestSucceededJobIsCompletedByItsWorker(t *testing.T) {
+	repo := newFakeJobs(testJob(1, 3))
+	r := newTestRunner(repo, testConfig)
+	r.Register("test", func(ctx context.Context, payload json.RawMessage) error { return nil }, Options{})
+
+	runNext(t, r, t.Context())
+
+	if worker, ok := repo.done[1]; !ok || worker != r.workerID {
+		t.Errorf("job is not completed by worker %s, got %q", r.workerID, worker)
+	}
+}
+
+func TestFailedJobIsRetried(t *testing.T) {
+	repo := newFakeJobs(testJob(1, 2))
+	r := newTestRunner(repo, testConfig)
+	r.Register("test", func(ctx context.Context, payload json.RawMessage) error { return errors.New("boom") }, Options{})
+
+	// first attempt is retried after backoff
+	runNext(t, r, t.Context())
+	retryAt, ok := repo.failed[1]
+	if !ok || retryAt == nil {
+		t.Fatal("failed job is not scheduled for retry")
+	}
+	if time.Until(*retryAt) < testConfig.RetryBase/2 {
+		t.Errorf("retry is scheduled too early: %s", retryAt)
+	}
+
+	// last attempt fails for good
+	repo.queue = append(repo.queue, testJob(2, 1))
+	runNext(t, r, t.Context())
+	if retryAt, ok := repo.failed[2]; !ok || retryAt != nil {
+		t.Errorf("job without attempts left is retried at %v", retryAt)
+	}
+}
+
+func TestPanickedJobFails(t *testing.T) {
+	repo := newFakeJobs(testJob(1, 1))
+	r := newTestRunner(repo, testConfig)
+	r.Register("test", func(ctx context.Context, payload json.RawMessage) error { panic("boom") }, Options{})
+
+	runNext(t, r, t.Context())
+
+	if _, ok := repo.failed[1]; !ok {
+		t.Error("panicked job is not failed")
+	}
+}
+
+func TestInterruptedJobIsReleased(t *testing.T) {
+	repo := newFakeJobs(testJob(1, 3))
+	r := newTestRunner(repo, testConfig)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	r.Register("test", func(jobCtx context.Context, payload json.RawMessage) error {
+		cancel()
+		<-jobCtx.Done()
+		return jobCtx.Err()
+	}, Options{})
+
+	runNext(t, r, ctx)
+
+	if worker, ok := repo.released[1]; !ok || worker != r.workerID {
+		t.Errorf("interrupted job is not released by worker %s, got %q", r.workerID, worker)
+	}
+	if _, ok := repo.failed[1]; ok {
+		t.Error("interrupted job spent an attempt")
+	}
+}
+
+func TestResultOfLostJobIsDiscarded(t *testing.T) {
+	repo := newFakeJobs(testJob(1, 3))
+	repo.saveErr = errors.New(postgresql.NotFound)
+	r := newTestRunner(repo, testConfig)
+	r.Register("test", func(ctx context.Context, payload json.RawMessage) error { return nil }, Options{})
+
+	runNext(t, r, t.Context())
+
+	if len(repo.done) != 0 {
+		t.Errorf("result of job held by other worker is saved: %v", repo.done)
+	}
+	if len(r.kinds["test"].slots) != 0 {
+		t.Error("slot of job kind is not freed")
+	}
+}
+
+func TestZeroPollIntervalIsDefaulted(t *testing.T) {
+	cfg := testConfig
+	cfg.PollInterval = 0
+
+	r := newTestRunner(newFakeJobs(), cfg)
+	if r.cfg.PollInterval != defaultPoll {
+		t.Fatalf("expected poll interval %s, got %s", defaultPoll, r.cfg.PollInterval)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	r.Start(ctx)
+}
+
+func TestBackoffIsBounded(t *testing.T) {
+	r := newTestRunner(newFakeJobs(), testConfig)
+
+	cases := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, testConfig.RetryBase},
+		{2, 2 * testConfig.RetryBase},
+		{3, 4 * testConfig.RetryBase},
+		{100, testConfig.RetryMax},
+	}
+
+	for _, tc := range cases {
+		for i := 0; i < 20; i++ {
+			delay := r.backoff(tc.attempt)
+			if delay < tc.expected*4/5 || delay > tc.expected*6/5 {
+				t.Fatalf("attempt %d: expected %s +-20%%, got %s", tc.attempt, tc.expected, delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// keys look like fd_<prefix>_<secret>, prefix is stored in plain text to let user recognize the key
+const (
+	keyMarker   = "fd_"
+	prefixBytes = 6
+	secretBytes = 32
+)
+
+// Generate returns full key shown to user once, its visible prefix and hash to be stored
+func Generate() (key, prefix, hash string, err error) {
+	var raw [prefixBytes + secretBytes]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = keyMarker + base64.RawURLEncoding.EncodeToString(raw[:prefixBytes])
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(raw[prefixBytes:])
+
+	return key, prefix, Hash(key), nil
+}
+
+// Hash of key used for lookup, key has enough entropy so plain sha256 is sufficient
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey tells API key apart from JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, keyMarker)
+}
@@ -0,0 +1,49 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsAPIKey(key) || !strings.HasPrefix(key, prefix+"_") {
+		t.Fatalf("key %q does not start with its prefix %q", key, prefix)
+	}
+	if strings.Contains(prefix, key[len(prefix)+1:]) {
+		t.Fatal("prefix reveals secret part of key")
+	}
+	if hash != Hash(key) || hash == Hash(prefix) {
+		t.Fatal("stored hash does not identify the whole key")
+	}
+	if len(hash) != 64 {
+		t.Errorf("expected hex sha256, got %q", hash)
+	}
+
+	other, _, otherHash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || otherHash == hash {
+		t.Error("generated keys repeat")
+	}
+}
+
+func TestIsAPIKey(t *testing.T) {
+	cases := map[string]bool{
+		"fd_AbCdEfGh_secret":                          true,
+		"eyJhbGciOiJIUzI1NiJ9.eyJ1c2VyX2lkIjoxfQ.sig": false, // jwt
+		"FD_AbCdEfGh_secret":                          false,
+		"":                                            false,
+	}
+
+	for token, expected := range cases {
+		if IsAPIKey(token) != expected {
+			t.Errorf("%q: expected %v", token, expected)
+		}
+	}
+}
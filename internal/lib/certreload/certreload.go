@@ -0,0 +1,115 @@
+// Certificate of TLS server that is reloaded from disk when its files change, without restart
+package certreload
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// renewal tools write cert and key one after another, reload waits for both
+const settleDelay = 500 * time.Millisecond
+
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *logrus.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// New loads key pair, error when it can not be used at start
+func New(certFile, keyFile string, logger *logrus.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate, so every handshake gets latest pair
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Reload replaces pair with one on disk, previous pair is kept on error
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads pair on change of its files until ctx is done.
+// Directories are watched rather than files, as mounted secrets are replaced by swapping symlinks
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs := map[string]struct{}{
+		filepath.Dir(r.certFile): {},
+		filepath.Dir(r.keyFile):  {},
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	settle := time.NewTimer(settleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			settle.Reset(settleDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			r.logger.Errorf("Certificate watcher error: %v", err)
+		case <-settle.C:
+			if err := r.Reload(); err != nil {
+				r.logger.Errorf("Failed to reload certificate, previous one is kept: %v", err)
+				continue
+			}
+
+			r.logger.Infof("Certificate %s has been reloaded", r.certFile)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package certreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writePair writes new self-signed pair of given common name into dir
+func writePair(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	write := func(name, blockType string, der []byte) {
+		if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(certFile, "CERTIFICATE", der)
+	write(keyFile, "EC PRIVATE KEY", keyDer)
+
+	return certFile, keyFile
+}
+
+func newTestReloader(t *testing.T, certFile, keyFile string) *Reloader {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	r, err := New(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestNewRejectsBrokenPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "first")
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(certFile, keyFile, logrus.New()); err == nil {
+		t.Error("broken pair is accepted at start")
+	}
+}
+
+func TestReloadKeepsPreviousPairOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "first")
+	r := newTestReloader(t, certFile, keyFile)
+	previous, _ := r.GetCertificate(nil)
+
+	// half written renewal: new certificate with old key
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePair(t, dir, "second")
+	if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Reload(); err == nil {
+		t.Fatal("mismatched pair is loaded")
+	}
+	if current, _ := r.GetCertificate(nil); current != previous {
+		t.Fatal("previous pair is not kept after failed reload")
+	}
+
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("missing certificate is loaded")
+	}
+	if name := commonName(t, r); name != "first" {
+		t.Fatalf("expected previous certificate, got %s", name)
+	}
+
+	writePair(t, dir, "third")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, r); name != "third" {
+		t.Errorf("expected renewed certificate, got %s", name)
+	}
+}
+
+func TestWatchReloadsChangedPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "first")
+	r := newTestReloader(t, certFile, keyFile)
+
+	done := make(chan error, 1)
+	go func() { done <- r.Watch(t.Context()) }()
+
+	// watcher needs a moment to start before change is made
+	time.Sleep(100 * time.Millisecond)
+	writePair(t, dir, "second")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for commonName(t, r) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate is not reloaded after change")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("watch stopped: %v", err)
+	default:
+	}
+}
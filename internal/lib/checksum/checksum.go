@@ -0,0 +1,146 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	ContentMD5Header = "Content-MD5"
+	DigestHeader     = "Digest"      // RFC 3230: SHA-256=<base64>
+	ReprDigestHeader = "Repr-Digest" // RFC 9530: sha-256=:<base64>:
+
+	InvalidHeader = "invalid checksum header"
+	Mismatch      = "checksum mismatch"
+)
+
+// Expected holds digests announced by client, nil fields are not checked
+type Expected struct {
+	MD5    []byte
+	SHA256 []byte
+}
+
+// FromHeaders collects optional client checksums, unknown algorithms are ignored
+func FromHeaders(h http.Header) (*Expected, error) {
+	exp := new(Expected)
+
+	if v := strings.TrimSpace(h.Get(ContentMD5Header)); v != "" {
+		sum, err := decode(v, md5.Size)
+		if err != nil {
+			return nil, err
+		}
+		exp.MD5 = sum
+	}
+
+	for _, name := range []string{DigestHeader, ReprDigestHeader} {
+		for _, value := range h.Values(name) {
+			for _, member := range strings.Split(value, ",") {
+				alg, encoded, ok := strings.Cut(strings.TrimSpace(member), "=")
+				if !ok {
+					return nil, errors.New(InvalidHeader)
+				}
+
+				var size int
+				switch strings.ToLower(strings.TrimSpace(alg)) {
+				case "sha-256":
+					size = sha256.Size
+				case "md5":
+					size = md5.Size
+				default:
+					continue
+				}
+
+				// structured field byte sequences are wrapped in colons
+				sum, err := decode(strings.Trim(strings.TrimSpace(encoded), ":"), size)
+				if err != nil {
+					return nil, err
+				}
+
+				if size == sha256.Size {
+					exp.SHA256 = sum
+				} else {
+					exp.MD5 = sum
+				}
+			}
+		}
+	}
+
+	return exp, nil
+}
+
+func decode(encoded string, size int) ([]byte, error) {
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) != size {
+		return nil, errors.New(InvalidHeader)
+	}
+
+	return sum, nil
+}
+
+// Hasher computes md5 and sha256 of everything written into it
+type Hasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	writer io.Writer
+}
+
+func NewHasher() *Hasher {
+	h := &Hasher{
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+	h.writer = io.MultiWriter(h.md5, h.sha256)
+
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.writer.Write(p)
+}
+
+// SHA256 returns hex encoded sha256, the form stored in db
+func (h *Hasher) SHA256() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// Verify compares computed digests with expected ones
+func (h *Hasher) Verify(exp *Expected) error {
+	if exp == nil {
+		return nil
+	}
+
+	if exp.MD5 != nil && !bytes.Equal(exp.MD5, h.md5.Sum(nil)) {
+		return errors.New(Mismatch)
+	}
+
+	if exp.SHA256 != nil && !bytes.Equal(exp.SHA256, h.sha256.Sum(nil)) {
+		return errors.New(Mismatch)
+	}
+
+	return nil
+}
+
+// SumFile returns hex encoded sha256 of file at given path
+func SumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,74 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestFromHeaders(t *testing.T) {
+	body := []byte("hello world")
+	md5Sum := md5.Sum(body)
+	sha256Sum := sha256.Sum256(body)
+	md5B64 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	sha256B64 := base64.StdEncoding.EncodeToString(sha256Sum[:])
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		md5     []byte
+		sha256  []byte
+		invalid bool
+	}{
+		{"no headers", nil, nil, nil, false},
+		{"content md5", map[string]string{ContentMD5Header: md5B64}, md5Sum[:], nil, false},
+		{"digest sha-256", map[string]string{DigestHeader: "SHA-256=" + sha256B64}, nil, sha256Sum[:], false},
+		{"digest with both", map[string]string{DigestHeader: "md5=" + md5B64 + ", sha-256=" + sha256B64}, md5Sum[:], sha256Sum[:], false},
+		{"repr digest", map[string]string{ReprDigestHeader: "sha-256=:" + sha256B64 + ":"}, nil, sha256Sum[:], false},
+		{"unknown algorithm ignored", map[string]string{DigestHeader: "sha-512=AAAA, sha-256=" + sha256B64}, nil, sha256Sum[:], false},
+		{"md5 of wrong size", map[string]string{ContentMD5Header: sha256B64}, nil, nil, true},
+		{"not base64", map[string]string{DigestHeader: "sha-256=not base64!"}, nil, nil, true},
+		{"member without value", map[string]string{DigestHeader: "sha-256"}, nil, nil, true},
+	}
+
+	for _, tc := range cases {
+		h := make(http.Header)
+		for name, value := range tc.headers {
+			h.Set(name, value)
+		}
+
+		exp, err := FromHeaders(h)
+		if tc.invalid {
+			if err == nil || err.Error() != InvalidHeader {
+				t.Errorf("%s: expected %q, got %v", tc.name, InvalidHeader, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		if !bytes.Equal(exp.MD5, tc.md5) || !bytes.Equal(exp.SHA256, tc.sha256) {
+			t.Errorf("%s: expected md5 %x sha256 %x, got %x %x", tc.name, tc.md5, tc.sha256, exp.MD5, exp.SHA256)
+		}
+	}
+}
+
+func TestHasherVerify(t *testing.T) {
+	h := NewHasher()
+	h.Write([]byte("hello world"))
+
+	sum := sha256.Sum256([]byte("hello world"))
+	if err := h.Verify(&Expected{SHA256: sum[:]}); err != nil {
+		t.Errorf("matching digest: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("hello there"))
+	if err := h.Verify(&Expected{SHA256: other[:]}); err == nil || err.Error() != Mismatch {
+		t.Errorf("expected %q, got %v", Mismatch, err)
+	}
+}
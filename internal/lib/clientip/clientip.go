@@ -0,0 +1,115 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	forwardedForHeader = "X-Forwarded-For"
+	realIPHeader       = "X-Real-IP"
+)
+
+// trusted proxies, set once on start by SetTrustedProxies
+var trusted atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies parses addresses or CIDRs of proxies in front of the service, like nginx gateway.
+// Forwarding headers are believed only when request comes from one of them, empty list trusts none
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	trusted.Store(&prefixes)
+	return nil
+}
+
+// ClientIP returns ip of client. Behind trusted proxy it is the nearest untrusted hop of X-Forwarded-For,
+// or X-Real-IP, otherwise ip part of request remote address
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	if !isTrusted(remote) {
+		return remote
+	}
+
+	// proxies append address they got request from, so hops are walked from the right
+	// and the first one not added by our own proxies is the client
+	if hops := forwardedFor(r); len(hops) > 0 {
+		for i := len(hops) - 1; i >= 0; i-- {
+			if !isTrusted(hops[i]) {
+				return hops[i]
+			}
+		}
+		return hops[0]
+	}
+
+	if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(realIPHeader))); err == nil {
+		return ip.Unmap().String()
+	}
+
+	return remote
+}
+
+// forwardedFor returns valid addresses of every X-Forwarded-For header, garbage ends the list
+// since nothing left of it can be told apart from what client made up
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values(forwardedForHeader) {
+		for _, hop := range strings.Split(header, ",") {
+			ip, err := netip.ParseAddr(strings.TrimSpace(hop))
+			if err != nil {
+				hops = hops[:0]
+				continue
+			}
+			hops = append(hops, ip.Unmap().String())
+		}
+	}
+
+	return hops
+}
+
+func isTrusted(ip string) bool {
+	prefixes := trusted.Load()
+	if prefixes == nil {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,67 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func request(remoteAddr string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	return r
+}
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.2", "172.16.0.0/12"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted client forging forwarded for", "203.0.113.7:5000", map[string]string{forwardedForHeader: "198.51.100.1"}, "203.0.113.7"},
+		{"untrusted client forging real ip", "203.0.113.7:5000", map[string]string{realIPHeader: "198.51.100.1"}, "203.0.113.7"},
+		{"behind gateway", "10.0.0.2:5000", map[string]string{forwardedForHeader: "198.51.100.1"}, "198.51.100.1"},
+		{"behind chain of trusted proxies", "10.0.0.2:5000", map[string]string{forwardedForHeader: "198.51.100.1, 172.20.0.3"}, "198.51.100.1"},
+		{"client prepending forged hop", "10.0.0.2:5000", map[string]string{forwardedForHeader: "192.0.2.9, 198.51.100.1"}, "198.51.100.1"},
+		{"garbage before real hop", "10.0.0.2:5000", map[string]string{forwardedForHeader: "not-an-ip, 198.51.100.1"}, "198.51.100.1"},
+		{"real ip behind gateway", "10.0.0.2:5000", map[string]string{realIPHeader: "198.51.100.1"}, "198.51.100.1"},
+		{"gateway without headers", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"ipv6 client behind gateway", "10.0.0.2:5000", map[string]string{forwardedForHeader: "2001:db8::1"}, "2001:db8::1"},
+	}
+
+	for _, tc := range cases {
+		if ip := ClientIP(request(tc.remoteAddr, tc.headers)); ip != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, ip)
+		}
+	}
+}
+
+func TestClientIPTrustsNobodyByDefault(t *testing.T) {
+	if err := SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r := request("10.0.0.2:5000", map[string]string{forwardedForHeader: "198.51.100.1", realIPHeader: "198.51.100.1"})
+	if ip := ClientIP(r); ip != "10.0.0.2" {
+		t.Errorf("forwarding headers are believed without trusted proxies, got %s", ip)
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, proxy := range []string{"gateway", "10.0.0.0/33", ""} {
+		if err := SetTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("invalid trusted proxy %q is accepted", proxy)
+		}
+	}
+}
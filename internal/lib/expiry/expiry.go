@@ -0,0 +1,52 @@
+package expiry
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	InvalidInput = "invalid expiry, use expires_at as RFC3339 time or expires_in as duration like 24h"
+	InPast       = "expiry must be in the future"
+	WayTooLong   = "expiry is longer than a year"
+	BothSet      = "only one of expires_at and expires_in can be set"
+
+	MaxLifetime = 365 * 24 * time.Hour
+)
+
+// Parse resolves absolute expiresAt or relative expiresIn into expiry time.
+// Both empty means no expiry and nil is returned.
+func Parse(expiresAt, expiresIn string, now time.Time) (*time.Time, error) {
+	expiresAt, expiresIn = strings.TrimSpace(expiresAt), strings.TrimSpace(expiresIn)
+
+	var at time.Time
+	switch {
+	case expiresAt == "" && expiresIn == "":
+		return nil, nil
+	case expiresAt != "" && expiresIn != "":
+		return nil, errors.New(BothSet)
+	case expiresAt != "":
+		parsed, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, errors.New(InvalidInput)
+		}
+		at = parsed
+	default:
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return nil, errors.New(InvalidInput)
+		}
+		at = now.Add(d)
+	}
+
+	if !at.After(now) {
+		return nil, errors.New(InPast)
+	}
+
+	if at.Sub(now) > MaxLifetime {
+		return nil, errors.New(WayTooLong)
+	}
+
+	return &at, nil
+}
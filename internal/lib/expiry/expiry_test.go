@@ -0,0 +1,57 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		expiresAt string
+		expiresIn string
+		expected  time.Time // zero when no expiry
+		err       string
+	}{
+		{"no expiry", "", "", time.Time{}, ""},
+		{"blank is no expiry", "  ", "", time.Time{}, ""},
+		{"absolute", "2025-06-02T12:00:00Z", "", now.Add(24 * time.Hour), ""},
+		{"absolute with offset", "2025-06-01T15:00:00+02:00", "", now.Add(time.Hour), ""},
+		{"relative", "", "90m", now.Add(90 * time.Minute), ""},
+		{"both set", "2025-06-02T12:00:00Z", "1h", time.Time{}, BothSet},
+		{"not rfc3339", "2025-06-02", "", time.Time{}, InvalidInput},
+		{"not duration", "", "tomorrow", time.Time{}, InvalidInput},
+		{"in past", "2025-05-31T12:00:00Z", "", time.Time{}, InPast},
+		{"now", "", "0s", time.Time{}, InPast},
+		{"negative duration", "", "-1h", time.Time{}, InPast},
+		{"longest", "", MaxLifetime.String(), now.Add(MaxLifetime), ""},
+		{"too long", "", (MaxLifetime + time.Second).String(), time.Time{}, WayTooLong},
+	}
+
+	for _, tc := range cases {
+		at, err := Parse(tc.expiresAt, tc.expiresIn, now)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		if tc.expected.IsZero() {
+			if at != nil {
+				t.Errorf("%s: expected no expiry, got %s", tc.name, at)
+			}
+			continue
+		}
+		if at == nil || !at.Equal(tc.expected) {
+			t.Errorf("%s: expected %s, got %v", tc.name, tc.expected, at)
+		}
+	}
+}
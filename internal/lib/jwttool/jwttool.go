@@ -3,32 +3,15 @@ package jwttool
 import (
 	"fmt"
 	"log"
-	"os"
 	"time"
 	"up-down-server/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var _JWTSecret []byte
-
-func init() {
-	key := os.Getenv("JWT_SECRET_KEY")
-	if key == "" {
-		log.Fatalf("NO JWT SECRET KEY PROVIDED")
-	}
-
-	_JWTSecret = []byte(key)
-}
-
+// ValidateJWT verifies token with key named by its kid, tokens without kid are checked against HS256 secret
 func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return _JWTSecret, nil
-	})
+	token, err := jwt.Parse(tokenString, ring.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token: %s", err.Error())
@@ -41,17 +24,18 @@ func ValidateJWT(tokenString string) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
-func GenerateAccessToken(userId int, sessionId string, ttl time.Duration) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, models.CustomClaims{
+func GenerateAccessToken(userId int, sessionId, role string, ttl time.Duration) string {
+	tokenString, err := ring.sign(models.CustomClaims{
 		UserID:    userId,
 		SessionID: sessionId,
+		TokenType: models.TokenTypeAccess,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer(),
 		},
 	})
-
-	tokenString, err := token.SignedString(_JWTSecret)
 	if err != nil {
 		log.Print(err)
 		return ""
@@ -60,16 +44,19 @@ func GenerateAccessToken(userId int, sessionId string, ttl time.Duration) string
 	return tokenString
 }
 
-func GenerateRefreshToken(userId int, ttl time.Duration) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, models.CustomClaims{
+// GenerateRefreshToken issues refresh token of session, tokenId is stored server-side to detect reuse
+func GenerateRefreshToken(userId int, sessionId, tokenId string, ttl time.Duration) string {
+	tokenString, err := ring.sign(models.CustomClaims{
 		UserID:    userId,
+		SessionID: sessionId,
+		TokenType: models.TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer(),
 		},
 	})
-
-	tokenString, err := token.SignedString(_JWTSecret)
 	if err != nil {
 		log.Print(err)
 		return ""
@@ -78,6 +65,19 @@ func GenerateRefreshToken(userId int, ttl time.Duration) string {
 	return tokenString
 }
 
+func issuer() string {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	return ring.issuer
+}
+
+// FetchString returns string claim or empty string
+func FetchString(claims jwt.MapClaims, key string) string {
+	value, _ := claims[key].(string)
+	return value
+}
+
 func FetchUserID(userIdAny any) (int, error) {
 	switch v := userIdAny.(type) {
 	case float64:
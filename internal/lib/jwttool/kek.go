@@ -0,0 +1,146 @@
+package jwttool
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"up-down-server/internal/config"
+)
+
+const kekSize = 32 // AES-256
+
+// sealed keys start with version, so plain PKCS #8 DER (starting with 0x30) is told apart
+var sealedPrefix = []byte("kek1:")
+
+// ErrNoKEK is returned by SealString when key encryption key is not configured
+var ErrNoKEK = errors.New("key encryption key is not configured, set JWT_KEY_ENCRYPTION_KEY or key_encryption_key_file")
+
+func kekConfigured(cfg config.JWTConfig) bool {
+	return cfg.KeyEncryptionKey != "" || cfg.KeyEncryptionKeyFile != ""
+}
+
+// loadKEK reads key encryption key from env or file, base64 encoded 32 bytes
+func loadKEK(cfg config.JWTConfig) (cipher.AEAD, error) {
+	encoded := cfg.KeyEncryptionKey
+	if encoded == "" && cfg.KeyEncryptionKeyFile != "" {
+		raw, err := os.ReadFile(cfg.KeyEncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key encryption key: %w", err)
+		}
+		encoded = string(raw)
+	}
+
+	if encoded = strings.TrimSpace(encoded); encoded == "" {
+		return nil, fmt.Errorf("key encryption key is required to store signing keys: %w", ErrNoKEK)
+	}
+
+	kek, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key encryption key is not valid base64: %w", err)
+	}
+	if len(kek) != kekSize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes, got %d", kekSize, len(kek))
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealKey encrypts DER of private key, kid and algorithm are authenticated so sealed key can not be moved to other row
+func sealKey(aead cipher.AEAD, kid, alg string, der []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append([]byte{}, sealedPrefix...), nonce...)
+	return aead.Seal(sealed, nonce, der, keyAAD(kid, alg)), nil
+}
+
+// openKey decrypts key sealed by sealKey
+func openKey(aead cipher.AEAD, kid, alg string, sealed []byte) ([]byte, error) {
+	if !isSealed(sealed) {
+		return nil, errors.New("stored key is not encrypted")
+	}
+
+	sealed = sealed[len(sealedPrefix):]
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted key is truncated")
+	}
+
+	der, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], keyAAD(kid, alg))
+	if err != nil {
+		return nil, errors.New("failed to decrypt stored key, key encryption key may be wrong")
+	}
+
+	return der, nil
+}
+
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedPrefix)
+}
+
+func keyAAD(kid, alg string) []byte {
+	return []byte(kid + "/" + alg)
+}
+
+// SealString encrypts secret of other subsystem, like TOTP secret, for text column. id binds it to its row
+func SealString(id, secret string) (string, error) {
+	ring.mu.RLock()
+	kek := ring.kek
+	ring.mu.RUnlock()
+
+	if kek == nil {
+		return "", ErrNoKEK
+	}
+
+	sealed, err := sealKey(kek, id, "", []byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return string(sealedPrefix) + base64.StdEncoding.EncodeToString(sealed[len(sealedPrefix):]), nil
+}
+
+// OpenString decrypts secret sealed by SealString, value stored in plain by older version is returned as is
+func OpenString(id, stored string) (string, error) {
+	if !StringSealed(stored) {
+		return stored, nil
+	}
+
+	ring.mu.RLock()
+	kek := ring.kek
+	ring.mu.RUnlock()
+
+	if kek == nil {
+		return "", ErrNoKEK
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(stored[len(sealedPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("encrypted secret is not valid base64: %w", err)
+	}
+
+	secret, err := openKey(kek, id, "", append(append([]byte{}, sealedPrefix...), raw...))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+// StringSealed reports whether stored secret is encrypted
+func StringSealed(stored string) bool {
+	return strings.HasPrefix(stored, string(sealedPrefix))
+}
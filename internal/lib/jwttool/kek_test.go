@@ -0,0 +1,189 @@
+package jwttool
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+)
+
+type memKeyStore struct {
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (m *memKeyStore) AddSigningKey(ctx context.Context, key *models.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, k := range m.keys {
+		if k.RetiredAt == nil {
+			k.RetiredAt = &now
+		}
+	}
+	stored := *key
+	stored.CreatedAt = now
+	m.keys = append([]*models.SigningKey{&stored}, m.keys...)
+
+	return nil
+}
+
+func (m *memKeyStore) ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []*models.SigningKey
+	for _, k := range m.keys {
+		if k.RetiredAt == nil || k.RetiredAt.After(retiredAfter) {
+			copied := *k
+			result = append(result, &copied)
+		}
+	}
+
+	return result, nil
+}
+
+func (m *memKeyStore) ReplaceSigningKey(ctx context.Context, kid string, previous, replacement []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.keys {
+		if k.KID == kid && bytes.Equal(k.PrivateKey, previous) {
+			k.PrivateKey = replacement
+		}
+	}
+
+	return nil
+}
+
+func (m *memKeyStore) PurgeSigningKeys(ctx context.Context, retiredBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newKEK(t *testing.T) string {
+	t.Helper()
+
+	raw := make([]byte, kekSize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestSetupRequiresKEK(t *testing.T) {
+	err := Setup(t.Context(), config.JWTConfig{Algorithm: AlgEdDSA}, new(memKeyStore))
+	if err == nil {
+		t.Fatal("asymmetric algorithm started without key encryption key")
+	}
+
+	short := base64.StdEncoding.EncodeToString([]byte("too short"))
+	if err := Setup(t.Context(), config.JWTConfig{Algorithm: AlgEdDSA, KeyEncryptionKey: short}, new(memKeyStore)); err == nil {
+		t.Fatal("key encryption key of wrong size is accepted")
+	}
+}
+
+func TestStoredKeysAreEncrypted(t *testing.T) {
+	store := new(memKeyStore)
+
+	// key stored in plain by older version
+	plain, err := generateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.AddSigningKey(t.Context(), &models.SigningKey{KID: "legacy", Algorithm: AlgEdDSA, PrivateKey: plain})
+
+	cfg := config.JWTConfig{Algorithm: AlgEdDSA, KeyEncryptionKey: newKEK(t), GracePeriod: time.Hour}
+	if err := Setup(t.Context(), cfg, store); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rotate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range store.keys {
+		if !isSealed(k.PrivateKey) || bytes.Contains(k.PrivateKey, plain) {
+			t.Errorf("key %s is stored in plain", k.KID)
+		}
+	}
+
+	// token of legacy key still verifies after it was encrypted and retired
+	if ring.lookup("legacy") == nil {
+		t.Fatal("legacy key is not loaded after encryption")
+	}
+	if _, err := ValidateJWT(GenerateAccessToken(1, "session", "user", time.Minute)); err != nil {
+		t.Fatalf("token of active key does not verify: %v", err)
+	}
+
+	// wrong key encryption key refuses to start instead of rotating stored keys away
+	other := cfg
+	other.KeyEncryptionKey = newKEK(t)
+	before := len(store.keys)
+	if err := Setup(t.Context(), other, store); err == nil {
+		t.Fatal("started with wrong key encryption key")
+	}
+	if len(store.keys) != before {
+		t.Fatal("keys were rotated with wrong key encryption key")
+	}
+}
+
+func TestSealedKeyIsBoundToRow(t *testing.T) {
+	aead, err := loadKEK(config.JWTConfig{KeyEncryptionKey: newKEK(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := sealKey(aead, "kid-1", AlgRS256, []byte("der"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if der, err := openKey(aead, "kid-1", AlgRS256, sealed); err != nil || string(der) != "der" {
+		t.Fatalf("failed to open sealed key: %v", err)
+	}
+	if _, err := openKey(aead, "kid-2", AlgRS256, sealed); err == nil {
+		t.Fatal("sealed key is opened under other kid")
+	}
+}
+
+func TestSealString(t *testing.T) {
+	if err := Setup(t.Context(), config.JWTConfig{Algorithm: AlgHS256, Secret: "secret"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealString("totp/1", "JBSWY3DPEHPK3PXP"); !errors.Is(err, ErrNoKEK) {
+		t.Fatalf("expected ErrNoKEK without key encryption key, got %v", err)
+	}
+
+	// symmetric signing loads key encryption key too when it is set
+	cfg := config.JWTConfig{Algorithm: AlgHS256, Secret: "secret", KeyEncryptionKey: newKEK(t)}
+	if err := Setup(t.Context(), cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealString("totp/1", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !StringSealed(sealed) || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("secret is not sealed: %s", sealed)
+	}
+
+	if secret, err := OpenString("totp/1", sealed); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("failed to open sealed secret: %q, %v", secret, err)
+	}
+	if _, err := OpenString("totp/2", sealed); err == nil {
+		t.Error("secret is opened for other row")
+	}
+	if secret, err := OpenString("totp/1", "JBSWY3DPEHPK3PXP"); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("plain secret of older version is not returned as is: %q, %v", secret, err)
+	}
+}
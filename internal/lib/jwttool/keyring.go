@@ -0,0 +1,416 @@
+package jwttool
+
+import (
+	"context"
+	"crypto"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	RotateJob = "jwt.rotate"
+
+	rsaKeyBits = 2048
+	// unknown kid triggers reload at most this often, so forged tokens can not flood db
+	minReloadGap = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	expires time.Time // zero while key is active
+}
+
+// keyring holds secret and keys tokens are signed and verified with
+type keyring struct {
+	mu      sync.RWMutex
+	method  jwt.SigningMethod
+	secret  []byte
+	issuer  string
+	current *signingKey
+	keys    map[string]*signingKey
+
+	store      models.SigningKeyRepository
+	kek        cipher.AEAD // encrypts private keys stored in db
+	grace      time.Duration
+	reload     time.Duration
+	lastReload time.Time
+}
+
+var ring = &keyring{method: jwt.SigningMethodHS256, keys: map[string]*signingKey{}}
+
+// Setup configures signing, for asymmetric algorithm loads keys and creates the first one if there is no active key of that algorithm.
+// Asymmetric algorithm requires key encryption key able to open every stored key, keys stored in plain by older versions are encrypted with it
+func Setup(ctx context.Context, cfg config.JWTConfig, store models.SigningKeyRepository) error {
+	method := jwt.GetSigningMethod(cfg.Algorithm)
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if cfg.Secret == "" {
+			return fmt.Errorf("no jwt secret key provided for %s", AlgHS256)
+		}
+	case AlgRS256, AlgEdDSA:
+	default:
+		return fmt.Errorf("unsupported jwt algorithm %q", cfg.Algorithm)
+	}
+
+	ring.mu.Lock()
+	ring.method = method
+	ring.secret = []byte(cfg.Secret)
+	ring.issuer = cfg.Issuer
+	ring.store = store
+	ring.grace = cfg.GracePeriod
+	ring.reload = cfg.ReloadInterval
+	ring.kek = nil
+	ring.mu.Unlock()
+
+	// key encryption key also guards secrets of other subsystems, so it is loaded whenever set
+	if Asymmetric() || kekConfigured(cfg) {
+		kek, err := loadKEK(cfg)
+		if err != nil {
+			return err
+		}
+
+		ring.mu.Lock()
+		ring.kek = kek
+		ring.mu.Unlock()
+	}
+
+	if !Asymmetric() {
+		return nil
+	}
+
+	if err := prepareStoredKeys(ctx); err != nil {
+		return fmt.Errorf("stored signing keys: %w", err)
+	}
+
+	if err := Reload(ctx); err != nil {
+		return err
+	}
+
+	if current := ring.signer(); current != nil && current.method == method {
+		return nil
+	}
+
+	if err := Rotate(ctx); err != nil {
+		// another instance may have created the key at the same time
+		if reloadErr := Reload(ctx); reloadErr == nil {
+			if current := ring.signer(); current != nil && current.method == method {
+				return nil
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Asymmetric reports whether tokens are signed with rotated keys
+func Asymmetric() bool {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	_, hmac := ring.method.(*jwt.SigningMethodHMAC)
+	return !hmac
+}
+
+// Rotate generates new active key, previous one keeps verifying tokens for grace period
+func Rotate(ctx context.Context) error {
+	if !Asymmetric() {
+		return nil
+	}
+
+	ring.mu.RLock()
+	alg, store, kek, grace := ring.method.Alg(), ring.store, ring.kek, ring.grace
+	ring.mu.RUnlock()
+
+	der, err := generateKey(alg)
+	if err != nil {
+		return err
+	}
+
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return err
+	}
+	kid := hex.EncodeToString(raw[:])
+
+	sealed, err := sealKey(kek, kid, alg, der)
+	if err != nil {
+		return err
+	}
+
+	if err := store.AddSigningKey(ctx, &models.SigningKey{
+		KID:        kid,
+		Algorithm:  alg,
+		PrivateKey: sealed,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := store.PurgeSigningKeys(ctx, time.Now().Add(-grace)); err != nil {
+		log.Printf("failed to purge expired signing keys: %v", err)
+	}
+
+	return Reload(ctx)
+}
+
+// Reload replaces keys with ones stored in db
+func Reload(ctx context.Context) error {
+	ring.mu.RLock()
+	store, kek, grace := ring.store, ring.kek, ring.grace
+	ring.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	stored, err := store.ListSigningKeys(ctx, time.Now().Add(-grace))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	var current *signingKey
+	for _, s := range stored {
+		key, err := parseKey(kek, s)
+		if err != nil {
+			log.Printf("skipping signing key %s: %v", s.KID, err)
+			continue
+		}
+
+		if s.RetiredAt != nil {
+			key.expires = s.RetiredAt.Add(grace)
+		} else if current == nil {
+			current = key
+		}
+
+		keys[key.kid] = key
+	}
+
+	ring.mu.Lock()
+	ring.keys = keys
+	ring.current = current
+	ring.lastReload = time.Now()
+	ring.mu.Unlock()
+
+	return nil
+}
+
+// prepareStoredKeys seals keys stored before they were encrypted, row is replaced only if still holds plain key.
+// Key that does not open means wrong key encryption key, starting anyway would rotate keys and log everyone out
+func prepareStoredKeys(ctx context.Context) error {
+	ring.mu.RLock()
+	store, kek := ring.store, ring.kek
+	ring.mu.RUnlock()
+
+	stored, err := store.ListSigningKeys(ctx, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stored {
+		if isSealed(s.PrivateKey) {
+			if _, err := openKey(kek, s.KID, s.Algorithm, s.PrivateKey); err != nil {
+				return fmt.Errorf("key %s: %w", s.KID, err)
+			}
+			continue
+		}
+
+		sealed, err := sealKey(kek, s.KID, s.Algorithm, s.PrivateKey)
+		if err != nil {
+			return err
+		}
+
+		if err := store.ReplaceSigningKey(ctx, s.KID, s.PrivateKey, sealed); err != nil {
+			return err
+		}
+		log.Printf("signing key %s has been encrypted", s.KID)
+	}
+
+	return nil
+}
+
+// Watch picks up keys rotated by other instances until ctx is done
+func Watch(ctx context.Context) {
+	ring.mu.RLock()
+	interval := ring.reload
+	ring.mu.RUnlock()
+
+	if !Asymmetric() || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Reload(ctx); err != nil {
+				log.Printf("failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+func (k *keyring) signer() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current
+}
+
+// lookup finds key by kid, unknown kid may be a key just rotated by another instance
+func (k *keyring) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	stale := time.Since(k.lastReload) > minReloadGap
+	k.mu.RUnlock()
+
+	if !ok && stale {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := Reload(ctx); err != nil {
+			log.Printf("failed to reload signing keys: %v", err)
+			return nil
+		}
+
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+
+	if !ok || (!key.expires.IsZero() && time.Now().After(key.expires)) {
+		return nil
+	}
+
+	return key
+}
+
+// verificationKey is jwt.Keyfunc, tokens without kid are HS256 ones signed with secret
+func (k *keyring) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		k.mu.RLock()
+		secret := k.secret
+		k.mu.RUnlock()
+
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(secret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return secret, nil
+	}
+
+	key := k.lookup(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.private.Public(), nil
+}
+
+// sign signs with active key, or with secret when algorithm is HS256
+func (k *keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	method, secret, current := k.method, k.secret, k.current
+	k.mu.RUnlock()
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if len(secret) == 0 {
+			return "", errors.New("jwt secret key is not set")
+		}
+
+		return jwt.NewWithClaims(method, claims).SignedString(secret)
+	}
+
+	if current == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.kid
+
+	return token.SignedString(current.private)
+}
+
+func generateKey(alg string) ([]byte, error) {
+	var private any
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+
+	return x509.MarshalPKCS8PrivateKey(private)
+}
+
+func parseKey(kek cipher.AEAD, s *models.SigningKey) (*signingKey, error) {
+	der, err := openKey(kek, s.KID, s.Algorithm, s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: s.KID, method: jwt.GetSigningMethod(s.Algorithm)}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if s.Algorithm != AlgRS256 {
+			return nil, fmt.Errorf("rsa key stored as %s", s.Algorithm)
+		}
+		key.private = private
+	case ed25519.PrivateKey:
+		if s.Algorithm != AlgEdDSA {
+			return nil, fmt.Errorf("ed25519 key stored as %s", s.Algorithm)
+		}
+		key.private = private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,92 @@
+// RFC 6238 TOTP keys and one-time recovery codes
+package twofactor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	Issuer = "filedump"
+
+	// codes are valid for one period before and after current one to tolerate clock drift
+	Period = 30 * time.Second
+	Skew   = 1
+
+	RecoveryCodesCount = 10
+
+	qrSize = 256
+)
+
+// NewKey generates secret for account, returns otpauth:// uri and QR code with it as PNG
+func NewKey(account string) (secret, uri string, qrPNG []byte, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      Issuer,
+		AccountName: account,
+		Period:      uint(Period.Seconds()),
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	img, err := key.Image(qrSize, qrSize)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", "", nil, err
+	}
+
+	return key.Secret(), key.URL(), buf.Bytes(), nil
+}
+
+// Validate checks 6 digit code against secret at current time
+func Validate(code, secret string) bool {
+	ok, err := totp.ValidateCustom(strings.TrimSpace(code), secret, time.Now().UTC(), totp.ValidateOpts{
+		Period:    uint(Period.Seconds()),
+		Skew:      Skew,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+
+	return err == nil && ok
+}
+
+// RecoveryCodes generates codes shown to user once and their hashes to be stored
+func RecoveryCodes() (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < RecoveryCodesCount; i++ {
+		var raw [5]byte
+		if _, err := rand.Read(raw[:]); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(raw[:]))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode ignores case, spaces and dashes so code can be typed as user likes
+func HashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package twofactor
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestValidate(t *testing.T) {
+	secret, uri, qrPNG, err := NewKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qrPNG) == 0 {
+		t.Error("qr code is empty")
+	}
+	if parsed, err := url.Parse(uri); err != nil || parsed.Query().Get("secret") != secret {
+		t.Errorf("otpauth uri does not carry secret: %s", uri)
+	}
+
+	code := func(at time.Time) string {
+		c, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: uint(Period.Seconds()), Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	now := time.Now()
+	cases := []struct {
+		name  string
+		code  string
+		valid bool
+	}{
+		{"current", code(now), true},
+		{"padded with spaces", " " + code(now) + " ", true},
+		{"previous period", code(now.Add(-Period)), true},
+		{"next period", code(now.Add(Period)), true},
+		{"outside of skew", code(now.Add(-3 * Period)), false},
+		{"empty", "", false},
+	}
+
+	for _, tc := range cases {
+		if valid := Validate(tc.code, secret); valid != tc.valid {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.valid, valid)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := RecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodesCount || len(hashes) != RecoveryCodesCount {
+		t.Fatalf("expected %d codes and hashes, got %d and %d", RecoveryCodesCount, len(codes), len(hashes))
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if seen[code] {
+			t.Errorf("code %s is repeated", code)
+		}
+		seen[code] = true
+
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash of code %d does not match", i)
+		}
+		if hashes[i] == code {
+			t.Errorf("code %d is stored in plain", i)
+		}
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	expected := HashRecoveryCode("abcd-efgh")
+	for _, typed := range []string{"ABCD-EFGH", "abcdefgh", "abcd efgh", " Abcd-Efgh "} {
+		if HashRecoveryCode(typed) != expected {
+			t.Errorf("%q is not treated as abcd-efgh", typed)
+		}
+	}
+	if HashRecoveryCode("abcd-efgi") == expected {
+		t.Error("different codes have the same hash")
+	}
+}
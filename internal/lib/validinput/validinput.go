@@ -1,6 +1,7 @@
 package validinput
 
 import (
+	"net/mail"
 	"regexp"
 	"strings"
 )
@@ -46,6 +47,12 @@ func IsValidUsername(username string) bool {
 	return true
 }
 
+// IsValidEmail accepts bare address only, without display name
+func IsValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
 func IsValidFileName(filename string) bool {
 	filename = strings.TrimSpace(filename)
 	if filename == "" {
@@ -55,3 +62,27 @@ func IsValidFileName(filename string) bool {
 	illegal := regexp.MustCompile(`[\\/:\*\?"<>\|]`)
 	return !illegal.MatchString(filename)
 }
+
+const (
+	MaxTagLength            = 64
+	MaxAttributeKeyLength   = 64
+	MaxAttributeValueLength = 1024
+)
+
+var (
+	tagPattern          = regexp.MustCompile(`^[\p{L}\p{N}_.:-]+$`)
+	attributeKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// IsValidTag expects already normalized (trimmed, lowercased) tag
+func IsValidTag(tag string) bool {
+	return len(tag) <= MaxTagLength && tagPattern.MatchString(tag)
+}
+
+func IsValidAttributeKey(key string) bool {
+	return len(key) <= MaxAttributeKeyLength && attributeKeyPattern.MatchString(key)
+}
+
+func IsValidAttributeValue(value string) bool {
+	return len(value) <= MaxAttributeValueLength
+}
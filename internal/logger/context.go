@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"up-down-server/internal/http-server/ctx"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextHook adds request id and trace of entries made WithContext, so logs of one request can be found together
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	if requestId, ok := entry.Context.Value(ctx.CtxRequestIDKey).(string); ok {
+		entry.Data["request_id"] = requestId
+	}
+
+	if sc := trace.SpanContextFromContext(entry.Context); sc.IsValid() {
+		entry.Data["trace_id"] = sc.TraceID().String()
+		entry.Data["span_id"] = sc.SpanID().String()
+	}
+
+	return nil
+}
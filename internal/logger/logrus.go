@@ -4,31 +4,69 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
+
+	"up-down-server/internal/config"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func SetupLogger() *logrus.Logger {
-	logFile, err := os.OpenFile(".log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputBoth   = "both"
+)
+
+// SetupLogger builds logger of the service. Entries made WithContext carry request id and trace of request
+func SetupLogger(cfg config.LogConfig) (*logrus.Logger, error) {
+	level, err := logrus.ParseLevel(cfg.Level)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	var formatter logrus.Formatter
+	switch cfg.Format {
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000Z07:00"}
+	case FormatText:
+		formatter = &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		}
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
 	}
-	seperator := fmt.Sprintf("=== Logging started at %s ===\n", time.Now().Format("2006-01-02 15:04:05"))
-	logFile.Write([]byte(seperator))
 
-	multiwriter := io.MultiWriter(os.Stdout, logFile)
+	// file is rotated by size, old files are removed by count and age
+	file := &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
 
-	logger := logrus.New()
-	logger.SetOutput(multiwriter)
-	logger.SetFormatter(&logrus.TextFormatter{
-		ForceColors:     true,
-		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	var output io.Writer
+	switch cfg.Output {
+	case OutputStdout:
+		output = os.Stdout
+	case OutputFile:
+		output = file
+	case OutputBoth:
+		output = io.MultiWriter(os.Stdout, file)
+	default:
+		return nil, fmt.Errorf("unknown log output %q", cfg.Output)
+	}
 
-	logger.SetLevel(logrus.InfoLevel)
+	logger := logrus.New()
+	logger.SetOutput(output)
+	logger.SetFormatter(formatter)
+	logger.SetLevel(level)
+	logger.AddHook(contextHook{})
 
 	logger.Info("Logger has been set up")
-	return logger
+	return logger, nil
 }
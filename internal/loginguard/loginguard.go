@@ -0,0 +1,159 @@
+// Protection of password login from guessing: progressive delays and temporary lockout
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// counters of failed attempts within window
+	userFailuresKey = "login failures:user:%s"
+	ipFailuresKey   = "login failures:ip:%s"
+	// hold unix time when lock ends, so remaining time is known without TTL lookup
+	userLockKey = "login lock:user:%s"
+	ipLockKey   = "login lock:ip:%s"
+)
+
+// Guard counts failed logins in cache, so limits are shared by every instance
+type Guard struct {
+	cache  models.Cache
+	cfg    config.LoginConfig
+	audit  *audit.Recorder
+	logger *logrus.Logger
+}
+
+func NewGuard(cache models.Cache, cfg config.LoginConfig, audit *audit.Recorder, logger *logrus.Logger) *Guard {
+	return &Guard{
+		cache:  cache,
+		cfg:    cfg,
+		audit:  audit,
+		logger: logger,
+	}
+}
+
+// Locked returns time left until username or ip may try again, zero when neither is locked.
+// Ip is looked at only when MaxIPFailures is set
+func (g *Guard) Locked(ctx context.Context, username, ip string) (time.Duration, error) {
+	keys := []string{fmt.Sprintf(userLockKey, username)}
+	if g.cfg.MaxIPFailures > 0 {
+		keys = append(keys, fmt.Sprintf(ipLockKey, ip))
+	}
+
+	var left time.Duration
+	for _, key := range keys {
+		value, err := g.cache.Get(ctx, key)
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		until, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if d := time.Until(time.Unix(until, 0)); d > left {
+			left = d
+		}
+	}
+
+	return left, nil
+}
+
+// Failure records failed attempt, returns delay to hold response for and lockout time when threshold is reached
+func (g *Guard) Failure(ctx context.Context, username, ip string) (delay, lockedFor time.Duration, err error) {
+	userFailures, err := g.cache.Incr(ctx, fmt.Sprintf(userFailuresKey, username), g.cfg.FailureWindow)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// ip is counted only when its lock is enabled, otherwise clients sharing ip of gateway would slow down each other
+	var ipFailures int64
+	if g.cfg.MaxIPFailures > 0 {
+		ipFailures, err = g.cache.Incr(ctx, fmt.Sprintf(ipFailuresKey, ip), g.cfg.FailureWindow)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if g.cfg.MaxUserFailures > 0 && userFailures >= int64(g.cfg.MaxUserFailures) {
+		if err := g.lock(ctx, userLockKey, userFailuresKey, username, "username", username, ip, userFailures); err != nil {
+			return 0, 0, err
+		}
+		lockedFor = g.cfg.LockoutDuration
+	}
+
+	if g.cfg.MaxIPFailures > 0 && ipFailures >= int64(g.cfg.MaxIPFailures) {
+		if err := g.lock(ctx, ipLockKey, ipFailuresKey, ip, "ip", username, ip, ipFailures); err != nil {
+			return 0, 0, err
+		}
+		lockedFor = g.cfg.LockoutDuration
+	}
+
+	return g.delay(max(userFailures, ipFailures)), lockedFor, nil
+}
+
+// Success forgets failures of username, failures of ip are kept so one valid account does not reset them
+func (g *Guard) Success(ctx context.Context, username string) error {
+	return g.cache.Del(ctx, fmt.Sprintf(userFailuresKey, username))
+}
+
+func (g *Guard) lock(ctx context.Context, lockKey, failuresKey, subject, kind, username, ip string, failures int64) error {
+	until := time.Now().Add(g.cfg.LockoutDuration)
+	if err := g.cache.Set(ctx, fmt.Sprintf(lockKey, subject), until.Unix(), g.cfg.LockoutDuration); err != nil {
+		return err
+	}
+
+	// counting starts over once lock ends
+	if err := g.cache.Del(ctx, fmt.Sprintf(failuresKey, subject)); err != nil {
+		return err
+	}
+
+	g.audit.Record(ctx, &models.AuditEvent{
+		Event: models.AuditLockout,
+		IP:    ip,
+		Details: map[string]any{
+			"locked":   kind,
+			"username": username,
+			"failures": failures,
+			"until":    until.Format(time.RFC3339),
+		},
+	})
+	g.logger.Warnf("Login of %s %s locked after repeated failures", kind, subject)
+
+	return nil
+}
+
+// delay doubles from DelayBase with every failure after the first one
+func (g *Guard) delay(failures int64) time.Duration {
+	if failures <= 1 || g.cfg.DelayBase <= 0 {
+		return 0
+	}
+
+	d := g.cfg.DelayBase
+	for i := int64(2); i < failures && d < g.cfg.DelayMax; i++ {
+		d *= 2
+	}
+
+	return min(d, g.cfg.DelayMax)
+}
+
+// Reset lifts lock and forgets failures of username, used by admins
+func (g *Guard) Reset(ctx context.Context, username string) error {
+	if err := g.cache.Del(ctx, fmt.Sprintf(userLockKey, username)); err != nil {
+		return err
+	}
+
+	return g.cache.Del(ctx, fmt.Sprintf(userFailuresKey, username))
+}
@@ -0,0 +1,221 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// memCache keeps values without expiry, tests move time by deleting keys
+type memCache struct {
+	models.Cache
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *memCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = fmt.Sprint(value)
+	return nil
+}
+
+func (c *memCache) Get(ctx context.Context, key string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[key]
+	if !ok {
+		return nil, redis.Nil
+	}
+
+	return value, nil
+}
+
+func (c *memCache) Del(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+	return nil
+}
+
+func (c *memCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	fmt.Sscan(c.values[key], &n)
+	c.values[key] = fmt.Sprint(n + 1)
+
+	return n + 1, nil
+}
+
+type fakeAudit struct {
+	models.AuditRepository
+
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+func (a *fakeAudit) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events = append(a.events, event)
+	return nil
+}
+
+func newTestGuard(cfg config.LoginConfig) (*Guard, *fakeAudit) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	repo := new(fakeAudit)
+	cache := &memCache{values: make(map[string]string)}
+
+	return NewGuard(cache, cfg, audit.NewRecorder(repo, logger), logger), repo
+}
+
+var testConfig = config.LoginConfig{
+	MaxUserFailures: 3,
+	FailureWindow:   time.Minute,
+	LockoutDuration: time.Minute,
+	DelayBase:       100 * time.Millisecond,
+	DelayMax:        300 * time.Millisecond,
+}
+
+func TestFailureLocksUsername(t *testing.T) {
+	guard, repo := newTestGuard(testConfig)
+	ctx := t.Context()
+
+	expectedDelays := []time.Duration{0, 100 * time.Millisecond}
+	for i, expected := range expectedDelays {
+		delay, lockedFor, err := guard.Failure(ctx, "alice", "198.51.100.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delay != expected || lockedFor != 0 {
+			t.Errorf("failure %d: expected delay %s and no lock, got %s and %s", i+1, expected, delay, lockedFor)
+		}
+	}
+
+	if left, _ := guard.Locked(ctx, "alice", "198.51.100.1"); left != 0 {
+		t.Fatalf("locked before threshold for %s", left)
+	}
+
+	_, lockedFor, err := guard.Failure(ctx, "alice", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockedFor != testConfig.LockoutDuration {
+		t.Fatalf("expected lock for %s on threshold, got %s", testConfig.LockoutDuration, lockedFor)
+	}
+
+	left, err := guard.Locked(ctx, "alice", "203.0.113.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left <= 0 || left > testConfig.LockoutDuration {
+		t.Errorf("username is not locked from other ip, left %s", left)
+	}
+	if left, _ := guard.Locked(ctx, "bob", "198.51.100.1"); left != 0 {
+		t.Errorf("other username is locked for %s", left)
+	}
+
+	if len(repo.events) != 1 || repo.events[0].Event != models.AuditLockout {
+		t.Errorf("expected one lockout audit event, got %v", repo.events)
+	}
+}
+
+func TestDelayIsCapped(t *testing.T) {
+	cfg := testConfig
+	cfg.MaxUserFailures = 0
+	guard, _ := newTestGuard(cfg)
+
+	var delay time.Duration
+	for i := 0; i < 10; i++ {
+		delay, _, _ = guard.Failure(t.Context(), "alice", "198.51.100.1")
+	}
+
+	if delay != cfg.DelayMax {
+		t.Errorf("expected delay capped at %s, got %s", cfg.DelayMax, delay)
+	}
+}
+
+func TestSuccessForgetsFailures(t *testing.T) {
+	guard, _ := newTestGuard(testConfig)
+	ctx := t.Context()
+
+	for i := 0; i < testConfig.MaxUserFailures-1; i++ {
+		guard.Failure(ctx, "alice", "198.51.100.1")
+	}
+	if err := guard.Success(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// counting starts over, so next failure is again the first one
+	delay, lockedFor, _ := guard.Failure(ctx, "alice", "198.51.100.1")
+	if delay != 0 || lockedFor != 0 {
+		t.Errorf("failures are kept after success: delay %s, lock %s", delay, lockedFor)
+	}
+}
+
+func TestResetLiftsLock(t *testing.T) {
+	guard, _ := newTestGuard(testConfig)
+	ctx := t.Context()
+
+	for i := 0; i < testConfig.MaxUserFailures; i++ {
+		guard.Failure(ctx, "alice", "198.51.100.1")
+	}
+	if left, _ := guard.Locked(ctx, "alice", "198.51.100.1"); left == 0 {
+		t.Fatal("username is not locked")
+	}
+
+	if err := guard.Reset(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := guard.Locked(ctx, "alice", "198.51.100.1"); left != 0 {
+		t.Errorf("username is still locked for %s after reset", left)
+	}
+}
+
+func TestIPLockIsOptIn(t *testing.T) {
+	ctx := t.Context()
+
+	// by default clients sharing ip of gateway are never locked or slowed down by each other
+	guard, _ := newTestGuard(testConfig)
+	for i := 0; i < 50; i++ {
+		guard.Failure(ctx, fmt.Sprintf("user-%d", i), "10.0.0.2")
+	}
+	if left, _ := guard.Locked(ctx, "victim", "10.0.0.2"); left != 0 {
+		t.Fatalf("failures of other users locked ip for %s", left)
+	}
+	if delay, _, _ := guard.Failure(ctx, "victim", "10.0.0.2"); delay != 0 {
+		t.Errorf("failures of other users delay victim by %s", delay)
+	}
+
+	cfg := testConfig
+	cfg.MaxIPFailures = 5
+	guard, _ = newTestGuard(cfg)
+	for i := 0; i < cfg.MaxIPFailures; i++ {
+		guard.Failure(ctx, fmt.Sprintf("user-%d", i), "198.51.100.1")
+	}
+	if left, _ := guard.Locked(ctx, "victim", "198.51.100.1"); left == 0 {
+		t.Error("ip is not locked when enabled")
+	}
+	if left, _ := guard.Locked(ctx, "victim", "203.0.113.9"); left != 0 {
+		t.Errorf("other ip is locked for %s", left)
+	}
+}
@@ -0,0 +1,184 @@
+// Prometheus metrics of server, exposed at /metrics
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"up-down-server/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "filedump"
+
+// UnmatchedRoute labels requests not matched by any route, so scanners can not blow up label cardinality
+const UnmatchedRoute = "unmatched"
+
+// rate limiters, label of RateLimitRejections
+const (
+	LimiterRequests      = "requests"
+	LimiterLogin         = "login"
+	LimiterPasswordReset = "password_reset"
+)
+
+// download sources, label of DownloadedBytes
+const (
+	DownloadOwner  = "owner"
+	DownloadShared = "shared"
+)
+
+var (
+	// Registry holds only metrics of this package and runtime collectors, default registry is left untouched
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method", "status"})
+
+	HTTPResponseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_response_bytes_total",
+		Help:      "Bytes of HTTP response bodies by route pattern.",
+	}, []string{"route"})
+
+	UploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes of successfully stored uploads.",
+	})
+
+	DownloadedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes of file contents sent to clients by source.",
+	}, []string{"source"})
+
+	ActiveUploads = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_uploads",
+		Help:      "Uploads being received right now.",
+	})
+
+	CacheDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cache_command_duration_seconds",
+		Help:      "Latency of redis commands by command and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command", "result"})
+
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_call_duration_seconds",
+		Help:      "Latency of database calls by operation and result.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "result"})
+
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by rate limiter.",
+	}, []string{"limiter"})
+
+	StorageFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_files",
+		Help:      "Files stored, refreshed periodically.",
+	})
+
+	StorageBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_bytes",
+		Help:      "Bytes of stored files, refreshed periodically.",
+	})
+
+	Users = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "users",
+		Help:      "Registered users by state, refreshed periodically.",
+	}, []string{"state"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		HTTPResponseBytes,
+		UploadedBytes,
+		DownloadedBytes,
+		ActiveUploads,
+		CacheDuration,
+		DBDuration,
+		RateLimitRejections,
+		StorageFiles,
+		StorageBytes,
+		Users,
+	)
+}
+
+// Handler serves metrics of Registry in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result is "ok" or "error" label of call outcome
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
+
+// WatchStorage refreshes storage gauges until ctx is done, totals are not computed on every scrape as they scan tables
+func WatchStorage(ctx context.Context, source models.AdminRepository, interval time.Duration, logger *logrus.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	refresh := func() {
+		c, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+
+		// one day of uploads is the cheapest window, only totals are used
+		stats, err := source.StorageStats(c, 1)
+		if err != nil {
+			logger.Errorf("Failed to refresh storage metrics: %v", err)
+			return
+		}
+
+		Users.WithLabelValues("active").Set(float64(stats.Users - stats.DisabledUsers))
+		Users.WithLabelValues("disabled").Set(float64(stats.DisabledUsers))
+		StorageFiles.Set(float64(stats.Files))
+		StorageBytes.Set(float64(stats.Bytes))
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingWriter adds bytes of response body to counter
+type countingWriter struct {
+	http.ResponseWriter
+	counter prometheus.Counter
+}
+
+// CountBody returns writer adding bytes of body written through it to counter
+func CountBody(w http.ResponseWriter, counter prometheus.Counter) http.ResponseWriter {
+	return &countingWriter{ResponseWriter: w, counter: counter}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.counter.Add(float64(n))
+	return n, err
+}
+
+// ReadFrom keeps sendfile of underlying writer used by http.ServeFile
+func (cw *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(cw.ResponseWriter, src)
+	}
+
+	cw.counter.Add(float64(n))
+	return n, err
+}
+
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserSummary is user as seen by admin, with storage usage
+type UserSummary struct {
+	ID           int        `json:"user_id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email,omitempty"`
+	Role         string     `json:"role"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	Files        int64      `json:"files"`
+	BytesUsed    int64      `json:"bytes_used"`
+	LastUploadAt *time.Time `json:"last_upload_at,omitempty"`
+}
+
+// StorageStats are totals over the whole server
+type StorageStats struct {
+	Users         int64           `json:"users"`
+	DisabledUsers int64           `json:"disabled_users"`
+	Files         int64           `json:"files"`
+	Bytes         int64           `json:"bytes"`
+	UploadsPerDay []*DailyUploads `json:"uploads_per_day"`
+}
+
+type DailyUploads struct {
+	Day   string `json:"day"` // YYYY-MM-DD in UTC
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// permissions of API key, tokens of interactive login have all of them
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeDelete = "delete"
+	ScopeShare  = "share"
+)
+
+var AllScopes = []string{ScopeRead, ScopeUpload, ScopeDelete, ScopeShare}
+
+// APIKey is long-lived credential of user for scripts, only hash of the secret is stored
+type APIKey struct {
+	KeyID      string     `json:"key_id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // visible part of key to recognize it
+	KeyHash    string     `json:"-"`
+	Role       string     `json:"-"` // role of owner, filled on lookup by hash
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// HasScope reports whether scope is granted
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// audit event names
+const (
+	AuditLogin        = "auth.login"
+	AuditLoginFailed  = "auth.login_failed"
+	AuditLockout      = "auth.lockout"
+	AuditLogout       = "auth.logout"
+	AuditRefresh      = "auth.refresh"
+	AuditRefreshReuse = "auth.refresh_reuse"
+
+	AuditFileUpload         = "file.upload"
+	AuditFileDownload       = "file.download"
+	AuditFileDownloadShared = "file.download_shared"
+	AuditFileRename         = "file.rename"
+	AuditFileDelete         = "file.delete"
+	AuditShareLinkCreate    = "sharelink.create"
+
+	AuditAdminUserDisable     = "admin.user_disable"
+	AuditAdminUserEnable      = "admin.user_enable"
+	AuditAdminUserLogout      = "admin.user_logout"
+	AuditAdminUserResetLimits = "admin.user_reset_limits"
+	AuditAdminFileDelete      = "admin.file_delete"
+)
+
+// AuditEvent is one record of append-only audit log
+type AuditEvent struct {
+	ID         int64          `json:"id"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Event      string         `json:"event"`
+	ActorID    *int           `json:"actor_id,omitempty"` // nil for anonymous, e.g. download via share link
+	OwnerID    *int           `json:"owner_id,omitempty"` // user whose file or account is affected
+	FileUUID   string         `json:"file_id,omitempty"`
+	IP         string         `json:"ip,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// AuditFilter narrows audit log, zero fields are not applied
+type AuditFilter struct {
+	UserID   int // events done by user or touching user's files
+	Event    string
+	FileUUID string
+	Since    *time.Time
+	Until    *time.Time
+	BeforeID int64 // id of last event of previous page
+	Limit    int
+}
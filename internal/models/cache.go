@@ -12,4 +12,12 @@ type Cache interface {
 	SetNX(ctx context.Context, key string, value any, ttl time.Duration)	*redis.BoolCmd
 	Get(ctx context.Context, key string)									(any, error)
 	Del(ctx context.Context, key string)									error
+	DelMatch(ctx context.Context, pattern string)							(int64, error)
+	Swap(ctx context.Context, key string, value any, ttl time.Duration)	(string, error)
+	GetDel(ctx context.Context, key string)									(string, error)
+	Incr(ctx context.Context, key string, ttl time.Duration)				(int64, error)
+	Publish(ctx context.Context, channel string, message any)				error
+	Subscribe(ctx context.Context, channels ...string)						*redis.PubSub
+	Ping(ctx context.Context)												error
+	Close()																	error
 }
\ No newline at end of file
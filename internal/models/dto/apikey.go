@@ -0,0 +1,9 @@
+package dto
+
+// CreateAPIKeyRequest, empty scopes grant read only, expiry fields follow UpdateExpiryRequest
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"`
+	ExpiresIn string   `json:"expires_in"`
+}
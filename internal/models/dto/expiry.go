@@ -0,0 +1,7 @@
+package dto
+
+// UpdateExpiryRequest sets one of the fields, both empty removes expiry
+type UpdateExpiryRequest struct {
+	ExpiresAt string `json:"expires_at"` // RFC3339 time
+	ExpiresIn string `json:"expires_in"` // duration, e.g. 24h
+}
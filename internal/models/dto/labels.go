@@ -0,0 +1,9 @@
+package dto
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type AttributesRequest struct {
+	Attributes map[string]string `json:"attributes"`
+}
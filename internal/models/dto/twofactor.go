@@ -0,0 +1,19 @@
+package dto
+
+// SecondFactorRequest carries either authenticator code or one of recovery codes
+type SecondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginSecondFactorRequest finishes login started with password
+type LoginSecondFactorRequest struct {
+	Challenge string `json:"challenge"`
+	SecondFactorRequest
+}
+
+// ReauthRequest confirms sensitive change with password and second factor
+type ReauthRequest struct {
+	Password string `json:"password"`
+	SecondFactorRequest
+}
@@ -3,4 +3,24 @@ package dto
 type UserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email,omitempty"` // optional, needed for password reset
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password"`
+	Email    string `json:"email"` // empty removes email
+}
+
+type ForgotPasswordRequest struct {
+	Login string `json:"login"` // username or email
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
 }
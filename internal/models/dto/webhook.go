@@ -0,0 +1,7 @@
+package dto
+
+// CreateWebhookRequest, events are types listed in models.WebhookEvents
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
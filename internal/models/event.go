@@ -0,0 +1,23 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// EventFileIntegrity is sent when integrity scrub changes status of file, other events share names with webhook events
+const EventFileIntegrity = "file.integrity"
+
+// Event is real-time notification of user about change of own files
+type Event struct {
+	ID     string    `json:"id"`
+	UserID int       `json:"user_id"`
+	Type   string    `json:"type"`
+	At     time.Time `json:"at"`
+	Data   any       `json:"data,omitempty"`
+}
+
+// EventPublisher delivers event to every connected client of user, on any instance
+type EventPublisher interface {
+	Publish(ctx context.Context, userId int, eventType string, data any)
+}
@@ -14,8 +14,31 @@ type FileMetaData struct {
 	FilePath   string    `json:"file_path"`           // absolute path to the file
 	MimeType   string    `json:"mime_type,omitempty"` // MIME type of the file
 	UserID     int       `json:"user_id"`             // ID of the user who uploaded the file
+
+	SHA256          string     `json:"sha256,omitempty"`     // hex encoded checksum computed on upload
+	IntegrityStatus string     `json:"integrity_status"`     // result of the last integrity check
+	CheckedAt       *time.Time `json:"checked_at,omitempty"` // time of the last integrity check
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // file is deleted after this time, nil means never
+
+	Tags       []string          `json:"tags,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"` // user defined key/value metadata
+}
+
+// FileFilter narrows listing to files having every tag and every attribute key with given value
+type FileFilter struct {
+	Tags       []string
+	Attributes map[string]string
 }
 
+// integrity states of the stored blob
+const (
+	IntegrityUnverified = "unverified" // no checksum known yet
+	IntegrityOK         = "ok"
+	IntegrityCorrupted  = "corrupted" // blob does not match stored checksum
+	IntegrityMissing    = "missing"   // blob is absent on disk
+)
+
 func NewFileMetaData(file_uuid string, file *multipart.FileHeader, filepath string, userID int) *FileMetaData {
 	return &FileMetaData{
 		FileUUID:   file_uuid,
@@ -26,9 +49,16 @@ func NewFileMetaData(file_uuid string, file *multipart.FileHeader, filepath stri
 		FilePath:   filepath,
 		MimeType:   file.Header.Get("Content-Type"),
 		UserID:     userID,
+
+		IntegrityStatus: IntegrityUnverified,
 	}
 }
 
+// Expired reports whether file lifetime is over
+func (f *FileMetaData) Expired() bool {
+	return f.ExpiresAt != nil && !f.ExpiresAt.After(time.Now())
+}
+
 func parseExt(filename string) string {
 	for i := len(filename) - 1; i >= 0; i-- {
 		if filename[i] == '.' {
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed" // attempts exhausted
+)
+
+type Job struct {
+	ID          int64           `json:"job_id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	LockedBy    string          `json:"locked_by,omitempty"` // worker that runs the job
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobSchedule enqueues job of Kind every time Spec fires
+type JobSchedule struct {
+	Name        string          `json:"name"`
+	Kind        string          `json:"kind"`
+	Spec        string          `json:"spec"` // cron expression or @every duration
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	MaxAttempts int             `json:"max_attempts"`
+	NextRunAt   time.Time       `json:"next_run_at"`
+	LastRunAt   *time.Time      `json:"last_run_at,omitempty"`
+}
+
+// JobStat is count of jobs of a kind in a status
+type JobStat struct {
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
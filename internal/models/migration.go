@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Migration of schema, pending while AppliedAt is nil
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "context"
+
+// Message is plain text notification to user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Send(ctx context.Context, msg *Message) error
+}
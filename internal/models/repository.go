@@ -1,6 +1,9 @@
 package models
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type FileMetaRepository interface {
 	InsertFileName		(ctx context.Context, file *FileMetaData) 					error
@@ -8,11 +11,121 @@ type FileMetaRepository interface {
 	GetFileMeta			(ctx context.Context, uuidOfFile string) 					(*FileMetaData, error)
 	GetUUID				(ctx context.Context, filename string) 						(string, error)
 	GetAllRecords		(ctx context.Context) 										([]*FileMetaData, error)
-	GetUserRecords		(ctx context.Context, userId int) 							([]*FileMetaData, error)
+	GetUserRecords		(ctx context.Context, userId int, filter *FileFilter) 		([]*FileMetaData, error)
 	RenameFileName		(ctx context.Context, updatedFilename, uuidOfFile string)	error
+	UpdateIntegrity		(ctx context.Context, uuidOfFile, checksum, status string)	error
+	SetExpiry			(ctx context.Context, uuidOfFile string, expiresAt *time.Time) error
+	GetExpiredRecords	(ctx context.Context, limit int) 							([]*FileMetaData, error)
+	AddTags				(ctx context.Context, uuidOfFile string, tags []string, limit int) 	error
+	RemoveTags			(ctx context.Context, uuidOfFile string, tags []string) 			error
+	SetAttributes		(ctx context.Context, uuidOfFile string, attrs map[string]string, limit int) error
+	RemoveAttributes	(ctx context.Context, uuidOfFile string, keys []string) 			error
 }
 
 type UserRepository interface {
-	RegisterUser		(ctx context.Context, username, hashedpassword string) 		error
+	RegisterUser		(ctx context.Context, username, hashedpassword, email string) error
 	AuthentificateUser	(ctx context.Context, username, password string) 			(int, error)
+
+	GetUserIDByIdentity		(ctx context.Context, issuer, subject string) 				(int, error)
+	LinkIdentityByUsername	(ctx context.Context, username, issuer, subject string) 	(int, error)
+	ProvisionUser			(ctx context.Context, username, issuer, subject string) 	(int, error)
+
+	GetUsername			(ctx context.Context, userId int) 							(string, error)
+	GetUserIDByUsername	(ctx context.Context, username string) 						(int, error)
+	GetUserIDByEmail	(ctx context.Context, email string) 						(int, error)
+	VerifyPassword		(ctx context.Context, userId int, password string) 			error
+	UpdatePassword		(ctx context.Context, userId int, hashedpassword string) 	error
+	SetEmail			(ctx context.Context, userId int, email string) 			error
+	FindUserForReset	(ctx context.Context, login string) 						(int, string, error)
+	DeleteUser			(ctx context.Context, userId int) 							([]string, error)
+
+	GetUserRole			(ctx context.Context, userId int) 							(string, error)
+	SetUserRole			(ctx context.Context, username, role string) 				error
+	BootstrapAdmin		(ctx context.Context, username string) 						(bool, error)
+}
+
+type AdminRepository interface {
+	ListUsers			(ctx context.Context, search string, limit, offset int) 	([]*UserSummary, error)
+	GetUserSummary		(ctx context.Context, userId int) 							(*UserSummary, error)
+	SetUserDisabled		(ctx context.Context, userId int, disabled bool) 			error
+	StorageStats		(ctx context.Context, days int) 							(*StorageStats, error)
+}
+
+type TwoFactorRepository interface {
+	SaveTOTPSecret		(ctx context.Context, userId int, secret string) 			error
+	ReplaceTOTPSecret	(ctx context.Context, userId int, previous, replacement string) error
+	GetTOTP				(ctx context.Context, userId int) 							(*TOTP, error)
+	EnableTOTP			(ctx context.Context, userId int, recoveryHashes []string) 	error
+	DisableTOTP			(ctx context.Context, userId int) 							error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryHashes []string) 	error
+	UseRecoveryCode		(ctx context.Context, userId int, hash string) 				error
+	CountRecoveryCodes	(ctx context.Context, userId int) 							(int, error)
+}
+
+type JobRepository interface {
+	EnqueueJob			(ctx context.Context, job *Job) 							(int64, error)
+	ClaimJob			(ctx context.Context, kinds []string, workerID string) 	(*Job, error)
+	CompleteJob			(ctx context.Context, jobID int64, workerID string) 		error
+	FailJob				(ctx context.Context, jobID int64, workerID, errMsg string, retryAt *time.Time) error
+	TouchJob			(ctx context.Context, jobID int64, workerID string) 		error
+	ReleaseJob			(ctx context.Context, jobID int64, workerID string) 		error
+	RequeueStaleJobs	(ctx context.Context, lockedBefore time.Time) 				(int64, error)
+	PurgeFinishedJobs	(ctx context.Context, finishedBefore time.Time) 			(int64, error)
+	ListJobs			(ctx context.Context, status string, limit int) 			([]*Job, error)
+	JobStats			(ctx context.Context) 										([]*JobStat, error)
+
+	UpsertSchedule		(ctx context.Context, schedule *JobSchedule) 				error
+	ListSchedules		(ctx context.Context) 										([]*JobSchedule, error)
+	FireDueSchedules	(ctx context.Context, next func(spec string, from time.Time) (time.Time, error)) (int, error)
+}
+
+type SessionRepository interface {
+	CreateSession		(ctx context.Context, session *Session) 					error
+	TouchSession		(ctx context.Context, sessionId, ip string, expiresAt time.Time) error
+	ListUserSessions	(ctx context.Context, userId int) 							([]*Session, error)
+	RevokeSession		(ctx context.Context, userId int, sessionId string) 		error
+	RevokeUserSessions	(ctx context.Context, userId int, exceptSessionId string) 	([]string, error)
+	PurgeEndedSessions	(ctx context.Context, endedBefore time.Time) 				(int64, error)
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey		(ctx context.Context, key *APIKey) 							error
+	ListAPIKeys			(ctx context.Context, userId int) 							([]*APIKey, error)
+	RevokeAPIKey		(ctx context.Context, userId int, keyId string) 			error
+	GetAPIKeyByHash		(ctx context.Context, hash string) 							(*APIKey, error)
+	GetAPIKey			(ctx context.Context, keyId string) 						(*APIKey, error)
+	TouchAPIKey			(ctx context.Context, keyId string) 						error
+}
+
+type SigningKeyRepository interface {
+	AddSigningKey		(ctx context.Context, key *SigningKey) 						error
+	ListSigningKeys		(ctx context.Context, retiredAfter time.Time) 				([]*SigningKey, error)
+	ReplaceSigningKey	(ctx context.Context, kid string, previous, replacement []byte) error
+	PurgeSigningKeys	(ctx context.Context, retiredBefore time.Time) 				(int64, error)
+}
+
+type AuditRepository interface {
+	RecordAuditEvent	(ctx context.Context, event *AuditEvent) 					error
+	ListAuditEvents		(ctx context.Context, filter *AuditFilter) 				([]*AuditEvent, error)
+	PurgeAuditEvents	(ctx context.Context, before time.Time) 					(int64, error)
+}
+
+type WebhookRepository interface {
+	CreateWebhook			(ctx context.Context, hook *Webhook) 						error
+	ListWebhooks			(ctx context.Context, userId int) 							([]*Webhook, error)
+	CountWebhooks			(ctx context.Context, userId int) 							(int, error)
+	GetWebhook				(ctx context.Context, webhookId string) 					(*Webhook, error)
+	DeleteWebhook			(ctx context.Context, userId int, webhookId string) 		error
+	ListSubscribedWebhooks	(ctx context.Context, userId int, event string) 			([]*Webhook, error)
+	RecordWebhookDelivery	(ctx context.Context, delivery *WebhookDelivery) 			error
+	ListWebhookDeliveries	(ctx context.Context, webhookId string, limit int) 		([]*WebhookDelivery, error)
+	PurgeWebhookDeliveries	(ctx context.Context, before time.Time) 					(int64, error)
+}
+
+// MigrationRepository changes schema, each call returns migrations applied or reverted by it
+type MigrationRepository interface {
+	MigrateUp			(ctx context.Context) 										([]*Migration, error)
+	MigrateDown			(ctx context.Context, steps int) 							([]*Migration, error)
+	MigrateTo			(ctx context.Context, version int) 							([]*Migration, error)
+	MigrationStatus		(ctx context.Context) 										([]*Migration, error)
 }
@@ -0,0 +1,49 @@
+package models
+
+// roles of users, stored on users and carried by access tokens
+const (
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+	RoleReadOnly = "read-only"
+)
+
+var AllRoles = []string{RoleUser, RoleAdmin, RoleReadOnly}
+
+func IsValidRole(role string) bool {
+	return HasRole(AllRoles, role)
+}
+
+// HasRole reports whether role is one of roles
+func HasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoleScopes are the most a credential of user with role may be granted, unknown role gets nothing
+func RoleScopes(role string) []string {
+	switch role {
+	case RoleUser, RoleAdmin:
+		return AllScopes
+	case RoleReadOnly:
+		return []string{ScopeRead}
+	default:
+		return nil
+	}
+}
+
+// IntersectScopes keeps scopes present in both lists
+func IntersectScopes(scopes, allowed []string) []string {
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if HasScope(allowed, scope) {
+			result = append(result, scope)
+		}
+	}
+
+	return result
+}
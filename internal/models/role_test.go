@@ -0,0 +1,28 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIntersectScopes(t *testing.T) {
+	cases := []struct {
+		name     string
+		scopes   []string
+		role     string
+		expected []string
+	}{
+		{"user keeps every granted scope", []string{ScopeRead, ScopeDelete}, RoleUser, []string{ScopeRead, ScopeDelete}},
+		{"admin keeps every granted scope", AllScopes, RoleAdmin, AllScopes},
+		{"read-only loses write scopes", []string{ScopeUpload, ScopeRead, ScopeShare}, RoleReadOnly, []string{ScopeRead}},
+		{"read-only without read gets nothing", []string{ScopeDelete}, RoleReadOnly, []string{}},
+		{"unknown role gets nothing", AllScopes, "intruder", []string{}},
+		{"nothing granted", nil, RoleAdmin, []string{}},
+	}
+
+	for _, tc := range cases {
+		if scopes := IntersectScopes(tc.scopes, RoleScopes(tc.role)); !slices.Equal(scopes, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, scopes)
+		}
+	}
+}
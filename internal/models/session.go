@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is a login of user on some device, lives as long as its refresh token family
+type Session struct {
+	SessionID  string    `json:"session_id"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current,omitempty"` // session of the request itself
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// FileStorage keeps blobs of uploaded files, each blob named by file uuid
+type FileStorage interface {
+	Create(name string) (PendingFile, error)
+	Remove(name string) error
+	Path(name string) string
+	List() ([]StoredBlob, error)
+	DiskUsage() (*DiskUsage, error)
+}
+
+// PendingFile is a blob being written, it becomes visible under its name only after Commit
+type PendingFile interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// StoredBlob describes an entry of storage directory
+type StoredBlob struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Temp    bool // unfinished upload
+}
+
+// DiskUsage of filesystem holding blobs, free is space available to the service
+type DiskUsage struct {
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
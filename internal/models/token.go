@@ -1,11 +1,31 @@
 package models
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// values of typ claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// CustomClaims of issued tokens, refresh tokens carry unique id in jti (RegisteredClaims.ID)
 type CustomClaims struct {
     UserID    int    `json:"user_id"`
     SessionID string `json:"session_id"`
+    TokenType string `json:"typ"`
+    Role      string `json:"role,omitempty"` // access tokens only
     jwt.RegisteredClaims
 }
+
+// SigningKey is private key of asymmetric algorithm, only one key is active (not retired) at a time
+type SigningKey struct {
+    KID        string
+    Algorithm  string
+    PrivateKey []byte // PKCS #8, DER, encrypted with key encryption key
+    CreatedAt  time.Time
+    RetiredAt  *time.Time
+}
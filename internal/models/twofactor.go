@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TOTP is authenticator app enrolment of user, it is not enforced until enrolment is confirmed with a code
+type TOTP struct {
+	UserID    int
+	Secret    string
+	Enabled   bool
+	CreatedAt time.Time
+	EnabledAt *time.Time
+}
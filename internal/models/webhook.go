@@ -0,0 +1,46 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// webhook event types
+const (
+	WebhookFileUploaded        = "file.uploaded"
+	WebhookFileDeleted         = "file.deleted"
+	WebhookFileRenamed         = "file.renamed"
+	WebhookShareLinkCreated    = "sharelink.created"
+	WebhookShareLinkDownloaded = "sharelink.downloaded"
+	WebhookPing                = "ping" // sent only by test delivery
+)
+
+var WebhookEvents = []string{WebhookFileUploaded, WebhookFileDeleted, WebhookFileRenamed, WebhookShareLinkCreated, WebhookShareLinkDownloaded}
+
+func IsValidWebhookEvent(event string) bool {
+	return slices.Contains(WebhookEvents, event)
+}
+
+// Webhook is endpoint of user receiving events it is subscribed to, secret signs payloads
+type Webhook struct {
+	WebhookID string    `json:"webhook_id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt to deliver event, retries share DeliveryID
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	DeliveryID string    `json:"delivery_id"`
+	WebhookID  string    `json:"webhook_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FakeNotifier is for local runs and tests: messages are logged and kept in memory
+type FakeNotifier struct {
+	logger *logrus.Logger
+
+	mu   sync.Mutex
+	sent []models.Message
+}
+
+func NewFakeNotifier(logger *logrus.Logger) *FakeNotifier {
+	return &FakeNotifier{logger: logger}
+}
+
+func (n *FakeNotifier) Send(_ context.Context, msg *models.Message) error {
+	n.mu.Lock()
+	n.sent = append(n.sent, *msg)
+	n.mu.Unlock()
+
+	n.logger.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Infof("Fake notifier message:\n%s", msg.Body)
+
+	return nil
+}
+
+// Sent returns copy of messages sent so far
+func (n *FakeNotifier) Sent() []models.Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]models.Message(nil), n.sent...)
+}
@@ -0,0 +1,28 @@
+// Delivery of messages to users, e.g. password reset links
+package notify
+
+import (
+	"fmt"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFake = "fake"
+)
+
+// New returns notifier selected by config
+func New(cfg config.NotifyConfig, logger *logrus.Logger) (models.Notifier, error) {
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPNotifier(cfg.SMTP, cfg.From), nil
+	case DriverFake, "":
+		return NewFakeNotifier(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown notify driver %q", cfg.Driver)
+	}
+}
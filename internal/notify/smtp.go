@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+)
+
+// SMTPNotifier sends mail through relay, STARTTLS is used when server offers it
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPNotifier(cfg config.SMTPConfig, from string) *SMTPNotifier {
+	n := &SMTPNotifier{
+		addr: net.JoinHostPort(cfg.Host, cfg.Port),
+		from: from,
+	}
+
+	if cfg.Username != "" {
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return n
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg *models.Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+
+	body := strings.Join([]string{
+		"From: " + n.from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	// net/smtp has no context support, so sending runs aside and is abandoned on cancel
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(body))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"up-down-server/internal/metrics"
+	"up-down-server/internal/tracing"
+
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentHook observes latency and traces every command. redis.Nil is a normal miss and not an error.
+// Keys are not put into spans, some of them are credentials like share links and session ids
+type instrumentHook struct{}
+
+func (instrumentHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := next(ctx, network, addr)
+		metrics.CacheDuration.WithLabelValues("dial", metrics.Result(err)).Observe(time.Since(start).Seconds())
+		return conn, err
+	}
+}
+
+func (instrumentHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := startSpan(ctx, cmd.Name())
+		start := time.Now()
+
+		err := next(ctx, cmd)
+
+		metrics.CacheDuration.WithLabelValues(cmd.Name(), metrics.Result(failure(err))).Observe(time.Since(start).Seconds())
+		tracing.End(span, failure(err))
+		return err
+	}
+}
+
+func (instrumentHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := startSpan(ctx, "pipeline")
+		start := time.Now()
+
+		err := next(ctx, cmds)
+
+		metrics.CacheDuration.WithLabelValues("pipeline", metrics.Result(failure(err))).Observe(time.Since(start).Seconds())
+		tracing.End(span, failure(err))
+		return err
+	}
+}
+
+func startSpan(ctx context.Context, command string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "redis."+command, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemNameRedis,
+		semconv.DBOperationName(command),
+	))
+}
+
+// failure is err unless it is redis.Nil
+func failure(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+
+	return err
+}
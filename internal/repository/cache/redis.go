@@ -27,6 +27,8 @@ func NewRedisClient (cfg config.RedisConfig, shutdownChan models.ShutdownChannel
 		},
 	)
 
+	conn.AddHook(instrumentHook{})
+
 	if err := conn.Ping(context.Background()).Err(); err != nil {
 		msg := fmt.Sprintf("failed to connect to db: %v\n", err)
 		shutdownChan.Send(models.ShutdownMessage, origin, msg)
@@ -50,6 +52,77 @@ func (c *Cache) Del(ctx context.Context, key string) error {
 	return c.connection.Del(ctx, key).Err()
 }
 
+// DelMatch removes keys matching glob pattern and returns their count, keys are walked with SCAN so redis is not blocked
+func (c *Cache) DelMatch(ctx context.Context, pattern string) (int64, error) {
+	var (
+		deleted int64
+		cursor  uint64
+	)
+
+	for {
+		keys, next, err := c.connection.Scan(ctx, cursor, pattern, 100).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) > 0 {
+			n, err := c.connection.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+
+		if cursor = next; cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
 func (c *Cache) SetNX(ctx context.Context, key string, value any, ttl time.Duration) *redis.BoolCmd {
 	return c.connection.SetNX(ctx, key, value, ttl)
-}
\ No newline at end of file
+}
+
+// Swap atomically replaces value of existing key and returns previous one, redis.Nil when key is absent
+func (c *Cache) Swap(ctx context.Context, key string, value any, ttl time.Duration) (string, error) {
+	return c.connection.SetArgs(ctx, key, value, redis.SetArgs{
+		Mode: "XX",
+		TTL:  ttl,
+		Get:  true,
+	}).Result()
+}
+
+// GetDel reads and removes key in one step, so value can be consumed only once
+func (c *Cache) GetDel(ctx context.Context, key string) (string, error) {
+	return c.connection.GetDel(ctx, key).Result()
+}
+
+// Incr increments counter, ttl is set when counter is created so window starts with the first hit
+func (c *Cache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := c.connection.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, ttl)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (c *Cache) Publish(ctx context.Context, channel string, message any) error {
+	return c.connection.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe listens to channels, subscription is restored by client after reconnect
+func (c *Cache) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return c.connection.Subscribe(ctx, channels...)
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.connection.Ping(ctx).Err()
+}
+
+func (c *Cache) Close() error {
+	return c.connection.Close()
+}
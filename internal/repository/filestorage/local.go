@@ -0,0 +1,147 @@
+package filestorage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"up-down-server/internal/models"
+)
+
+const (
+	origin     = "FileStorage"
+	tempPrefix = ".tmp-"
+	dirMode    = 0o755
+	fileMode   = 0o644
+)
+
+// LocalStorage stores blobs in a single directory on local disk.
+// Blobs are written into temp file, synced and renamed, so a blob under its final name is always complete.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string, shutdownChan models.ShutdownChannel) *LocalStorage {
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		msg := fmt.Sprintf("failed to make directory %s: %v", dir, err)
+		shutdownChan.Send(models.ShutdownMessage, origin, msg)
+		return nil
+	}
+
+	return &LocalStorage{
+		dir: dir,
+	}
+}
+
+func (s *LocalStorage) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *LocalStorage) Create(name string) (models.PendingFile, error) {
+	f, err := os.OpenFile(s.Path(tempPrefix+name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pendingFile{
+		File:  f,
+		final: s.Path(name),
+	}, nil
+}
+
+// Remove deletes blob, missing blob is not an error
+func (s *LocalStorage) Remove(name string) error {
+	if err := os.Remove(s.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) List() ([]models.StoredBlob, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make([]models.StoredBlob, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // removed while listing
+			}
+			return nil, err
+		}
+
+		blobs = append(blobs, models.StoredBlob{
+			Name:    entry.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Temp:    strings.HasPrefix(entry.Name(), tempPrefix),
+		})
+	}
+
+	return blobs, nil
+}
+
+type pendingFile struct {
+	*os.File
+	final string
+	done  bool
+}
+
+func (p *pendingFile) Commit() error {
+	if p.done {
+		return errors.New("pending file already finished")
+	}
+	p.done = true
+
+	if err := p.File.Sync(); err != nil {
+		p.cleanup()
+		return err
+	}
+
+	if err := p.File.Close(); err != nil {
+		os.Remove(p.File.Name())
+		return err
+	}
+
+	if err := os.Rename(p.File.Name(), p.final); err != nil {
+		os.Remove(p.File.Name())
+		return err
+	}
+
+	return syncDir(filepath.Dir(p.final))
+}
+
+func (p *pendingFile) Abort() error {
+	if p.done {
+		return nil
+	}
+	p.done = true
+
+	return p.cleanup()
+}
+
+func (p *pendingFile) cleanup() error {
+	p.File.Close()
+	return os.Remove(p.File.Name())
+}
+
+// syncDir makes rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
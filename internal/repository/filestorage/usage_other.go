@@ -0,0 +1,13 @@
+//go:build !unix
+
+package filestorage
+
+import (
+	"errors"
+
+	"up-down-server/internal/models"
+)
+
+func (s *LocalStorage) DiskUsage() (*models.DiskUsage, error) {
+	return nil, errors.New("disk usage is not supported on this platform")
+}
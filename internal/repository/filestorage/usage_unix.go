@@ -0,0 +1,21 @@
+//go:build unix
+
+package filestorage
+
+import (
+	"up-down-server/internal/models"
+
+	"golang.org/x/sys/unix"
+)
+
+func (s *LocalStorage) DiskUsage() (*models.DiskUsage, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(s.dir, &stat); err != nil {
+		return nil, err
+	}
+
+	return &models.DiskUsage{
+		FreeBytes:  uint64(stat.Bavail) * uint64(stat.Bsize), // blocks reserved for root are not available to service
+		TotalBytes: uint64(stat.Blocks) * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,136 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"up-down-server/internal/models"
+)
+
+const userSummarySelect = `
+	SELECT u.user_id, u.username, COALESCE(u.email, ''), u.role, u.created_at, u.disabled_at,
+		COUNT(f.file_uuid), COALESCE(SUM(f.size::bigint), 0), MAX(f.uploaded_at)
+	FROM users u LEFT JOIN files f ON f.user_id = u.user_id`
+
+func scanUserSummary(row rowScanner) (*models.UserSummary, error) {
+	var (
+		user                              = new(models.UserSummary)
+		createdAt, disabledAt, lastUpload sql.NullTime
+	)
+
+	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &createdAt, &disabledAt, &user.Files, &user.BytesUsed, &lastUpload); err != nil {
+		return nil, err
+	}
+
+	if createdAt.Valid {
+		user.CreatedAt = &createdAt.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	if lastUpload.Valid {
+		user.LastUploadAt = &lastUpload.Time
+	}
+
+	return user, nil
+}
+
+// ListUsers returns users ordered by id, search matches part of username or email ignoring case
+func (p *PostgreSQL) ListUsers(ctx context.Context, search string, limit, offset int) ([]*models.UserSummary, error) {
+	rows, err := p.conn.QueryContext(ctx, userSummarySelect+`
+		WHERE $1 = '' OR strpos(lower(u.username), lower($1)) > 0 OR strpos(lower(COALESCE(u.email, '')), lower($1)) > 0
+		GROUP BY u.user_id
+		ORDER BY u.user_id
+		LIMIT $2 OFFSET $3`, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.UserSummary
+	for rows.Next() {
+		user, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) GetUserSummary(ctx context.Context, userId int) (*models.UserSummary, error) {
+	user, err := scanUserSummary(p.conn.QueryRowContext(ctx, userSummarySelect+`
+		WHERE u.user_id = $1
+		GROUP BY u.user_id`, userId))
+	if err == sql.ErrNoRows {
+		return nil, errors.New(NotFound)
+	}
+
+	return user, err
+}
+
+func (p *PostgreSQL) SetUserDisabled(ctx context.Context, userId int, disabled bool) error {
+	res, err := p.conn.ExecContext(ctx, `
+		UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) ELSE NULL END
+		WHERE user_id = $1`, userId, disabled)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// StorageStats counts users and files, uploads are grouped by day for the last days
+func (p *PostgreSQL) StorageStats(ctx context.Context, days int) (*models.StorageStats, error) {
+	stats := new(models.StorageStats)
+
+	if err := p.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE disabled_at IS NOT NULL) FROM users`).Scan(&stats.Users, &stats.DisabledUsers); err != nil {
+		return nil, err
+	}
+
+	if err := p.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(size::bigint), 0) FROM files`).Scan(&stats.Files, &stats.Bytes); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.conn.QueryContext(ctx, `
+		SELECT to_char(date_trunc('day', uploaded_at), 'YYYY-MM-DD'), COUNT(*), COALESCE(SUM(size::bigint), 0)
+		FROM files
+		WHERE uploaded_at >= date_trunc('day', NOW()) - make_interval(days => $1 - 1)
+		GROUP BY 1
+		ORDER BY 1`, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.UploadsPerDay = []*models.DailyUploads{}
+	for rows.Next() {
+		day := new(models.DailyUploads)
+		if err := rows.Scan(&day.Day, &day.Files, &day.Bytes); err != nil {
+			return nil, err
+		}
+
+		stats.UploadsPerDay = append(stats.UploadsPerDay, day)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
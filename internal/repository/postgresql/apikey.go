@@ -0,0 +1,114 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `key_id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, expires_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key        = new(models.APIKey)
+		lastUsedAt sql.NullTime
+		expiresAt  sql.NullTime
+	)
+
+	if err := row.Scan(&key.KeyID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &key.CreatedAt, &lastUsedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+
+	return key, nil
+}
+
+func (p *PostgreSQL) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	_, err := p.conn.ExecContext(ctx,
+		`INSERT INTO api_keys (key_id, user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.KeyID, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt)
+	return err
+}
+
+// ListAPIKeys returns not revoked keys of user, expired ones included
+func (p *PostgreSQL) ListAPIKeys(ctx context.Context, userId int) ([]*models.APIKey, error) {
+	rows, err := p.conn.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) RevokeAPIKey(ctx context.Context, userId int, keyId string) error {
+	res, err := p.conn.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE key_id = $1 AND user_id = $2 AND revoked_at IS NULL`, keyId, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash returns usable key with role of its owner, NotFound for unknown, revoked or expired one
+func (p *PostgreSQL) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	return p.getAPIKeyBy(ctx, "key_hash", hash)
+}
+
+// GetAPIKey is GetAPIKeyByHash for key already authenticated, used to re-check it
+func (p *PostgreSQL) GetAPIKey(ctx context.Context, keyId string) (*models.APIKey, error) {
+	return p.getAPIKeyBy(ctx, "key_id", keyId)
+}
+
+// getAPIKeyBy looks usable key up by unique column, column is never taken from input
+func (p *PostgreSQL) getAPIKeyBy(ctx context.Context, column, value string) (*models.APIKey, error) {
+	key, err := scanAPIKey(p.conn.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+column+` = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`, value))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New(NotFound)
+		}
+		return nil, err
+	}
+
+	if key.Role, err = p.GetUserRole(ctx, key.UserID); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (p *PostgreSQL) TouchAPIKey(ctx context.Context, keyId string) error {
+	_, err := p.conn.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE key_id = $1`, keyId)
+	return err
+}
@@ -0,0 +1,112 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"up-down-server/internal/models"
+)
+
+func (p *PostgreSQL) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	var details []byte
+	if len(event.Details) > 0 {
+		raw, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = raw
+	}
+
+	return p.conn.QueryRowContext(ctx,
+		`INSERT INTO audit_events (event, actor_id, owner_id, file_uuid, ip, details) VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, ''), $6)
+		RETURNING id, occurred_at`,
+		event.Event, event.ActorID, event.OwnerID, event.FileUUID, event.IP, details).Scan(&event.ID, &event.OccurredAt)
+}
+
+// ListAuditEvents returns events newest first, page continues from filter.BeforeID
+func (p *PostgreSQL) ListAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	query := `SELECT id, occurred_at, event, actor_id, owner_id, COALESCE(file_uuid::text, ''), COALESCE(ip, ''), details FROM audit_events WHERE TRUE`
+	var args []any
+
+	if filter.UserID > 0 {
+		args = append(args, filter.UserID)
+		query += fmt.Sprintf(` AND (actor_id = $%d OR owner_id = $%d)`, len(args), len(args))
+	}
+	if filter.Event != "" {
+		args = append(args, filter.Event)
+		query += fmt.Sprintf(` AND event = $%d`, len(args))
+	}
+	if filter.FileUUID != "" {
+		args = append(args, filter.FileUUID)
+		query += fmt.Sprintf(` AND file_uuid = $%d`, len(args))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		query += fmt.Sprintf(` AND occurred_at >= $%d`, len(args))
+	}
+	if filter.Until != nil {
+		args = append(args, *filter.Until)
+		query += fmt.Sprintf(` AND occurred_at < $%d`, len(args))
+	}
+	if filter.BeforeID > 0 {
+		args = append(args, filter.BeforeID)
+		query += fmt.Sprintf(` AND id < $%d`, len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := p.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*models.AuditEvent{}
+	for rows.Next() {
+		var (
+			event   = new(models.AuditEvent)
+			actorId sql.NullInt64
+			ownerId sql.NullInt64
+			details []byte
+		)
+
+		if err := rows.Scan(&event.ID, &event.OccurredAt, &event.Event, &actorId, &ownerId, &event.FileUUID, &event.IP, &details); err != nil {
+			return nil, err
+		}
+
+		if actorId.Valid {
+			id := int(actorId.Int64)
+			event.ActorID = &id
+		}
+		if ownerId.Valid {
+			id := int(ownerId.Int64)
+			event.OwnerID = &id
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &event.Details); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) PurgeAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx, `DELETE FROM audit_events WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
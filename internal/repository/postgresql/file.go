@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"time"
 
 	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
 )
 
 const (
@@ -14,14 +18,46 @@ const (
 	UnAuthorized = "unauthorized"
 )
 
+// columns selected for every FileMetaData read, order must match scanFileMeta
+const fileColumns = `file_uuid, filename, filepath, uploaded_at, size, mime_type, user_id, COALESCE(sha256, ''), integrity_status, checked_at, expires_at`
+
+// condition hiding expired files from owners, they are removed by sweeper later
+const notExpired = `(expires_at IS NULL OR expires_at > NOW())`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFileMeta(row rowScanner) (*models.FileMetaData, error) {
+	var (
+		fmd       = new(models.FileMetaData)
+		checkedAt sql.NullTime
+		expiresAt sql.NullTime
+	)
+
+	if err := row.Scan(&fmd.FileUUID, &fmd.FileName, &fmd.FilePath, &fmd.UploadedAt, &fmd.Size, &fmd.MimeType, &fmd.UserID, &fmd.SHA256, &fmd.IntegrityStatus, &checkedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	if checkedAt.Valid {
+		fmd.CheckedAt = &checkedAt.Time
+	}
+	if expiresAt.Valid {
+		fmd.ExpiresAt = &expiresAt.Time
+	}
+	fmd.FileExt = filepath.Ext(fmd.FileName)
+
+	return fmd, nil
+}
+
 func (p *PostgreSQL) InsertFileName(ctx context.Context, file *models.FileMetaData) error {
-	stmt, err := p.conn.PrepareContext(ctx, `INSERT INTO files (file_uuid, filename, filepath, size, mime_type, user_id) VALUES ($1, $2, $3, $4, $5, $6)`)
+	stmt, err := p.conn.PrepareContext(ctx, `INSERT INTO files (file_uuid, filename, filepath, size, mime_type, user_id, sha256, integrity_status, expires_at) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, file.FileUUID, file.FileName, file.FilePath, file.Size, file.MimeType, file.UserID)
+	_, err = stmt.ExecContext(ctx, file.FileUUID, file.FileName, file.FilePath, file.Size, file.MimeType, file.UserID, file.SHA256, file.IntegrityStatus, file.ExpiresAt)
 	if err != nil {
 		return err
 	}
@@ -56,22 +92,13 @@ func (p *PostgreSQL) DeleteFileByUUID(ctx context.Context, uuidOfFile string) er
 }
 
 func (p *PostgreSQL) GetFileMeta(ctx context.Context, uuidOfFile string) (*models.FileMetaData, error) {
-	stmt, err := p.conn.PrepareContext(ctx, `SELECT file_uuid, filename, filepath, uploaded_at, size, mime_type, user_id FROM files WHERE file_uuid = $1 LIMIT 1`)
+	stmt, err := p.conn.PrepareContext(ctx, `SELECT `+fileColumns+` FROM files WHERE file_uuid = $1 AND `+notExpired+` LIMIT 1`)
 	if err != nil {
 		return nil, err // 500
 	}
 	defer stmt.Close()
 
-	var metadata *models.FileMetaData = &models.FileMetaData{}
-	err = stmt.QueryRowContext(ctx, uuidOfFile).Scan(
-		&metadata.FileUUID,
-		&metadata.FileName,
-		&metadata.FilePath,
-		&metadata.UploadedAt,
-		&metadata.Size,
-		&metadata.MimeType,
-		&metadata.UserID,
-	)
+	metadata, err := scanFileMeta(stmt.QueryRowContext(ctx, uuidOfFile))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New(NotFound) // 404
@@ -79,6 +106,10 @@ func (p *PostgreSQL) GetFileMeta(ctx context.Context, uuidOfFile string) (*model
 		return nil, err // 500
 	}
 
+	if err := p.loadLabels(ctx, metadata); err != nil {
+		return nil, err // 500
+	}
+
 	return metadata, nil
 }
 
@@ -99,7 +130,7 @@ func (p *PostgreSQL) GetUUID(ctx context.Context, filename string) (string, erro
 }
 
 func (p *PostgreSQL) GetAllRecords(ctx context.Context) ([]*models.FileMetaData, error) {
-	stmt, err := p.conn.PrepareContext(ctx, `SELECT file_uuid, filename, filepath, uploaded_at, size, mime_type, user_id FROM files`)
+	stmt, err := p.conn.PrepareContext(ctx, `SELECT `+fileColumns+` FROM files`)
 	if err != nil {
 		return nil, err
 	}
@@ -117,13 +148,11 @@ func (p *PostgreSQL) GetAllRecords(ctx context.Context) ([]*models.FileMetaData,
 	defer rows.Close()
 
 	for rows.Next() {
-		fmd := new(models.FileMetaData)
-		if err := rows.Scan(&fmd.FileUUID, &fmd.FileName, &fmd.FilePath, &fmd.UploadedAt, &fmd.Size, &fmd.MimeType, &fmd.UserID); err != nil {
+		fmd, err := scanFileMeta(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		fmd.FileExt = filepath.Ext(fmd.FileName)
-
 		result = append(result, fmd)
 	}
 
@@ -134,15 +163,31 @@ func (p *PostgreSQL) GetAllRecords(ctx context.Context) ([]*models.FileMetaData,
 	return result, nil
 }
 
-func (p *PostgreSQL) GetUserRecords(ctx context.Context, userId int) ([]*models.FileMetaData, error) {
-	stmt, err := p.conn.PrepareContext(ctx, `SELECT file_uuid, filename, filepath, uploaded_at, size, mime_type, user_id FROM files WHERE user_id = $1`)
+// GetUserRecords lists not expired files of user, filter is optional
+func (p *PostgreSQL) GetUserRecords(ctx context.Context, userId int, filter *models.FileFilter) ([]*models.FileMetaData, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE user_id = $1 AND ` + notExpired
+	args := []any{userId}
+
+	if filter != nil {
+		if len(filter.Tags) > 0 {
+			args = append(args, pq.Array(filter.Tags), len(filter.Tags))
+			query += fmt.Sprintf(` AND file_uuid IN (SELECT file_uuid FROM tags WHERE tag = ANY($%d) GROUP BY file_uuid HAVING COUNT(*) = $%d)`, len(args)-1, len(args))
+		}
+
+		for key, value := range filter.Attributes {
+			args = append(args, key, value)
+			query += fmt.Sprintf(` AND EXISTS (SELECT 1 FROM file_attributes a WHERE a.file_uuid = files.file_uuid AND a.key = $%d AND a.value = $%d)`, len(args)-1, len(args))
+		}
+	}
+
+	stmt, err := p.conn.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
 	var result []*models.FileMetaData
-	rows, err := stmt.QueryContext(ctx, userId)
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -153,13 +198,11 @@ func (p *PostgreSQL) GetUserRecords(ctx context.Context, userId int) ([]*models.
 	defer rows.Close()
 
 	for rows.Next() {
-		fmd := new(models.FileMetaData)
-		if err := rows.Scan(&fmd.FileUUID, &fmd.FileName, &fmd.FilePath, &fmd.UploadedAt, &fmd.Size, &fmd.MimeType, &fmd.UserID); err != nil {
+		fmd, err := scanFileMeta(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		fmd.FileExt = filepath.Ext(fmd.FileName)
-
 		result = append(result, fmd)
 	}
 
@@ -167,6 +210,10 @@ func (p *PostgreSQL) GetUserRecords(ctx context.Context, userId int) ([]*models.
 		return nil, err
 	}
 
+	if err := p.loadLabels(ctx, result...); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -195,3 +242,68 @@ func (p *PostgreSQL) RenameFileName(ctx context.Context, updatedFilename, uuidOf
 
 	return nil
 }
+
+// UpdateIntegrity records the result of an integrity check, checksum is stored only when not empty
+func (p *PostgreSQL) UpdateIntegrity(ctx context.Context, uuidOfFile, checksum, status string) error {
+	stmt, err := p.conn.PrepareContext(ctx, `UPDATE files SET sha256 = COALESCE(NULLIF($1, ''), sha256), integrity_status = $2, checked_at = NOW() WHERE file_uuid = $3`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, checksum, status, uuidOfFile)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// SetExpiry changes lifetime of not yet expired file, nil removes expiry
+func (p *PostgreSQL) SetExpiry(ctx context.Context, uuidOfFile string, expiresAt *time.Time) error {
+	stmt, err := p.conn.PrepareContext(ctx, `UPDATE files SET expires_at = $1 WHERE file_uuid = $2 AND `+notExpired)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, expiresAt, uuidOfFile)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// GetExpiredRecords returns up to limit files whose lifetime is over
+func (p *PostgreSQL) GetExpiredRecords(ctx context.Context, limit int) ([]*models.FileMetaData, error) {
+	rows, err := p.conn.QueryContext(ctx, `SELECT `+fileColumns+` FROM files WHERE expires_at <= NOW() ORDER BY expires_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.FileMetaData
+	for rows.Next() {
+		fmd, err := scanFileMeta(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, fmd)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
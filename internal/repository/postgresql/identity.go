@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const AlreadyExists = "already exists"
+
+// GetUserIDByIdentity finds user linked to subject of external identity provider
+func (p *PostgreSQL) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int, error) {
+	var userId int
+	err := p.conn.QueryRowContext(ctx,
+		`SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`, issuer, subject).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, errors.New(NotFound)
+	} else if err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// LinkIdentityByUsername attaches external identity to existing user with given username
+func (p *PostgreSQL) LinkIdentityByUsername(ctx context.Context, username, issuer, subject string) (int, error) {
+	var userId int
+	err := p.conn.QueryRowContext(ctx, `
+		INSERT INTO user_identities (issuer, subject, user_id)
+		SELECT $2, $3, user_id FROM users WHERE username = $1
+		RETURNING user_id`, username, issuer, subject).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, errors.New(NotFound)
+	} else if err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// ProvisionUser creates user without password linked to external identity,
+// AlreadyExists is returned when username is taken
+func (p *PostgreSQL) ProvisionUser(ctx context.Context, username, issuer, subject string) (int, error) {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// empty password never matches bcrypt hash, so such user can log in only through provider
+	var userId int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (username, password) VALUES ($1, '') ON CONFLICT (username) DO NOTHING RETURNING user_id`, username).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, errors.New(AlreadyExists)
+	} else if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)`, issuer, subject, userId); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
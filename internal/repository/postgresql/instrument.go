@@ -0,0 +1,250 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"up-down-server/internal/metrics"
+	"up-down-server/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Database calls are observed and traced at driver level, so queries inside transactions and prepared statements are covered too.
+// Wrappers forward optional interfaces of pq connection, database/sql would fall back to slower paths otherwise
+
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	call := begin(ctx, "connect", "")
+	conn, err := c.Connector.Connect(ctx)
+	call.end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	call := begin(ctx, "prepare", query)
+
+	var stmt driver.Stmt
+	var err error
+	if prep, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = prep.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+
+	call.end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	call := begin(ctx, "exec", query)
+	res, err := execer.ExecContext(ctx, query, args)
+	call.end(err)
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	call := begin(ctx, "query", query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	call.end(err)
+	return rows, err
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	call := begin(ctx, "begin", "")
+
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+
+	call.end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	pinger, ok := c.Conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+
+	call := begin(ctx, "ping", "")
+	err := pinger.Ping(ctx)
+	call.end(err)
+	return err
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	call := begin(ctx, "exec", s.query)
+
+	var res driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = execer.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedToValues(args))
+	}
+
+	call.end(err)
+	return res, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	call := begin(ctx, "query", s.query)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedToValues(args))
+	}
+
+	call.end(err)
+	return rows, err
+}
+
+// instrumentedTx keeps ctx of BeginTx, driver gets none on commit
+type instrumentedTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *instrumentedTx) Commit() error {
+	call := begin(t.ctx, "commit", "")
+	err := t.Tx.Commit()
+	call.end(err)
+	return err
+}
+
+func (t *instrumentedTx) Rollback() error {
+	call := begin(t.ctx, "rollback", "")
+	err := t.Tx.Rollback()
+	call.end(err)
+	return err
+}
+
+type call struct {
+	operation string
+	start     time.Time
+	span      trace.Span
+}
+
+// begin starts span of database call, it is named after repository method making the call, e.g. PostgreSQL.InsertFileName
+func begin(ctx context.Context, operation, query string) call {
+	attrs := []attribute.KeyValue{semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(operation)}
+	if query != "" {
+		attrs = append(attrs, semconv.DBQueryText(query))
+	}
+
+	_, span := tracing.Tracer().Start(ctx, spanName(operation), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	return call{operation: operation, start: time.Now(), span: span}
+}
+
+func (c call) end(err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// database/sql retries another way, that call is observed instead
+		c.span.End()
+		return
+	}
+
+	metrics.DBDuration.WithLabelValues(c.operation, metrics.Result(err)).Observe(time.Since(c.start).Seconds())
+	tracing.End(c.span, err)
+}
+
+var methodPrefix = reflect.TypeOf(PostgreSQL{}).PkgPath() + ".(*PostgreSQL)."
+
+// spanName finds method of PostgreSQL up the stack, database/sql calls driver in goroutine of caller
+func spanName(operation string) string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if method, ok := strings.CutPrefix(frame.Function, methodPrefix); ok {
+			method, _, _ = strings.Cut(method, ".") // closures are reported as Method.func1
+			return "PostgreSQL." + method
+		}
+
+		if !more {
+			return "postgresql." + operation
+		}
+	}
+}
+
+func namedToValues(named []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(named))
+	for i, arg := range named {
+		values[i] = arg.Value
+	}
+
+	return values
+}
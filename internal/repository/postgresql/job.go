@@ -0,0 +1,328 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// schedule whose spec can not be parsed is retried after this delay
+const badScheduleDelay = time.Hour
+
+const jobColumns = `job_id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(last_error, ''), COALESCE(locked_by, ''), created_at, updated_at`
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	job := new(models.Job)
+	if err := row.Scan(&job.ID, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.LockedBy, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (p *PostgreSQL) EnqueueJob(ctx context.Context, job *models.Job) (int64, error) {
+	payload := []byte(job.Payload)
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	runAt := job.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+
+	var id int64
+	err := p.conn.QueryRowContext(ctx,
+		`INSERT INTO jobs (kind, payload, max_attempts, run_at) VALUES ($1, $2, $3, $4) RETURNING job_id`,
+		job.Kind, payload, job.MaxAttempts, runAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ClaimJob locks the oldest due job of given kinds, other workers skip locked rows instead of waiting.
+// Returns nil job when there is nothing to do.
+func (p *PostgreSQL) ClaimJob(ctx context.Context, kinds []string, workerID string) (*models.Job, error) {
+	row := p.conn.QueryRowContext(ctx, `
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_by = $2, locked_at = NOW(), updated_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM jobs
+			WHERE status = 'queued' AND run_at <= NOW() AND kind = ANY($1)
+			ORDER BY run_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING `+jobColumns, pq.Array(kinds), workerID)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// CompleteJob marks job of worker as succeeded. NotFound when worker lost the job meanwhile,
+// e.g. it was requeued as stale and claimed by another worker whose state must not be overwritten
+func (p *PostgreSQL) CompleteJob(ctx context.Context, jobID int64, workerID string) error {
+	res, err := p.conn.ExecContext(ctx,
+		`UPDATE jobs SET status = 'succeeded', last_error = NULL, locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE job_id = $1 AND status = 'running' AND locked_by = $2`, jobID, workerID)
+	if err != nil {
+		return err
+	}
+
+	return ownedJobUpdated(res)
+}
+
+// FailJob puts job of worker back to queue until retryAt, nil retryAt marks job as failed for good.
+// NotFound when worker lost the job meanwhile
+func (p *PostgreSQL) FailJob(ctx context.Context, jobID int64, workerID, errMsg string, retryAt *time.Time) error {
+	var (
+		res sql.Result
+		err error
+	)
+	if retryAt != nil {
+		res, err = p.conn.ExecContext(ctx,
+			`UPDATE jobs SET status = 'queued', run_at = $3, last_error = $4, locked_by = NULL, locked_at = NULL, updated_at = NOW()
+			WHERE job_id = $1 AND status = 'running' AND locked_by = $2`,
+			jobID, workerID, *retryAt, errMsg)
+	} else {
+		res, err = p.conn.ExecContext(ctx,
+			`UPDATE jobs SET status = 'failed', last_error = $3, locked_by = NULL, locked_at = NULL, updated_at = NOW()
+			WHERE job_id = $1 AND status = 'running' AND locked_by = $2`,
+			jobID, workerID, errMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ownedJobUpdated(res)
+}
+
+func ownedJobUpdated(res sql.Result) error {
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// ReleaseJob returns job interrupted by shutdown back to queue, attempt taken by claim is given back
+func (p *PostgreSQL) ReleaseJob(ctx context.Context, jobID int64, workerID string) error {
+	_, err := p.conn.ExecContext(ctx,
+		`UPDATE jobs SET status = 'queued', attempts = GREATEST(attempts - 1, 0), locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE job_id = $1 AND status = 'running' AND locked_by = $2`, jobID, workerID)
+	return err
+}
+
+// TouchJob refreshes lock of running job, so job running longer than stale period is not taken for lost
+func (p *PostgreSQL) TouchJob(ctx context.Context, jobID int64, workerID string) error {
+	_, err := p.conn.ExecContext(ctx,
+		`UPDATE jobs SET locked_at = NOW() WHERE job_id = $1 AND status = 'running' AND locked_by = $2`, jobID, workerID)
+	return err
+}
+
+// RequeueStaleJobs returns jobs of crashed workers back to queue
+func (p *PostgreSQL) RequeueStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx, `
+		UPDATE jobs SET
+			status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'queued' END,
+			last_error = 'worker lost', locked_by = NULL, locked_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < $1`, lockedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (p *PostgreSQL) PurgeFinishedJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx,
+		`DELETE FROM jobs WHERE status IN ('succeeded', 'failed') AND updated_at < $1`, finishedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ListJobs returns latest jobs, empty status means any
+func (p *PostgreSQL) ListJobs(ctx context.Context, status string, limit int) ([]*models.Job, error) {
+	rows, err := p.conn.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE ($1 = '' OR status = $1) ORDER BY updated_at DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) JobStats(ctx context.Context) ([]*models.JobStat, error) {
+	rows, err := p.conn.QueryContext(ctx, `SELECT kind, status, COUNT(*) FROM jobs GROUP BY kind, status ORDER BY kind, status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.JobStat
+	for rows.Next() {
+		stat := new(models.JobStat)
+		if err := rows.Scan(&stat.Kind, &stat.Status, &stat.Count); err != nil {
+			return nil, err
+		}
+
+		result = append(result, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpsertSchedule registers schedule, next run is kept unless spec has changed
+func (p *PostgreSQL) UpsertSchedule(ctx context.Context, schedule *models.JobSchedule) error {
+	payload := []byte(schedule.Payload)
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	_, err := p.conn.ExecContext(ctx, `
+		INSERT INTO job_schedules (name, kind, spec, payload, max_attempts, next_run_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			kind = EXCLUDED.kind,
+			payload = EXCLUDED.payload,
+			max_attempts = EXCLUDED.max_attempts,
+			next_run_at = CASE WHEN job_schedules.spec = EXCLUDED.spec THEN job_schedules.next_run_at ELSE EXCLUDED.next_run_at END,
+			spec = EXCLUDED.spec`,
+		schedule.Name, schedule.Kind, schedule.Spec, payload, schedule.MaxAttempts, schedule.NextRunAt)
+
+	return err
+}
+
+func (p *PostgreSQL) ListSchedules(ctx context.Context) ([]*models.JobSchedule, error) {
+	rows, err := p.conn.QueryContext(ctx, `SELECT name, kind, spec, payload, max_attempts, next_run_at, last_run_at FROM job_schedules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.JobSchedule
+	for rows.Next() {
+		var (
+			schedule  = new(models.JobSchedule)
+			lastRunAt sql.NullTime
+		)
+
+		if err := rows.Scan(&schedule.Name, &schedule.Kind, &schedule.Spec, &schedule.Payload, &schedule.MaxAttempts, &schedule.NextRunAt, &lastRunAt); err != nil {
+			return nil, err
+		}
+
+		if lastRunAt.Valid {
+			schedule.LastRunAt = &lastRunAt.Time
+		}
+
+		result = append(result, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FireDueSchedules enqueues a job for every due schedule and moves it to the next run.
+// Rows are locked with SKIP LOCKED, so only one instance fires a schedule. Schedules with spec
+// that can not be parsed are skipped and postponed, their errors are returned along with number of fired ones
+func (p *PostgreSQL) FireDueSchedules(ctx context.Context, next func(spec string, from time.Time) (time.Time, error)) (int, error) {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT name, kind, spec, payload, max_attempts FROM job_schedules WHERE next_run_at <= NOW() FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []*models.JobSchedule
+	for rows.Next() {
+		schedule := new(models.JobSchedule)
+		if err := rows.Scan(&schedule.Name, &schedule.Kind, &schedule.Spec, &schedule.Payload, &schedule.MaxAttempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		due = append(due, schedule)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var (
+		now   = time.Now()
+		fired int
+		bad   []error
+	)
+	for _, schedule := range due {
+		nextRun, err := next(schedule.Spec, now)
+		if err != nil {
+			// one broken schedule must not hold back the others, it is postponed so it is not reported on every tick
+			bad = append(bad, fmt.Errorf("schedule %s: %w", schedule.Name, err))
+			if _, err := tx.ExecContext(ctx, `UPDATE job_schedules SET next_run_at = NOW() + make_interval(secs => $2) WHERE name = $1`,
+				schedule.Name, badScheduleDelay.Seconds()); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO jobs (kind, payload, max_attempts) VALUES ($1, $2, $3)`, schedule.Kind, []byte(schedule.Payload), schedule.MaxAttempts); err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE job_schedules SET next_run_at = $2, last_run_at = NOW() WHERE name = $1`, schedule.Name, nextRun); err != nil {
+			return 0, err
+		}
+		fired++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return fired, errors.Join(bad...)
+}
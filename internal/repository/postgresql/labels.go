@@ -0,0 +1,141 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+
+	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const LimitExceeded = "limit exceeded"
+
+// AddTags attaches tags to file, file may end up with at most limit tags
+func (p *PostgreSQL) AddTags(ctx context.Context, uuidOfFile string, tags []string, limit int) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO tags (file_uuid, tag) SELECT $1::uuid, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+		uuidOfFile, pq.Array(tags)); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tags WHERE file_uuid = $1`, uuidOfFile).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > limit {
+		return errors.New(LimitExceeded)
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgreSQL) RemoveTags(ctx context.Context, uuidOfFile string, tags []string) error {
+	_, err := p.conn.ExecContext(ctx, `DELETE FROM tags WHERE file_uuid = $1 AND tag = ANY($2)`, uuidOfFile, pq.Array(tags))
+	return err
+}
+
+// SetAttributes inserts or overwrites attributes, file may end up with at most limit attributes
+func (p *PostgreSQL) SetAttributes(ctx context.Context, uuidOfFile string, attrs map[string]string, limit int) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO file_attributes (file_uuid, key, value) VALUES ($1, $2, $3) ON CONFLICT (file_uuid, key) DO UPDATE SET value = EXCLUDED.value`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for key, value := range attrs {
+		if _, err := stmt.ExecContext(ctx, uuidOfFile, key, value); err != nil {
+			return err
+		}
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM file_attributes WHERE file_uuid = $1`, uuidOfFile).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > limit {
+		return errors.New(LimitExceeded)
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgreSQL) RemoveAttributes(ctx context.Context, uuidOfFile string, keys []string) error {
+	_, err := p.conn.ExecContext(ctx, `DELETE FROM file_attributes WHERE file_uuid = $1 AND key = ANY($2)`, uuidOfFile, pq.Array(keys))
+	return err
+}
+
+// loadLabels fills tags and attributes of given records with two queries
+func (p *PostgreSQL) loadLabels(ctx context.Context, records ...*models.FileMetaData) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	byUUID := make(map[string]*models.FileMetaData, len(records))
+	uuids := make([]string, 0, len(records))
+	for _, record := range records {
+		byUUID[record.FileUUID] = record
+		uuids = append(uuids, record.FileUUID)
+	}
+
+	rows, err := p.conn.QueryContext(ctx, `SELECT file_uuid, tag FROM tags WHERE file_uuid = ANY($1::uuid[]) ORDER BY tag`, pq.Array(uuids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileUUID, tag string
+		if err := rows.Scan(&fileUUID, &tag); err != nil {
+			return err
+		}
+
+		if record, ok := byUUID[fileUUID]; ok {
+			record.Tags = append(record.Tags, tag)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	attrRows, err := p.conn.QueryContext(ctx, `SELECT file_uuid, key, value FROM file_attributes WHERE file_uuid = ANY($1::uuid[])`, pq.Array(uuids))
+	if err != nil {
+		return err
+	}
+	defer attrRows.Close()
+
+	for attrRows.Next() {
+		var fileUUID, key, value string
+		if err := attrRows.Scan(&fileUUID, &key, &value); err != nil {
+			return err
+		}
+
+		record, ok := byUUID[fileUUID]
+		if !ok {
+			continue
+		}
+
+		if record.Attributes == nil {
+			record.Attributes = make(map[string]string)
+		}
+		record.Attributes[key] = value
+	}
+
+	return attrRows.Err()
+}
@@ -0,0 +1,314 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/models"
+	"up-down-server/migrations"
+)
+
+// session advisory lock held while migrating, so instances started together do not apply same migration twice
+const migrationsLockKey int64 = 0x66696c6564756d70 // "filedump"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrateUp applies every pending migration.
+// Migrations are idempotent, so database migrated by hand before schema_migrations existed is just recorded
+func (p *PostgreSQL) MigrateUp(ctx context.Context) ([]*models.Migration, error) {
+	all, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	target := 0
+	if len(all) > 0 {
+		target = all[len(all)-1].version
+	}
+
+	return p.migrate(ctx, all, target)
+}
+
+// MigrateDown reverts last steps applied migrations
+func (p *PostgreSQL) MigrateDown(ctx context.Context, steps int) ([]*models.Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	all, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := p.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.migrate(ctx, all, downTarget(applied, steps))
+}
+
+// MigrateTo applies or reverts migrations until schema is at version, 0 reverts all
+func (p *PostgreSQL) MigrateTo(ctx context.Context, version int) ([]*models.Migration, error) {
+	all, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && !slices.ContainsFunc(all, func(m *migration) bool { return m.version == version }) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return p.migrate(ctx, all, version)
+}
+
+// MigrationStatus lists known migrations, applied ones with time of applying
+func (p *PostgreSQL) MigrationStatus(ctx context.Context) ([]*models.Migration, error) {
+	all, err := loadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := p.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*models.Migration, 0, len(all))
+	for _, m := range all {
+		status := &models.Migration{Version: m.version, Name: m.name}
+		if at, ok := applied[m.version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// migrate brings schema to target under advisory lock, state is read after lock is taken
+// so instance that waited sees migrations applied by the one that held it
+func (p *PostgreSQL) migrate(ctx context.Context, all []*migration, target int) (changed []*models.Migration, err error) {
+	// session lock belongs to connection, so every statement goes through the same one
+	conn, err := p.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockKey); err != nil {
+		return nil, fmt.Errorf("failed to take migrations lock: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationsLockKey); unlockErr != nil {
+			// lock is released with session, connection must not go back to pool holding it
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := queryAppliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	up, down, err := plan(all, applied, target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range up {
+		if err := runMigration(ctx, conn, m, true); err != nil {
+			return changed, err
+		}
+		changed = append(changed, &models.Migration{Version: m.version, Name: m.name})
+	}
+
+	for _, m := range down {
+		if err := runMigration(ctx, conn, m, false); err != nil {
+			return changed, err
+		}
+		changed = append(changed, &models.Migration{Version: m.version, Name: m.name})
+	}
+
+	return changed, nil
+}
+
+// plan returns migrations to apply in ascending order and to revert in descending order to bring schema to target
+func plan(all []*migration, applied map[int]time.Time, target int) (up, down []*migration, err error) {
+	// applied versions unknown to binary are left alone when migrating up, newer instance may have applied them,
+	// but known migrations they may depend on are not reverted from under them
+	if len(all) > 0 && target < all[len(all)-1].version {
+		for version := range applied {
+			if version > target && !slices.ContainsFunc(all, func(m *migration) bool { return m.version == version }) {
+				return nil, nil, fmt.Errorf("migration %d is applied but unknown to this binary, it can not be reverted", version)
+			}
+		}
+	}
+
+	for _, m := range all {
+		if _, ok := applied[m.version]; !ok && m.version <= target {
+			up = append(up, m)
+		}
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		if _, ok := applied[all[i].version]; ok && all[i].version > target {
+			down = append(down, all[i])
+		}
+	}
+
+	return up, down, nil
+}
+
+// downTarget is version schema is left at after reverting last steps applied migrations
+func downTarget(applied map[int]time.Time, steps int) int {
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+
+	if steps < len(versions) {
+		return versions[len(versions)-steps-1]
+	}
+
+	return 0
+}
+
+// runMigration executes script and records it in one transaction, failed migration leaves no trace
+func runMigration(ctx context.Context, conn *sql.Conn, m *migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record, args := m.down, "DELETE FROM schema_migrations WHERE version = $1", []any{m.version}
+	if up {
+		script, record, args = m.up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", []any{m.version, m.name}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgreSQL) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	conn, err := p.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	return queryAppliedMigrations(ctx, conn)
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	return err
+}
+
+func queryAppliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// loadMigrations reads NNNN_name.up.sql and NNNN_name.down.sql pairs ordered by version
+func loadMigrations(fsys fs.FS) ([]*migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q is not named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		} else if m.name != match[2] {
+			return nil, fmt.Errorf("migration %d has files of different names: %s and %s", version, m.name, match[2])
+		}
+
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	all := make([]*migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.version, m.name)
+		}
+		all = append(all, m)
+	}
+	slices.SortFunc(all, func(a, b *migration) int { return a.version - b.version })
+
+	return all, nil
+}
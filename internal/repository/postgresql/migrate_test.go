@@ -0,0 +1,161 @@
+package postgresql
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"up-down-server/migrations"
+)
+
+func script(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_add_tags.up.sql":       script("ALTER TABLE files ADD tags TEXT"),
+		"0010_add_tags.down.sql":     script("ALTER TABLE files DROP tags"),
+		"0002_create_files.up.sql":   script("CREATE TABLE files ()"),
+		"0002_create_files.down.sql": script("DROP TABLE files"),
+	}
+
+	all, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 2 || all[0].version != 2 || all[1].version != 10 {
+		t.Fatalf("migrations are not ordered by version: %v", versionsOf(all))
+	}
+	if all[0].name != "create_files" || all[0].up != "CREATE TABLE files ()" || all[0].down != "DROP TABLE files" {
+		t.Errorf("unexpected migration: %+v", all[0])
+	}
+}
+
+func TestLoadMigrationsRejectsBrokenSet(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"badly named": {
+			"0001_create_files.up.sql":   script("CREATE TABLE files ()"),
+			"0001_create_files.down.sql": script("DROP TABLE files"),
+			"create_users.sql":           script("CREATE TABLE users ()"),
+		},
+		"no down file": {
+			"0001_create_files.up.sql": script("CREATE TABLE files ()"),
+		},
+		"names differ": {
+			"0001_create_files.up.sql": script("CREATE TABLE files ()"),
+			"0001_drop_files.down.sql": script("DROP TABLE files"),
+		},
+	}
+
+	for name, fsys := range cases {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: migrations are accepted", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	all, err := loadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range all {
+		if strings.TrimSpace(m.up) == "" || strings.TrimSpace(m.down) == "" {
+			t.Errorf("migration %04d_%s has empty script", m.version, m.name)
+		}
+		if i > 0 && m.version == all[i-1].version {
+			t.Errorf("migration version %d repeats", m.version)
+		}
+	}
+}
+
+func versionsOf(ms []*migration) []int {
+	versions := make([]int, 0, len(ms))
+	for _, m := range ms {
+		versions = append(versions, m.version)
+	}
+
+	return versions
+}
+
+func appliedAt(versions ...int) map[int]time.Time {
+	applied := make(map[int]time.Time)
+	for _, version := range versions {
+		applied[version] = time.Now()
+	}
+
+	return applied
+}
+
+func TestPlan(t *testing.T) {
+	var all []*migration
+	for _, version := range []int{1, 2, 3, 4} {
+		all = append(all, &migration{version: version})
+	}
+
+	cases := []struct {
+		name    string
+		applied map[int]time.Time
+		target  int
+		up      []int
+		down    []int
+		err     bool
+	}{
+		{"fresh database", appliedAt(), 4, []int{1, 2, 3, 4}, nil, false},
+		{"pending migrations", appliedAt(1, 2), 4, []int{3, 4}, nil, false},
+		{"up to date", appliedAt(1, 2, 3, 4), 4, nil, nil, false},
+		{"gap is filled", appliedAt(1, 3), 4, []int{2, 4}, nil, false},
+		{"revert in reverse order", appliedAt(1, 2, 3, 4), 1, nil, []int{4, 3, 2}, false},
+		{"revert all", appliedAt(1, 2, 3, 4), 0, nil, []int{4, 3, 2, 1}, false},
+		{"both ways", appliedAt(1, 3, 4), 2, []int{2}, []int{4, 3}, false},
+		{"unknown version left alone going up", appliedAt(1, 2, 3, 4, 5), 4, nil, nil, false},
+		{"unknown version blocks revert", appliedAt(1, 2, 3, 4, 5), 3, nil, nil, true},
+	}
+
+	for _, tc := range cases {
+		up, down, err := plan(all, tc.applied, tc.target)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		if !slices.Equal(versionsOf(up), tc.up) {
+			t.Errorf("%s: expected to apply %v, got %v", tc.name, tc.up, versionsOf(up))
+		}
+		if !slices.Equal(versionsOf(down), tc.down) {
+			t.Errorf("%s: expected to revert %v, got %v", tc.name, tc.down, versionsOf(down))
+		}
+	}
+}
+
+func TestDownTarget(t *testing.T) {
+	cases := []struct {
+		applied  map[int]time.Time
+		steps    int
+		expected int
+	}{
+		{appliedAt(1, 2, 3), 1, 2},
+		{appliedAt(1, 2, 3), 2, 1},
+		{appliedAt(1, 2, 3), 3, 0},
+		{appliedAt(1, 2, 3), 10, 0},
+		{appliedAt(1, 5, 9), 1, 5}, // versions need not be consecutive
+		{appliedAt(), 1, 0},
+	}
+
+	for _, tc := range cases {
+		if target := downTarget(tc.applied, tc.steps); target != tc.expected {
+			t.Errorf("%d steps back from %d applied: expected %d, got %d", tc.steps, len(tc.applied), tc.expected, target)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"up-down-server/internal/config"
 	"up-down-server/internal/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const origin = "PostgreSQL"
@@ -18,14 +19,14 @@ type PostgreSQL struct {
 func NewPostgreSQLConnection(dbConfig config.StorageConfig, shutdownChannel models.ShutdownChannel) *PostgreSQL {
 	psql := new(PostgreSQL)
 
-	connection, err := sql.Open("postgres", connString(dbConfig))
+	connector, err := pq.NewConnector(connString(dbConfig))
 	if err != nil {
 		msg := fmt.Sprintf("failed to connect to db: %v\n", err)
 		shutdownChannel.Send(models.ShutdownMessage, origin, msg)
 		return nil
 	}
 
-	psql.conn = connection
+	psql.conn = sql.OpenDB(instrumentedConnector{Connector: connector})
 
 	if err := psql.conn.Ping(); err != nil {
 		msg := fmt.Sprintf("failed to ping to db: %v\n", err)
@@ -36,6 +37,20 @@ func NewPostgreSQLConnection(dbConfig config.StorageConfig, shutdownChannel mode
 	return psql
 }
 
+func (p *PostgreSQL) Ping(ctx context.Context) error {
+	return p.conn.PingContext(ctx)
+}
+
+// Stats of connection pool
+func (p *PostgreSQL) Stats() sql.DBStats {
+	return p.conn.Stats()
+}
+
+// Close waits for queries in progress and closes connection pool
+func (p *PostgreSQL) Close() error {
+	return p.conn.Close()
+}
+
 func connString(dbConfig config.StorageConfig) string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Password, dbConfig.DatabaseName)
 }
@@ -0,0 +1,106 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"up-down-server/internal/models"
+)
+
+func (p *PostgreSQL) CreateSession(ctx context.Context, session *models.Session) error {
+	_, err := p.conn.ExecContext(ctx,
+		`INSERT INTO sessions (session_id, user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		session.SessionID, session.UserID, session.UserAgent, session.IP, session.ExpiresAt)
+	return err
+}
+
+// TouchSession updates last seen time and address of session and prolongs it
+func (p *PostgreSQL) TouchSession(ctx context.Context, sessionId, ip string, expiresAt time.Time) error {
+	_, err := p.conn.ExecContext(ctx,
+		`UPDATE sessions SET last_seen_at = NOW(), ip = $2, expires_at = $3 WHERE session_id = $1 AND revoked_at IS NULL`,
+		sessionId, ip, expiresAt)
+	return err
+}
+
+// ListUserSessions returns active sessions, most recently used first
+func (p *PostgreSQL) ListUserSessions(ctx context.Context, userId int) ([]*models.Session, error) {
+	rows, err := p.conn.QueryContext(ctx, `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.Session
+	for rows.Next() {
+		session := new(models.Session)
+		if err := rows.Scan(&session.SessionID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RevokeSession ends session of user, NotFound when user has no such active session
+func (p *PostgreSQL) RevokeSession(ctx context.Context, userId int, sessionId string) error {
+	res, err := p.conn.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = NOW() WHERE session_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// RevokeUserSessions ends every active session of user except one (may be empty) and returns ids of ended sessions
+func (p *PostgreSQL) RevokeUserSessions(ctx context.Context, userId int, exceptSessionId string) ([]string, error) {
+	rows, err := p.conn.QueryContext(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND session_id::text <> $2
+		RETURNING session_id`, userId, exceptSessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (p *PostgreSQL) PurgeEndedSessions(ctx context.Context, endedBefore time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx,
+		`DELETE FROM sessions WHERE COALESCE(revoked_at, expires_at) < $1`, endedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
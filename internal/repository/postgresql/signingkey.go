@@ -0,0 +1,81 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"up-down-server/internal/models"
+)
+
+// AddSigningKey stores key as the active one, previously active key is retired
+func (p *PostgreSQL) AddSigningKey(ctx context.Context, key *models.SigningKey) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE signing_keys SET retired_at = NOW() WHERE retired_at IS NULL`); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO signing_keys (kid, algorithm, private_key) VALUES ($1, $2, $3)`,
+		key.KID, key.Algorithm, key.PrivateKey); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListSigningKeys returns active key and keys retired after given time, newest first
+func (p *PostgreSQL) ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error) {
+	rows, err := p.conn.QueryContext(ctx,
+		`SELECT kid, algorithm, private_key, created_at, retired_at FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > $1 ORDER BY created_at DESC`, retiredAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.SigningKey
+	for rows.Next() {
+		var (
+			key       = new(models.SigningKey)
+			retiredAt sql.NullTime
+		)
+
+		if err := rows.Scan(&key.KID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &retiredAt); err != nil {
+			return nil, err
+		}
+
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+
+		result = append(result, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ReplaceSigningKey changes stored private key of kid, row that no longer holds previous is left alone
+func (p *PostgreSQL) ReplaceSigningKey(ctx context.Context, kid string, previous, replacement []byte) error {
+	_, err := p.conn.ExecContext(ctx,
+		`UPDATE signing_keys SET private_key = $3 WHERE kid = $1 AND private_key = $2`, kid, previous, replacement)
+	return err
+}
+
+func (p *PostgreSQL) PurgeSigningKeys(ctx context.Context, retiredBefore time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx, `DELETE FROM signing_keys WHERE retired_at < $1`, retiredBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
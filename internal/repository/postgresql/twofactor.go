@@ -0,0 +1,153 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// SaveTOTPSecret starts or restarts enrolment, AlreadyExists when TOTP is already enabled
+func (p *PostgreSQL) SaveTOTPSecret(ctx context.Context, userId int, secret string) error {
+	res, err := p.conn.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+		WHERE user_totp.enabled = FALSE`, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(AlreadyExists)
+	}
+
+	return nil
+}
+
+// ReplaceTOTPSecret swaps stored secret, e.g. for its encrypted form, unless it was changed meanwhile
+func (p *PostgreSQL) ReplaceTOTPSecret(ctx context.Context, userId int, previous, replacement string) error {
+	_, err := p.conn.ExecContext(ctx,
+		`UPDATE user_totp SET secret = $3 WHERE user_id = $1 AND secret = $2`, userId, previous, replacement)
+	return err
+}
+
+func (p *PostgreSQL) GetTOTP(ctx context.Context, userId int) (*models.TOTP, error) {
+	var (
+		t         = new(models.TOTP)
+		enabledAt sql.NullTime
+	)
+
+	err := p.conn.QueryRowContext(ctx,
+		`SELECT user_id, secret, enabled, created_at, enabled_at FROM user_totp WHERE user_id = $1`, userId).
+		Scan(&t.UserID, &t.Secret, &t.Enabled, &t.CreatedAt, &enabledAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New(NotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		t.EnabledAt = &enabledAt.Time
+	}
+
+	return t, nil
+}
+
+// EnableTOTP confirms enrolment and stores recovery codes
+func (p *PostgreSQL) EnableTOTP(ctx context.Context, userId int, recoveryHashes []string) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_totp SET enabled = TRUE, enabled_at = NOW() WHERE user_id = $1 AND enabled = FALSE`, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, recoveryHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgreSQL) DisableTOTP(ctx context.Context, userId int) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates every previous recovery code of user
+func (p *PostgreSQL) ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryHashes []string) error {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, recoveryHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode burns unused code, NotFound when there is no such code
+func (p *PostgreSQL) UseRecoveryCode(ctx context.Context, userId int, hash string) error {
+	res, err := p.conn.ExecContext(ctx,
+		`UPDATE totp_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userId, hash)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+func (p *PostgreSQL) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := p.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM totp_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userId).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO totp_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`, userId, pq.Array(hashes))
+	return err
+}
@@ -5,22 +5,33 @@ import (
 	"database/sql"
 	"errors"
 	"up-down-server/internal/lib/bcrypthashing"
+
+	"github.com/lib/pq"
+)
+
+const (
+	Disabled   = "account is disabled"
+	NoPassword = "account has no password"
 )
 
-func (p *PostgreSQL) RegisterUser(ctx context.Context, username, hashedPassword string) error {
+// RegisterUser creates user, empty email is stored as NULL
+func (p *PostgreSQL) RegisterUser(ctx context.Context, username, hashedPassword, email string) error {
 	if exists, err := p.UsernameExists(username); err != nil {
 		return err
 	} else if exists {
 		return errors.New("user already exists")
 	}
 
-	stmt, err := p.conn.PrepareContext(ctx, "INSERT INTO users (username, password) VALUES ($1, $2)")
+	stmt, err := p.conn.PrepareContext(ctx, "INSERT INTO users (username, password, email) VALUES ($1, $2, NULLIF($3, ''))")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	if _, err = stmt.ExecContext(ctx, username, hashedPassword); err != nil {
+	if _, err = stmt.ExecContext(ctx, username, hashedPassword, email); err != nil {
+		if isUniqueViolation(err) {
+			return errors.New(AlreadyExists)
+		}
 		return err
 	}
 
@@ -28,7 +39,7 @@ func (p *PostgreSQL) RegisterUser(ctx context.Context, username, hashedPassword
 }
 
 func (p *PostgreSQL) AuthentificateUser(ctx context.Context, username, password string) (int, error) {
-	stmt, err := p.conn.PrepareContext(ctx, "SELECT user_id, password FROM users WHERE username = $1 LIMIT 1")
+	stmt, err := p.conn.PrepareContext(ctx, "SELECT user_id, password, disabled_at IS NOT NULL FROM users WHERE username = $1 LIMIT 1")
 	if err != nil {
 		return 0, err
 	}
@@ -37,9 +48,10 @@ func (p *PostgreSQL) AuthentificateUser(ctx context.Context, username, password
 	var (
 		userId         int
 		hashedPassword string
+		disabled       bool
 	)
 
-	if err = stmt.QueryRowContext(ctx, username).Scan(&userId, &hashedPassword); err != nil {
+	if err = stmt.QueryRowContext(ctx, username).Scan(&userId, &hashedPassword, &disabled); err != nil {
 		if err == sql.ErrNoRows {
 			return 0, errors.New(NotFound)
 		}
@@ -50,6 +62,11 @@ func (p *PostgreSQL) AuthentificateUser(ctx context.Context, username, password
 		return 0, errors.New(UnAuthorized)
 	}
 
+	// told only to those who know the password
+	if disabled {
+		return 0, errors.New(Disabled)
+	}
+
 	return userId, nil
 }
 
@@ -70,4 +87,207 @@ func (p *PostgreSQL) UsernameExists(name string) (bool, error) {
 	}
 
 	return true, nil
-}
\ No newline at end of file
+}
+func (p *PostgreSQL) GetUsername(ctx context.Context, userId int) (string, error) {
+	var username string
+	err := p.conn.QueryRowContext(ctx, "SELECT username FROM users WHERE user_id = $1", userId).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", errors.New(NotFound)
+	} else if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+func (p *PostgreSQL) GetUserIDByUsername(ctx context.Context, username string) (int, error) {
+	return p.getUserIDBy(ctx, "username", username)
+}
+
+func (p *PostgreSQL) GetUserIDByEmail(ctx context.Context, email string) (int, error) {
+	return p.getUserIDBy(ctx, "email", email)
+}
+
+// getUserIDBy looks user up by unique column, column is never taken from input
+func (p *PostgreSQL) getUserIDBy(ctx context.Context, column, value string) (int, error) {
+	var userId int
+	err := p.conn.QueryRowContext(ctx, "SELECT user_id FROM users WHERE "+column+" = $1", value).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, errors.New(NotFound)
+	} else if err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// VerifyPassword re-authenticates already logged in user, UnAuthorized on mismatch.
+// NoPassword for user provisioned by identity provider, who has no password to check
+func (p *PostgreSQL) VerifyPassword(ctx context.Context, userId int, password string) error {
+	var hashedPassword string
+	err := p.conn.QueryRowContext(ctx, "SELECT password FROM users WHERE user_id = $1", userId).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return errors.New(NotFound)
+	} else if err != nil {
+		return err
+	}
+
+	if hashedPassword == "" {
+		return errors.New(NoPassword)
+	}
+
+	if err := bcrypthashing.ComparePasswordAndHash(password, hashedPassword); err != nil {
+		return errors.New(UnAuthorized)
+	}
+
+	return nil
+}
+
+func (p *PostgreSQL) UpdatePassword(ctx context.Context, userId int, hashedPassword string) error {
+	res, err := p.conn.ExecContext(ctx, "UPDATE users SET password = $2 WHERE user_id = $1", userId, hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// SetEmail changes email of user, AlreadyExists when it belongs to other user
+func (p *PostgreSQL) SetEmail(ctx context.Context, userId int, email string) error {
+	_, err := p.conn.ExecContext(ctx, "UPDATE users SET email = NULLIF($2, '') WHERE user_id = $1", userId, email)
+	if isUniqueViolation(err) {
+		return errors.New(AlreadyExists)
+	}
+
+	return err
+}
+
+// FindUserForReset looks user up by username, or by email when login looks like one.
+// Username equal to login wins over other user whose email it is. NotFound when user has no email to deliver reset to
+func (p *PostgreSQL) FindUserForReset(ctx context.Context, login string) (int, string, error) {
+	var (
+		userId int
+		email  string
+	)
+
+	err := p.conn.QueryRowContext(ctx, `
+		SELECT user_id, email FROM users
+		WHERE (username = $1 OR (strpos($1, '@') > 0 AND email = lower($1))) AND email IS NOT NULL
+		ORDER BY username = $1 DESC
+		LIMIT 1`, login).Scan(&userId, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", errors.New(NotFound)
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return userId, email, nil
+}
+
+// DeleteUser removes user with everything referencing it, returns uuids of deleted files so their blobs can be removed
+func (p *PostgreSQL) DeleteUser(ctx context.Context, userId int) ([]string, error) {
+	tx, err := p.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "DELETE FROM files WHERE user_id = $1 RETURNING file_uuid", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileUUIDs []string
+	for rows.Next() {
+		var fileUUID string
+		if err := rows.Scan(&fileUUID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		fileUUIDs = append(fileUUIDs, fileUUID)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// sessions, api keys, identities and totp go away by cascade
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE user_id = $1", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errors.New(NotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return fileUUIDs, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// GetUserRole returns role of active user, Disabled for disabled one
+func (p *PostgreSQL) GetUserRole(ctx context.Context, userId int) (string, error) {
+	var (
+		role     string
+		disabled bool
+	)
+
+	err := p.conn.QueryRowContext(ctx, "SELECT role, disabled_at IS NOT NULL FROM users WHERE user_id = $1", userId).Scan(&role, &disabled)
+	if err == sql.ErrNoRows {
+		return "", errors.New(NotFound)
+	} else if err != nil {
+		return "", err
+	}
+
+	if disabled {
+		return "", errors.New(Disabled)
+	}
+
+	return role, nil
+}
+
+func (p *PostgreSQL) SetUserRole(ctx context.Context, username, role string) error {
+	res, err := p.conn.ExecContext(ctx, "UPDATE users SET role = $2 WHERE username = $1", username, role)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// BootstrapAdmin promotes user to admin only while there is no admin at all, reports whether user was promoted
+func (p *PostgreSQL) BootstrapAdmin(ctx context.Context, username string) (bool, error) {
+	res, err := p.conn.ExecContext(ctx, `
+		UPDATE users SET role = 'admin'
+		WHERE username = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')`, username)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
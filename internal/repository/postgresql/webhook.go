@@ -0,0 +1,136 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"up-down-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `webhook_id, user_id, url, secret, events, created_at`
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	hook := new(models.Webhook)
+	if err := row.Scan(&hook.WebhookID, &hook.UserID, &hook.URL, &hook.Secret, pq.Array(&hook.Events), &hook.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+func (p *PostgreSQL) queryWebhooks(ctx context.Context, query string, args ...any) ([]*models.Webhook, error) {
+	rows, err := p.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, hook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) CreateWebhook(ctx context.Context, hook *models.Webhook) error {
+	return p.conn.QueryRowContext(ctx,
+		`INSERT INTO webhooks (webhook_id, user_id, url, secret, events) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`,
+		hook.WebhookID, hook.UserID, hook.URL, hook.Secret, pq.Array(hook.Events)).Scan(&hook.CreatedAt)
+}
+
+func (p *PostgreSQL) ListWebhooks(ctx context.Context, userId int) ([]*models.Webhook, error) {
+	return p.queryWebhooks(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE user_id = $1 ORDER BY created_at DESC`, userId)
+}
+
+func (p *PostgreSQL) CountWebhooks(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := p.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhooks WHERE user_id = $1`, userId).Scan(&count)
+	return count, err
+}
+
+func (p *PostgreSQL) GetWebhook(ctx context.Context, webhookId string) (*models.Webhook, error) {
+	hook, err := scanWebhook(p.conn.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE webhook_id = $1`, webhookId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New(NotFound)
+	}
+
+	return hook, err
+}
+
+func (p *PostgreSQL) DeleteWebhook(ctx context.Context, userId int, webhookId string) error {
+	res, err := p.conn.ExecContext(ctx, `DELETE FROM webhooks WHERE webhook_id = $1 AND user_id = $2`, webhookId, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New(NotFound)
+	}
+
+	return nil
+}
+
+// ListSubscribedWebhooks returns webhooks of user subscribed to event
+func (p *PostgreSQL) ListSubscribedWebhooks(ctx context.Context, userId int, event string) ([]*models.Webhook, error) {
+	return p.queryWebhooks(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE user_id = $1 AND $2 = ANY(events)`, userId, event)
+}
+
+// RecordWebhookDelivery stores attempt, its number follows previous attempts of the same delivery
+func (p *PostgreSQL) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return p.conn.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (delivery_id, webhook_id, event, attempt, status_code, error, duration_ms, success)
+		SELECT $1, $2, $3, COALESCE(MAX(attempt), 0) + 1, NULLIF($4, 0), NULLIF($5, ''), $6, $7 FROM webhook_deliveries WHERE delivery_id = $1
+		RETURNING id, attempt, created_at`,
+		delivery.DeliveryID, delivery.WebhookID, delivery.Event, delivery.StatusCode, delivery.Error, delivery.DurationMS, delivery.Success,
+	).Scan(&delivery.ID, &delivery.Attempt, &delivery.CreatedAt)
+}
+
+// ListWebhookDeliveries returns latest attempts first
+func (p *PostgreSQL) ListWebhookDeliveries(ctx context.Context, webhookId string, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := p.conn.QueryContext(ctx,
+		`SELECT id, delivery_id, webhook_id, event, attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, success, created_at
+		FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`, webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*models.WebhookDelivery{}
+	for rows.Next() {
+		d := new(models.WebhookDelivery)
+		if err := rows.Scan(&d.ID, &d.DeliveryID, &d.WebhookID, &d.Event, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMS, &d.Success, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PostgreSQL) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.conn.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
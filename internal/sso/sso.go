@@ -0,0 +1,226 @@
+// Login through external OpenID Connect provider with authorization code flow and PKCE
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	InvalidNonce   = "id token nonce does not match"
+	MissingIDToken = "id_token is missing in token response"
+	NotLinked      = "identity is not linked to any user"
+
+	provisionAttempts = 5
+	defaultStateTTL   = 10 * time.Minute
+)
+
+// Pending is kept between redirect to provider and callback, keyed by state
+type Pending struct {
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Nonce    string `json:"nonce"`
+}
+
+// Identity is user as asserted by validated ID token
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider discovers provider metadata on first use, failed discovery is retried on the next login
+type Provider struct {
+	cfg config.OIDCConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewProvider(cfg config.OIDCConfig) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+// StateTTL is time given to user to finish login at provider
+func (p *Provider) StateTTL() time.Duration {
+	if p.cfg.StateTTL <= 0 {
+		return defaultStateTTL
+	}
+
+	return p.cfg.StateTTL
+}
+
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+
+	return p.oauth, p.verifier, nil
+}
+
+// Begin returns url of provider to redirect user to, pending must be stored under state until callback
+func (p *Provider) Begin(ctx context.Context) (authURL, state string, pending *Pending, err error) {
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if state, err = randomString(); err != nil {
+		return "", "", nil, err
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	pending = &Pending{
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    nonce,
+	}
+
+	authURL = oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(pending.Verifier))
+	return authURL, state, pending, nil
+}
+
+// Finish exchanges authorization code and validates ID token signature, issuer, audience, expiry and nonce
+func (p *Provider) Finish(ctx context.Context, code string, pending *Pending) (*Identity, error) {
+	oauth, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(pending.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New(MissingIDToken)
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+
+	if idToken.Nonce != pending.Nonce {
+		return nil, errors.New(InvalidNonce)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Username = p.username(claims, identity)
+
+	return identity, nil
+}
+
+// username is taken from configured claim, then from email, then from subject
+func (p *Provider) username(claims map[string]any, identity *Identity) string {
+	if name, _ := claims[p.cfg.UsernameClaim].(string); strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name)
+	}
+
+	if local, _, ok := strings.Cut(identity.Email, "@"); ok && local != "" {
+		return local
+	}
+
+	subject := identity.Subject
+	if len(subject) > 8 {
+		subject = subject[:8]
+	}
+
+	return "user-" + subject
+}
+
+// ResolveUser returns user linked to identity, linking or creating one as allowed by config
+func (p *Provider) ResolveUser(ctx context.Context, users models.UserRepository, identity *Identity) (int, error) {
+	userId, err := users.GetUserIDByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil || err.Error() != postgresql.NotFound {
+		return userId, err
+	}
+
+	// username comes from provider, so linking must be enabled only for provider trusted to own usernames
+	if p.cfg.LinkByUsername {
+		userId, err := users.LinkIdentityByUsername(ctx, identity.Username, identity.Issuer, identity.Subject)
+		if err == nil || err.Error() != postgresql.NotFound {
+			return userId, err
+		}
+	}
+
+	if !p.cfg.AutoProvision {
+		return 0, errors.New(NotLinked)
+	}
+
+	username := identity.Username
+	for i := 0; i < provisionAttempts; i++ {
+		userId, err := users.ProvisionUser(ctx, username, identity.Issuer, identity.Subject)
+		if err == nil || err.Error() != postgresql.AlreadyExists {
+			return userId, err
+		}
+
+		suffix, err := randomString()
+		if err != nil {
+			return 0, err
+		}
+		username = identity.Username + "-" + strings.ToLower(suffix[:6])
+	}
+
+	return 0, fmt.Errorf("no free username for %s", identity.Username)
+}
+
+func randomString() (string, error) {
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw[:]), nil
+}
@@ -0,0 +1,97 @@
+// Removal of files whose lifetime is over
+package sweeper
+
+import (
+	"context"
+	"encoding/json"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/models"
+	"up-down-server/internal/webhook"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExpiredFilesJob is kind of job running Sweeper
+const ExpiredFilesJob = "files.sweep_expired"
+
+const batchSize = 100
+
+// Sweeper deletes expired file records and their blobs
+type Sweeper struct {
+	repo      models.FileMetaRepository
+	storage   models.FileStorage
+	audit     *audit.Recorder
+	webhooks  *webhook.Dispatcher
+	publisher models.EventPublisher // optional
+	logger    *logrus.Logger
+}
+
+func NewSweeper(repo models.FileMetaRepository, storage models.FileStorage, audit *audit.Recorder, webhooks *webhook.Dispatcher, publisher models.EventPublisher, logger *logrus.Logger) *Sweeper {
+	return &Sweeper{
+		repo:      repo,
+		storage:   storage,
+		audit:     audit,
+		webhooks:  webhooks,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+// RunJob is jobs.Handler running single sweep
+func (s *Sweeper) RunJob(ctx context.Context, _ json.RawMessage) error {
+	_, err := s.Sweep(ctx)
+	return err
+}
+
+// Sweep deletes every expired file and returns their count
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		records, err := s.repo.GetExpiredRecords(ctx, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, record := range records {
+			// same order as DeleteFile handler: record first, blob left behind is collected by reconciliation
+			if err := s.repo.DeleteFileByUUID(ctx, record.FileUUID); err != nil {
+				return deleted, err
+			}
+
+			if err := s.storage.Remove(record.FileUUID); err != nil {
+				s.logger.Errorf("Failed to delete expired file, left for reconciliation: %v", err)
+			}
+
+			s.deleted(ctx, record)
+			deleted++
+		}
+
+		if len(records) < batchSize {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		s.logger.Infof("Deleted %d expired files", deleted)
+	}
+
+	return deleted, nil
+}
+
+// deleted reports expired file the same way DeleteFile handler reports file deleted by owner,
+// audit event has no actor since nobody but the sweeper did it
+func (s *Sweeper) deleted(ctx context.Context, record *models.FileMetaData) {
+	s.audit.Record(ctx, &models.AuditEvent{
+		Event:    models.AuditFileDelete,
+		OwnerID:  &record.UserID,
+		FileUUID: record.FileUUID,
+		Details:  map[string]any{"filename": record.FileName, "reason": "expired"},
+	})
+
+	data := map[string]any{"file_id": record.FileUUID, "file_name": record.FileName, "reason": "expired"}
+	s.webhooks.Dispatch(ctx, record.UserID, models.WebhookFileDeleted, data)
+	if s.publisher != nil {
+		s.publisher.Publish(ctx, record.UserID, models.WebhookFileDeleted, data)
+	}
+}
@@ -0,0 +1,146 @@
+package sweeper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+
+	"up-down-server/internal/audit"
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+	"up-down-server/internal/webhook"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeFiles struct {
+	models.FileMetaRepository
+
+	expired []*models.FileMetaData
+}
+
+func (f *fakeFiles) GetExpiredRecords(ctx context.Context, limit int) ([]*models.FileMetaData, error) {
+	if len(f.expired) > limit {
+		return f.expired[:limit], nil
+	}
+	return f.expired, nil
+}
+
+func (f *fakeFiles) DeleteFileByUUID(ctx context.Context, uuidOfFile string) error {
+	for i, record := range f.expired {
+		if record.FileUUID == uuidOfFile {
+			f.expired = append(f.expired[:i], f.expired[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+type fakeStorage struct {
+	models.FileStorage
+
+	removed []string
+}
+
+func (s *fakeStorage) Remove(name string) error {
+	s.removed = append(s.removed, name)
+	return nil
+}
+
+type fakeAudit struct {
+	models.AuditRepository
+
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+func (a *fakeAudit) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events = append(a.events, event)
+	return nil
+}
+
+// fakeWebhooks subscribes one webhook to every event of every user
+type fakeWebhooks struct {
+	models.WebhookRepository
+}
+
+func (fakeWebhooks) ListSubscribedWebhooks(ctx context.Context, userId int, event string) ([]*models.Webhook, error) {
+	return []*models.Webhook{{WebhookID: "hook", UserID: userId}}, nil
+}
+
+type queuedDelivery struct {
+	Event string          `json:"event"`
+	Body  json.RawMessage `json:"body"`
+}
+
+type fakeQueue struct {
+	deliveries []queuedDelivery
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, kindName string, payload any) (int64, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var delivery queuedDelivery
+	if err := json.Unmarshal(raw, &delivery); err != nil {
+		return 0, err
+	}
+	q.deliveries = append(q.deliveries, delivery)
+
+	return int64(len(q.deliveries)), nil
+}
+
+func TestSweepReportsDeletedFiles(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var expired []*models.FileMetaData
+	for _, uuid := range []string{"first", "second"} {
+		expired = append(expired, &models.FileMetaData{FileUUID: uuid, FileName: uuid + ".txt", UserID: 7})
+	}
+
+	repo := &fakeFiles{expired: expired}
+	storage := new(fakeStorage)
+	auditRepo := new(fakeAudit)
+	queue := new(fakeQueue)
+
+	s := NewSweeper(repo, storage, audit.NewRecorder(auditRepo, logger), webhook.NewDispatcher(fakeWebhooks{}, queue, config.WebhooksConfig{}, logger), nil, logger)
+
+	deleted, err := s.Sweep(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || len(storage.removed) != 2 {
+		t.Fatalf("expected 2 deleted files, got %d records and %d blobs", deleted, len(storage.removed))
+	}
+
+	if len(auditRepo.events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(auditRepo.events))
+	}
+	for _, event := range auditRepo.events {
+		if event.Event != models.AuditFileDelete || event.ActorID != nil || event.OwnerID == nil || *event.OwnerID != 7 {
+			t.Errorf("unexpected audit event: %+v", event)
+		}
+	}
+
+	if len(queue.deliveries) != 2 {
+		t.Fatalf("expected 2 webhook deliveries, got %d", len(queue.deliveries))
+	}
+	for _, delivery := range queue.deliveries {
+		var payload webhook.Payload
+		if err := json.Unmarshal(delivery.Body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := payload.Data.(map[string]any)
+		if delivery.Event != models.WebhookFileDeleted || data["reason"] != "expired" {
+			t.Errorf("unexpected webhook delivery: %s %s", delivery.Event, delivery.Body)
+		}
+	}
+}
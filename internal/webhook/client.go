@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"up-down-server/internal/config"
+)
+
+const maxURLLength = 2048
+
+var ErrPrivateAddress = errors.New("webhook endpoint resolves to private address")
+
+// ValidateURL accepts absolute http(s) url without credentials
+func ValidateURL(raw string) error {
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("url must be at most %d characters", maxURLLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("url must be absolute http or https url")
+	}
+
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+
+	return nil
+}
+
+// newClient does not follow redirects and, unless private endpoints are allowed, refuses to connect
+// to loopback, private and link-local addresses, so webhooks can not reach internal services
+func newClient(cfg config.WebhooksConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// checked on resolved address right before connecting, so dns rebinding does not help
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublic(ip) {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
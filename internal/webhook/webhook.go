@@ -0,0 +1,251 @@
+// Outgoing webhooks: events of user are signed with webhook secret and delivered by background jobs
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+	"up-down-server/internal/repository/postgresql"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DeliverJob = "webhook.deliver"
+	PurgeJob   = "webhook.purge_deliveries"
+
+	EventHeader     = "X-Filedump-Event"
+	DeliveryHeader  = "X-Filedump-Delivery"
+	SignatureHeader = "X-Filedump-Signature" // t=<unix time>,v1=<hex hmac-sha256 of "<t>.<body>">
+
+	userAgent = "filedump-webhooks/1"
+	// response body is read only to let connection be reused
+	maxResponseBody = 64 << 10
+
+	secretPrefix = "whsec_"
+	secretBytes  = 32
+
+	TooManyWebhooks = "webhook limit reached"
+)
+
+// Enqueuer is jobs.Runner
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kindName string, payload any) (int64, error)
+}
+
+// Payload is JSON body of every delivery
+type Payload struct {
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	CreatedAt  time.Time `json:"created_at"`
+	Data       any       `json:"data"`
+}
+
+// jobPayload is payload of DeliverJob, body is kept as is so every retry sends the same bytes
+type jobPayload struct {
+	WebhookID  string          `json:"webhook_id"`
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type Dispatcher struct {
+	repo   models.WebhookRepository
+	jobs   Enqueuer
+	client *http.Client
+	cfg    config.WebhooksConfig
+	logger *logrus.Logger
+}
+
+func NewDispatcher(repo models.WebhookRepository, jobs Enqueuer, cfg config.WebhooksConfig, logger *logrus.Logger) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		jobs:   jobs,
+		client: newClient(cfg),
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Create registers webhook of user with new secret
+func (d *Dispatcher) Create(ctx context.Context, userId int, url string, events []string) (*models.Webhook, error) {
+	count, err := d.repo.CountWebhooks(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cfg.MaxPerUser > 0 && count >= d.cfg.MaxPerUser {
+		return nil, errors.New(TooManyWebhooks)
+	}
+
+	var raw [secretBytes]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, err
+	}
+
+	hook := &models.Webhook{
+		WebhookID: uuid.New().String(),
+		UserID:    userId,
+		URL:       url,
+		Secret:    secretPrefix + hex.EncodeToString(raw[:]),
+		Events:    events,
+	}
+
+	if err := d.repo.CreateWebhook(ctx, hook); err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// Dispatch queues delivery of event to every webhook of user subscribed to it.
+// Failure is logged and never fails the action event is about
+func (d *Dispatcher) Dispatch(ctx context.Context, userId int, event string, data any) {
+	ctx = context.WithoutCancel(ctx)
+
+	hooks, err := d.repo.ListSubscribedWebhooks(ctx, userId, event)
+	if err != nil {
+		d.logger.Errorf("Failed to list webhooks of user %d: %v", userId, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		deliveryId, body, err := newPayload(event, data)
+		if err != nil {
+			d.logger.Errorf("Failed to encode webhook payload: %v", err)
+			return
+		}
+
+		if _, err := d.jobs.Enqueue(ctx, DeliverJob, jobPayload{
+			WebhookID:  hook.WebhookID,
+			DeliveryID: deliveryId,
+			Event:      event,
+			Body:       body,
+		}); err != nil {
+			d.logger.Errorf("Failed to queue webhook %s delivery: %v", hook.WebhookID, err)
+		}
+	}
+}
+
+// RunJob is jobs.Handler of DeliverJob, returned error makes runner retry with backoff
+func (d *Dispatcher) RunJob(ctx context.Context, raw json.RawMessage) error {
+	var payload jobPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return err
+	}
+
+	hook, err := d.repo.GetWebhook(ctx, payload.WebhookID)
+	if err != nil {
+		if err.Error() == postgresql.NotFound {
+			// webhook is deleted, nothing to deliver to
+			return nil
+		}
+		return err
+	}
+
+	delivery := d.Deliver(ctx, hook, payload.DeliveryID, payload.Event, payload.Body)
+	if !delivery.Success {
+		return fmt.Errorf("webhook %s delivery %s failed: %s", hook.WebhookID, delivery.DeliveryID, delivery.Error)
+	}
+
+	return nil
+}
+
+// Test delivers ping event at once, without retries
+func (d *Dispatcher) Test(ctx context.Context, hook *models.Webhook) (*models.WebhookDelivery, error) {
+	deliveryId, body, err := newPayload(models.WebhookPing, map[string]any{"webhook_id": hook.WebhookID})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Deliver(ctx, hook, deliveryId, models.WebhookPing, body), nil
+}
+
+// Deliver sends signed body once and records the attempt
+func (d *Dispatcher) Deliver(ctx context.Context, hook *models.Webhook, deliveryId, event string, body []byte) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{
+		DeliveryID: deliveryId,
+		WebhookID:  hook.WebhookID,
+		Event:      event,
+	}
+
+	start := time.Now()
+	status, err := d.send(ctx, hook, deliveryId, event, body)
+	delivery.DurationMS = time.Since(start).Milliseconds()
+	delivery.StatusCode = status
+
+	switch {
+	case err != nil:
+		delivery.Error = err.Error()
+	case status < 200 || status > 299:
+		delivery.Error = fmt.Sprintf("unexpected status %d", status)
+	default:
+		delivery.Success = true
+	}
+
+	if err := d.repo.RecordWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		d.logger.Errorf("Failed to record webhook delivery: %v", err)
+	}
+
+	return delivery
+}
+
+func (d *Dispatcher) send(ctx context.Context, hook *models.Webhook, deliveryId, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryId)
+	req.Header.Set(SignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(hook.Secret, timestamp, body)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns hex HMAC-SHA256 of "<timestamp>.<body>", timestamp lets receiver reject replays
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newPayload(event string, data any) (string, []byte, error) {
+	deliveryId := uuid.New().String()
+	body, err := json.Marshal(Payload{
+		DeliveryID: deliveryId,
+		Event:      event,
+		CreatedAt:  time.Now().UTC(),
+		Data:       data,
+	})
+
+	return deliveryId, body, err
+}
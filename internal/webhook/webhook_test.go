@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"up-down-server/internal/config"
+	"up-down-server/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeDeliveries struct {
+	models.WebhookRepository
+
+	mu         sync.Mutex
+	deliveries []*models.WebhookDelivery
+}
+
+func (f *fakeDeliveries) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func newTestDispatcher(cfg config.WebhooksConfig) (*Dispatcher, *fakeDeliveries) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	repo := new(fakeDeliveries)
+	return NewDispatcher(repo, nil, cfg, logger), repo
+}
+
+// verify checks signature header the way receiver is documented to
+func verify(t *testing.T, secret, header string, body []byte) {
+	t.Helper()
+
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		t.Fatalf("signature %q does not match body", header)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < 0 || age > time.Minute {
+		t.Errorf("signature timestamp is off by %s", age)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+
+	// signed message is "<timestamp>.<body>", as documented for receivers
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(`1700000000.{"event":"ping"}`))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if signature := Sign("whsec_test", 1700000000, body); signature != expected {
+		t.Fatalf("expected %s, got %s", expected, signature)
+	}
+
+	// every part of signed message matters
+	for name, signature := range map[string]string{
+		"secret":    Sign("whsec_other", 1700000000, body),
+		"timestamp": Sign("whsec_test", 1700000001, body),
+		"body":      Sign("whsec_test", 1700000000, []byte(`{"event":"pong"}`)),
+	} {
+		if signature == expected {
+			t.Errorf("signature does not depend on %s", name)
+		}
+	}
+}
+
+func TestDeliverSignsBody(t *testing.T) {
+	var header string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(SignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	d, repo := newTestDispatcher(config.WebhooksConfig{Timeout: time.Second, AllowPrivate: true})
+	hook := &models.Webhook{WebhookID: "hook", URL: server.URL, Secret: "whsec_test"}
+
+	delivery := d.Deliver(t.Context(), hook, "delivery", models.WebhookPing, []byte(`{"event":"ping"}`))
+	if !delivery.Success {
+		t.Fatalf("delivery failed: %s", delivery.Error)
+	}
+	verify(t, hook.Secret, header, body)
+
+	if len(repo.deliveries) != 1 {
+		t.Errorf("expected delivery to be recorded, got %d", len(repo.deliveries))
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newClient(config.WebhooksConfig{Timeout: time.Second})
+	resp, err := client.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to loopback address is sent")
+	}
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("expected %v, got %v", ErrPrivateAddress, err)
+	}
+
+	client = newClient(config.WebhooksConfig{Timeout: time.Second, AllowPrivate: true})
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request to allowed private address failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	// public endpoint could otherwise bounce delivery to internal service
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := newClient(config.WebhooksConfig{Timeout: time.Second, AllowPrivate: true}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("expected redirect to be returned as is, got %d", resp.StatusCode)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false, // cloud metadata
+		"fe80::1":         false,
+		"fc00::1":         false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+		"::ffff:10.0.0.1": false,
+	}
+
+	for ip, expected := range cases {
+		if isPublic(net.ParseIP(ip)) != expected {
+			t.Errorf("%s: expected public %v", ip, expected)
+		}
+	}
+}
@@ -1,54 +1,265 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"log"
 	"os"
-	"path"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"up-down-server/internal/audit"
+	"up-down-server/internal/cli"
 	"up-down-server/internal/config"
+	"up-down-server/internal/events"
+	"up-down-server/internal/health"
 	httpserver "up-down-server/internal/http-server"
+	"up-down-server/internal/integrity"
+	"up-down-server/internal/jobs"
+	"up-down-server/internal/lib/jwttool"
 	"up-down-server/internal/logger"
 	"up-down-server/internal/models"
 	"up-down-server/internal/repository/cache"
+	"up-down-server/internal/repository/filestorage"
 	"up-down-server/internal/repository/postgresql"
+	"up-down-server/internal/loginguard"
+	"up-down-server/internal/metrics"
+	"up-down-server/internal/notify"
+	"up-down-server/internal/sso"
+	"up-down-server/internal/sweeper"
+	"up-down-server/internal/tracing"
+	"up-down-server/internal/webhook"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	sessionsPurgeJob  = "sessions.purge"
+	sessionsRetention = 30 * 24 * time.Hour // ended sessions are kept for this time
+)
+
 func main() {
     cfg := config.MustLoadConfig()
-	formattedLogger := logger.SetupLogger()
+	formattedLogger, err := logger.SetupLogger(cfg.Log)
+	if err != nil {
+		log.Fatalf("Failed to set up logger: %v", err)
+	}
 
-	shutdownChan := models.NewShutdownChannel()
+	// SIGINT or SIGTERM starts graceful shutdown, second one kills process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	go func() {
-		formattedLogger.Errorf("Error during setup: %s, %v", shutdownChan.Value(), cfg)
-		os.Exit(1)
+		<-ctx.Done()
+		stop()
 	}()
 
+	shutdownChan := models.NewShutdownChannel()
+
 	repo := postgresql.NewPostgreSQLConnection(cfg.Database, shutdownChan)
+	storage := filestorage.NewLocalStorage(cfg.Files.Dir, shutdownChan)
+	checkSetup(shutdownChan, formattedLogger)
+
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:], &cli.Deps{
+			Cfg:      cfg,
+			FileRepo:   repo,
+			UserRepo:   repo,
+			Migrations: repo,
+			Storage:    storage,
+			Logger:     formattedLogger,
+		}))
+	}
+
+	// instances started together wait for each other on advisory lock, only first one applies
+	if cfg.Database.AutoMigrate {
+		applied, err := repo.MigrateUp(ctx)
+		if err != nil {
+			formattedLogger.Fatalf("Failed to migrate database: %v", err)
+		}
+
+		for _, m := range applied {
+			formattedLogger.Infof("Migration %04d_%s has been applied", m.Version, m.Name)
+		}
+	}
+
+	if cfg.Admin.BootstrapUser != "" {
+		if promoted, err := repo.BootstrapAdmin(context.Background(), cfg.Admin.BootstrapUser); err != nil {
+			formattedLogger.Errorf("Failed to bootstrap admin: %v", err)
+		} else if promoted {
+			formattedLogger.Warnf("User %s is promoted to admin by bootstrap config", cfg.Admin.BootstrapUser)
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		formattedLogger.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	if err := jwttool.Setup(ctx, cfg.JWT, repo); err != nil {
+		formattedLogger.Fatalf("Failed to set up jwt signing: %v", err)
+	}
+
 	cache := cache.NewRedisClient(cfg.Redis, shutdownChan)
-	mkdirFiles(formattedLogger, shutdownChan)
+	checkSetup(shutdownChan, formattedLogger)
+	formattedLogger.Info("Files direction initialized!")
+
+	broker := events.NewBroker(cache, formattedLogger)
+
+	runner := jobs.NewRunner(repo, cfg.Jobs, formattedLogger)
+	webhooks := webhook.NewDispatcher(repo, runner, cfg.Webhooks, formattedLogger)
+	auditRecorder := audit.NewRecorder(repo, formattedLogger)
+	registerJobs(runner, cfg, repo, storage, auditRecorder, webhooks, broker, formattedLogger, shutdownChan)
+	checkSetup(shutdownChan, formattedLogger)
+
+	// background workers stop with ctx, they are awaited before connections are closed
+	workers := new(sync.WaitGroup)
+	background := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
 
-	wg := new(sync.WaitGroup)	
-	wg.Add(1)
-	
-	app := httpserver.NewServerApp(&cfg.HTTPServer, repo, repo, cache, formattedLogger, wg)
+	background(jwttool.Watch)
+	background(broker.Run)
+	background(runner.Start)
+	if cfg.Metrics.Enabled {
+		background(func(ctx context.Context) {
+			metrics.WatchStorage(ctx, repo, cfg.Metrics.StorageInterval, formattedLogger)
+		})
+	}
+
+	var oidcProvider *sso.Provider
+	if cfg.OIDC.Enabled() {
+		oidcProvider = sso.NewProvider(cfg.OIDC)
+		formattedLogger.Infof("OIDC login enabled with issuer %s", cfg.OIDC.Issuer)
+	}
+
+	notifier, err := notify.New(cfg.Notify, formattedLogger)
+	if err != nil {
+		formattedLogger.Fatalf("Failed to set up notifier: %v", err)
+	}
+
+	checker := health.NewChecker(cfg.Health.Timeout)
+	checker.Add("database", health.DatabaseCheck(repo))
+	checker.Add("cache", health.PingCheck(cache))
+	checker.Add("storage", health.StorageCheck(storage, cfg.Health.MinFreeSpace))
+
+	// behind gateway without trusted proxies every client has ip of gateway, one lock of it would lock out everyone
+	if cfg.Login.MaxIPFailures > 0 && len(cfg.TrustedProxies) == 0 && !cfg.TLS.Enabled {
+		formattedLogger.Warn("Login lock per ip is enabled, but no trusted proxies are set, list gateway in http_server.trusted_proxies")
+	}
 
-	go app.Run()
+	app := httpserver.NewServerApp(&cfg.HTTPServer, repo, repo, repo, repo, repo, repo, repo, repo, repo, cache, storage, oidcProvider, notifier, loginguard.NewGuard(cache, cfg.Login, auditRecorder, formattedLogger), auditRecorder, webhooks, broker, checker, cfg.Account, formattedLogger)
 
-	wg.Wait()
+	// fatal error reported while running, like failed schedule, shuts service down the same way as signal
+	failed := new(atomic.Bool)
+	go func() {
+		formattedLogger.Errorf("Shutting down on error: %s", shutdownChan.Value())
+		failed.Store(true)
+		stop()
+	}()
+
+	if err := app.Run(ctx); err != nil {
+		formattedLogger.Errorf("Server error: %v", err)
+		failed.Store(true)
+	}
+	stop()
+
+	workers.Wait()
+	formattedLogger.Info("Background workers have stopped")
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		formattedLogger.Errorf("Failed to flush spans: %v", err)
+	}
+	cancel()
+
+	if err := cache.Close(); err != nil {
+		formattedLogger.Errorf("Failed to close cache: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		formattedLogger.Errorf("Failed to close database: %v", err)
+	}
+
+	formattedLogger.Info("Shutdown complete")
+	if failed.Load() {
+		os.Exit(1)
+	}
 }
 
-func mkdirFiles(logger *logrus.Logger, shutdown models.ShutdownChannel) {
-	mode := 6400
-	pathToFiles := path.Join(".", "files")
-	if _, err:= os.Stat(pathToFiles); os.IsNotExist(err) {
-		err := os.Mkdir(pathToFiles, os.FileMode(mode))
-		if err != nil {
-			shutdown.Send(models.ShutdownMessage, "mkdirFiles", "failed to make direction `files`")
-			return
+// checkSetup exits when constructor reported error through shutdown channel, nothing is running yet to be drained
+func checkSetup(shutdownChan models.ShutdownChannel, logger *logrus.Logger) {
+	select {
+	case msg := <-shutdownChan:
+		logger.Fatalf("Error during setup: %s", msg)
+	default:
+	}
+}
+
+func registerJobs(runner *jobs.Runner, cfg *config.Config, repo *postgresql.PostgreSQL, storage models.FileStorage, auditRecorder *audit.Recorder, webhooks *webhook.Dispatcher, publisher models.EventPublisher, logger *logrus.Logger, shutdown models.ShutdownChannel) {
+	scrubber := integrity.NewScrubber(repo, storage, publisher, logger)
+	runner.Register(integrity.ScrubJob, scrubber.RunJob, jobs.Options{MaxAttempts: 1, Timeout: 6 * time.Hour})
+
+	reconciler := integrity.NewReconciler(repo, storage, logger, cfg.Integrity.ReconcileGrace, cfg.Integrity.ReconcileMaxOrphans)
+	runner.Register(integrity.ReconcileJob, reconciler.RunJob, jobs.Options{MaxAttempts: 1})
+
+	expiredSweeper := sweeper.NewSweeper(repo, storage, auditRecorder, webhooks, publisher, logger)
+	runner.Register(sweeper.ExpiredFilesJob, expiredSweeper.RunJob, jobs.Options{MaxAttempts: 1})
+
+	runner.Register(sessionsPurgeJob, func(ctx context.Context, _ json.RawMessage) error {
+		_, err := repo.PurgeEndedSessions(ctx, time.Now().Add(-sessionsRetention))
+		return err
+	}, jobs.Options{MaxAttempts: 1})
+
+	runner.Register(audit.PurgeJob, func(ctx context.Context, _ json.RawMessage) error {
+		if cfg.Audit.Retention <= 0 {
+			return nil
 		}
+
+		_, err := repo.PurgeAuditEvents(ctx, time.Now().Add(-cfg.Audit.Retention))
+		return err
+	}, jobs.Options{MaxAttempts: 1})
+
+	runner.Register(webhook.DeliverJob, webhooks.RunJob, jobs.Options{MaxAttempts: cfg.Webhooks.MaxAttempts, Concurrency: 4, Timeout: 2 * cfg.Webhooks.Timeout})
+	runner.Register(webhook.PurgeJob, func(ctx context.Context, _ json.RawMessage) error {
+		if cfg.Webhooks.DeliveryRetention <= 0 {
+			return nil
+		}
+
+		_, err := repo.PurgeWebhookDeliveries(ctx, time.Now().Add(-cfg.Webhooks.DeliveryRetention))
+		return err
+	}, jobs.Options{MaxAttempts: 1})
+
+	runner.Register(jwttool.RotateJob, func(ctx context.Context, _ json.RawMessage) error {
+		return jwttool.Rotate(ctx)
+	}, jobs.Options{MaxAttempts: 3})
+
+	rotateSpec := ""
+	if jwttool.Asymmetric() {
+		rotateSpec = jobs.Every(cfg.JWT.RotationInterval)
+	}
+
+	schedules := []struct {
+		name, spec, kind string
+		payload          any
+	}{
+		{"integrity-scrub", jobs.Every(cfg.Integrity.ScrubInterval), integrity.ScrubJob, nil},
+		{"files-sweep-expired", jobs.Every(cfg.Files.ExpirySweepInterval), sweeper.ExpiredFilesJob, nil},
+		{"sessions-purge", "@daily", sessionsPurgeJob, nil},
+		{"jwt-rotate", rotateSpec, jwttool.RotateJob, nil},
+		{"audit-purge", "@daily", audit.PurgeJob, nil},
+		{"webhook-deliveries-purge", "@daily", webhook.PurgeJob, nil},
+		{"integrity-reconcile", jobs.Every(cfg.Integrity.ReconcileInterval), integrity.ReconcileJob, integrity.ReconcilePayload{DryRun: !cfg.Integrity.ReconcileRepair}},
 	}
 
-	logger.Info("Files direction initialized!")
-}
\ No newline at end of file
+	for _, s := range schedules {
+		if err := runner.Schedule(s.name, s.spec, s.kind, s.payload); err != nil {
+			shutdown.Send(models.ShutdownMessage, "registerJobs", err.Error())
+			return
+		}
+	}
+}
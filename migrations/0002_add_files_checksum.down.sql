@@ -0,0 +1,4 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS checked_at,
+    DROP COLUMN IF EXISTS integrity_status,
+    DROP COLUMN IF EXISTS sha256;
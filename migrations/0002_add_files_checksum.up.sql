@@ -0,0 +1,4 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS sha256 TEXT,
+    ADD COLUMN IF NOT EXISTS integrity_status TEXT NOT NULL DEFAULT 'unverified',
+    ADD COLUMN IF NOT EXISTS checked_at TIMESTAMP;
@@ -0,0 +1,3 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS files_expires_at_idx ON files (expires_at) WHERE expires_at IS NOT NULL;
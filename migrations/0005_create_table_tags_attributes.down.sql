@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_attributes;
+DROP TABLE IF EXISTS tags;
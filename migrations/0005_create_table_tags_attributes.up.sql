@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS tags (
+    file_uuid UUID NOT NULL REFERENCES files(file_uuid) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (file_uuid, tag)
+);
+
+CREATE INDEX IF NOT EXISTS tags_tag_idx ON tags (tag);
+
+CREATE TABLE IF NOT EXISTS file_attributes (
+    file_uuid UUID NOT NULL REFERENCES files(file_uuid) ON DELETE CASCADE,
+    key VARCHAR(64) NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (file_uuid, key)
+);
+
+CREATE INDEX IF NOT EXISTS file_attributes_key_value_idx ON file_attributes (key, value);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS files_uploaded_at_idx;
+DROP INDEX IF EXISTS files_user_id_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS files_user_id_idx ON files (user_id);
+CREATE INDEX IF NOT EXISTS files_uploaded_at_idx ON files (uploaded_at);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    event TEXT NOT NULL,
+    actor_id INTEGER,
+    owner_id INTEGER,
+    file_uuid UUID,
+    ip TEXT,
+    details JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_owner_id_idx ON audit_events (owner_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_file_uuid_idx ON audit_events (file_uuid);
+
+-- records are never changed, old ones are only deleted by retention
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_update ON audit_events;
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
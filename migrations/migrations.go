@@ -0,0 +1,9 @@
+// SQL migrations of the database, embedded into binary so they are applied without files next to it
+package migrations
+
+import "embed"
+
+// FS holds NNNN_name.up.sql and NNNN_name.down.sql pairs
+//
+//go:embed *.sql
+var FS embed.FS